@@ -0,0 +1,16 @@
+-- the file table now records the device and inode numbers of each file
+ALTER TABLE file ADD COLUMN device INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE file ADD COLUMN inode INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_file_inode ON file(device, inode);
+
+-- file tags record whether they were applied explicitly or by 'imply --apply'.
+-- implied tags were previously applied when tagging so these are marked as
+-- implied where the file also has an implying tag.
+ALTER TABLE file_tag ADD COLUMN explicit INTEGER NOT NULL DEFAULT 1;
+UPDATE file_tag
+SET explicit = 0
+WHERE EXISTS (SELECT 1
+              FROM implication, file_tag implying
+              WHERE implication.implied_tag_id = file_tag.tag_id
+              AND implying.tag_id = implication.tag_id
+              AND implying.file_id = file_tag.file_id);
@@ -0,0 +1,175 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	exifMake             = 0x010F
+	exifModel            = 0x0110
+	exifDateTime         = 0x0132
+	exifIfdPointer       = 0x8769
+	exifDateTimeOriginal = 0x9003
+)
+
+// Proposes 'camera' and 'year' tags from the EXIF data of JPEG files.
+type exifExtractor struct{}
+
+func (exifExtractor) Name() string {
+	return "exif"
+}
+
+func (exifExtractor) Extract(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil || header[0] != 0xFF || header[1] != 0xD8 {
+		return nil, nil
+	}
+
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(reader, marker); err != nil || marker[0] != 0xFF {
+			return nil, nil
+		}
+
+		if marker[1] == 0xD9 || marker[1] == 0xDA {
+			// end of image or start of image data: no EXIF segment
+			return nil, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:]))
+		if length < 2 {
+			return nil, nil
+		}
+
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return nil, nil
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifTags(segment[6:]), nil
+		}
+	}
+}
+
+//- unexported
+
+func exifTags(tiff []byte) []string {
+	if len(tiff) < 8 {
+		return nil
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil
+	}
+
+	values := make(map[uint16]string)
+	exifOffset := readIfd(tiff, order, order.Uint32(tiff[4:]), values)
+	if exifOffset != 0 {
+		readIfd(tiff, order, exifOffset, values)
+	}
+
+	tagNames := make([]string, 0, 2)
+
+	cameraMake, model := values[exifMake], values[exifModel]
+	camera := model
+	if cameraMake != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(cameraMake)[0])) {
+		camera = cameraMake + " " + model
+	}
+	if tagName := prefixedTagName("camera", camera); tagName != "" {
+		tagNames = append(tagNames, tagName)
+	}
+
+	date := values[exifDateTimeOriginal]
+	if date == "" {
+		date = values[exifDateTime]
+	}
+	if dateYear := year(date); dateYear != "" {
+		tagNames = append(tagNames, "year:"+dateYear)
+	}
+
+	return tagNames
+}
+
+// Reads the ASCII values from the image file directory at the specified
+// offset, returning the offset of the EXIF sub-directory if present.
+func readIfd(tiff []byte, order binary.ByteOrder, offset uint32, values map[uint16]string) uint32 {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	exifOffset := uint32(0)
+
+	for index := 0; index < count; index++ {
+		entry := int(offset) + 2 + index*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		tag := order.Uint16(tiff[entry:])
+		kind := order.Uint16(tiff[entry+2:])
+		length := order.Uint32(tiff[entry+4:])
+
+		switch {
+		case tag == exifIfdPointer && kind == 4:
+			exifOffset = order.Uint32(tiff[entry+8:])
+		case kind == 2:
+			var data []byte
+			if length <= 4 {
+				data = tiff[entry+8 : entry+8+int(length)]
+			} else {
+				valueOffset := order.Uint32(tiff[entry+8:])
+				if uint64(valueOffset)+uint64(length) > uint64(len(tiff)) {
+					continue
+				}
+				data = tiff[valueOffset : valueOffset+length]
+			}
+
+			values[tag] = strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+		}
+	}
+
+	return exifOffset
+}
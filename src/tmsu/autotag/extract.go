@@ -0,0 +1,160 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/cli"
+	"unicode"
+)
+
+// Proposes tags for files from their metadata.
+type Extractor interface {
+	// The name of the extractor, e.g. 'exif'.
+	Name() string
+
+	// Proposes tags for the file at the specified path. Files that are not of
+	// a format the extractor understands result in no tags rather than an
+	// error.
+	Extract(path string) ([]string, error)
+}
+
+var extractors = []Extractor{mimeExtractor{}, exifExtractor{}, id3Extractor{}, pdfExtractor{}}
+
+// Registers an additional extractor.
+func RegisterExtractor(extractor Extractor) {
+	extractors = append(extractors, extractor)
+}
+
+// The registered extractors.
+func Extractors() []Extractor {
+	return extractors
+}
+
+// Proposes tags for the file at the specified path using each of the
+// registered extractors.
+func ExtractTags(path string) ([]string, error) {
+	tagNames := make([]string, 0, 10)
+
+	for _, extractor := range extractors {
+		extractedNames, err := extractor.Extract(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v extractor: %v", extractor.Name(), err)
+		}
+
+		for _, tagName := range extractedNames {
+			if tagName != "" && !containsName(tagNames, tagName) {
+				tagNames = append(tagNames, tagName)
+			}
+		}
+	}
+
+	return tagNames, nil
+}
+
+// Converts text to a valid tag name by replacing whitespace and the
+// characters that are not permitted in tag names with '-'. Slashes are kept,
+// allowing hierarchical tags such as 'genre/rock'. Returns an empty string if
+// no valid tag name results.
+func CleanTagName(text string) string {
+	cleaned := strings.Map(func(ch rune) rune {
+		switch {
+		case unicode.IsSpace(ch), ch == ',', ch == '=':
+			return '-'
+		case unicode.IsControl(ch):
+			return -1
+		}
+
+		return ch
+	}, text)
+
+	for strings.Contains(cleaned, "--") {
+		cleaned = strings.Replace(cleaned, "--", "-", -1)
+	}
+	cleaned = strings.Replace(strings.Replace(cleaned, "-/", "/", -1), "/-", "/", -1)
+	cleaned = strings.Trim(cleaned, "-")
+
+	if cli.ValidateTagName(cleaned) != nil {
+		return ""
+	}
+
+	return cleaned
+}
+
+//- unexported
+
+// Builds a tag of the form 'prefix:value' or an empty string if the value
+// results in no valid tag name.
+func prefixedTagName(prefix, value string) string {
+	value = CleanTagName(value)
+	if value == "" {
+		return ""
+	}
+
+	return prefix + ":" + value
+}
+
+// Extracts the year from the start of a date, e.g. '2012:06:01' or '2012'.
+func year(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) < 4 {
+		return ""
+	}
+
+	for _, ch := range date[:4] {
+		if ch < '0' || ch > '9' {
+			return ""
+		}
+	}
+
+	if date[:4] == "0000" {
+		return ""
+	}
+
+	return date[:4]
+}
+
+type mimeExtractor struct{}
+
+func (mimeExtractor) Name() string {
+	return "mime"
+}
+
+func (mimeExtractor) Extract(path string) ([]string, error) {
+	mimeType, err := MimeType(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(mimeType, "/", 2)
+	if len(parts) != 2 || mimeType == "application/octet-stream" {
+		return nil, nil
+	}
+
+	tagNames := make([]string, 0, 2)
+
+	switch parts[0] {
+	case "image", "audio", "video", "text":
+		tagNames = append(tagNames, parts[0])
+	}
+
+	tagNames = append(tagNames, prefixedTagName("format", parts[1]))
+
+	return tagNames, nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExifExtractor(test *testing.T) {
+	// TIFF header followed by IFD0 with make, model and a pointer to the EXIF
+	// IFD containing the original date and time
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+
+	makeValue, modelValue, dateValue := "Canon\x00", "Canon EOS 5D\x00", "2012:06:01 12:00:00\x00"
+	ifd0Size := 2 + 3*12 + 4
+	exifIfdOffset := 8 + ifd0Size
+	exifIfdSize := 2 + 12 + 4
+	dataOffset := exifIfdOffset + exifIfdSize
+
+	binary.Write(tiff, binary.BigEndian, uint16(3))
+	writeIfdEntry(tiff, exifMake, 2, len(makeValue), dataOffset)
+	writeIfdEntry(tiff, exifModel, 2, len(modelValue), dataOffset+len(makeValue))
+	writeIfdEntry(tiff, exifIfdPointer, 4, 1, exifIfdOffset)
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	writeIfdEntry(tiff, exifDateTimeOriginal, 2, len(dateValue), dataOffset+len(makeValue)+len(modelValue))
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	tiff.WriteString(makeValue + modelValue + dateValue)
+
+	jpeg := new(bytes.Buffer)
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xD9})
+
+	path := writeTestFile(test, "tmsu-exif.jpg", jpeg.Bytes())
+	defer os.Remove(path)
+
+	expectExtractedTags(test, exifExtractor{}, path, "camera:Canon-EOS-5D year:2012")
+}
+
+func TestId3v2Extractor(test *testing.T) {
+	frames := new(bytes.Buffer)
+	writeId3Frame(frames, "TPE1", "\x03The Beatles")
+	writeId3Frame(frames, "TALB", "\x00Abbey Road")
+	writeId3Frame(frames, "TYER", "\x001969")
+	writeId3Frame(frames, "TCON", "\x00(17)Rock")
+
+	mp3 := new(bytes.Buffer)
+	mp3.WriteString("ID3\x03\x00\x00")
+	size := frames.Len()
+	mp3.Write([]byte{byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)})
+	mp3.Write(frames.Bytes())
+
+	path := writeTestFile(test, "tmsu-id3v2.mp3", mp3.Bytes())
+	defer os.Remove(path)
+
+	expectExtractedTags(test, id3Extractor{}, path, "artist:The-Beatles album:Abbey-Road year:1969 genre:Rock")
+}
+
+func TestId3v1Extractor(test *testing.T) {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Something")
+	copy(tag[33:], "The Beatles")
+	copy(tag[63:], "Abbey Road")
+	copy(tag[93:], "1969")
+
+	path := writeTestFile(test, "tmsu-id3v1.mp3", append(make([]byte, 100), tag...))
+	defer os.Remove(path)
+
+	expectExtractedTags(test, id3Extractor{}, path, "artist:The-Beatles album:Abbey-Road year:1969")
+}
+
+func TestPdfExtractor(test *testing.T) {
+	pdf := "%PDF-1.4\n1 0 obj\n<< /Author (Jane \\(J.\\) Doe) /Keywords <FEFF0063006100740073002C00200064006F00670073> /CreationDate (D:20120601120000Z) >>\nendobj\n"
+
+	path := writeTestFile(test, "tmsu-test.pdf", []byte(pdf))
+	defer os.Remove(path)
+
+	expectExtractedTags(test, pdfExtractor{}, path, "author:Jane-(J.)-Doe year:2012 cats dogs")
+}
+
+func TestExtractorsIgnoreOtherFormats(test *testing.T) {
+	path := writeTestFile(test, "tmsu-other", []byte("just some text"))
+	defer os.Remove(path)
+
+	for _, extractor := range []Extractor{exifExtractor{}, id3Extractor{}, pdfExtractor{}} {
+		expectExtractedTags(test, extractor, path, "")
+	}
+}
+
+func TestRegisterExtractor(test *testing.T) {
+	defer func(original []Extractor) { extractors = original }(extractors)
+	extractors = []Extractor{}
+
+	RegisterExtractor(testExtractor{})
+
+	path := writeTestFile(test, "tmsu-custom", []byte("custom"))
+	defer os.Remove(path)
+
+	tagNames, err := ExtractTags(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tagNames, " ") != "custom" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+func TestCleanTagName(test *testing.T) {
+	cases := map[string]string{"The Beatles": "The-Beatles", " a, b / c=d ": "a-b/c-d", "genre/rock": "genre/rock",
+		"-x-": "x", "..": "", "\t": "", "a//b": "", "/a": "", "a/..": ""}
+
+	for text, expected := range cases {
+		if actual := CleanTagName(text); actual != expected {
+			test.Fatalf("Expected '%v' to be cleaned to '%v' but was '%v'.", text, expected, actual)
+		}
+	}
+}
+
+//
+
+type testExtractor struct{}
+
+func (testExtractor) Name() string {
+	return "test"
+}
+
+func (testExtractor) Extract(path string) ([]string, error) {
+	return []string{filepath.Base(path)[len("tmsu-"):]}, nil
+}
+
+func writeIfdEntry(buffer *bytes.Buffer, tag, kind uint16, count, offset int) {
+	binary.Write(buffer, binary.BigEndian, tag)
+	binary.Write(buffer, binary.BigEndian, kind)
+	binary.Write(buffer, binary.BigEndian, uint32(count))
+	binary.Write(buffer, binary.BigEndian, uint32(offset))
+}
+
+func writeId3Frame(buffer *bytes.Buffer, id, text string) {
+	buffer.WriteString(id)
+	binary.Write(buffer, binary.BigEndian, uint32(len(text)))
+	buffer.Write([]byte{0, 0})
+	buffer.WriteString(text)
+}
+
+func writeTestFile(test *testing.T, name string, content []byte) string {
+	path := filepath.Join(os.TempDir(), name)
+	if err := ioutil.WriteFile(path, content, 0666); err != nil {
+		test.Fatal(err)
+	}
+
+	return path
+}
+
+func expectExtractedTags(test *testing.T, extractor Extractor, path string, expected string) {
+	tagNames, err := extractor.Extract(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if actual := strings.Join(tagNames, " "); actual != expected {
+		test.Fatalf("%v: expected tags '%v' but were '%v'.", extractor.Name(), expected, actual)
+	}
+}
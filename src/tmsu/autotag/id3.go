@@ -0,0 +1,257 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const maximumId3Size = 16 * 1024 * 1024
+
+// The text frames of interest for each of ID3v2.2 (three character identifiers)
+// and ID3v2.3/4.
+var id3Frames = map[string]string{
+	"TP1": "artist", "TPE1": "artist",
+	"TAL": "album", "TALB": "album",
+	"TYE": "year", "TYER": "year", "TDRC": "year",
+	"TCO": "genre", "TCON": "genre",
+}
+
+// Proposes 'artist', 'album', 'year' and 'genre' tags from the ID3v2 or ID3v1
+// tags of audio files.
+type id3Extractor struct{}
+
+func (id3Extractor) Name() string {
+	return "id3"
+}
+
+func (id3Extractor) Extract(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err == nil && string(header[:3]) == "ID3" {
+		readId3v2(file, header, values)
+	}
+
+	if len(values) == 0 {
+		if err := readId3v1(file, values); err != nil {
+			return nil, fmt.Errorf("%v: could not read ID3v1 tag: %v", path, err)
+		}
+	}
+
+	tagNames := make([]string, 0, 4)
+	for _, name := range []string{"artist", "album", "year", "genre"} {
+		value := values[name]
+
+		switch name {
+		case "year":
+			value = year(value)
+		case "genre":
+			value = id3Genre(value)
+		}
+
+		if tagName := prefixedTagName(name, value); tagName != "" {
+			tagNames = append(tagNames, tagName)
+		}
+	}
+
+	return tagNames, nil
+}
+
+//- unexported
+
+func readId3v2(file *os.File, header []byte, values map[string]string) {
+	version := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+
+	if version < 2 || version > 4 || size > maximumId3Size {
+		return
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return
+	}
+
+	if flags&0x40 != 0 && len(data) >= 4 {
+		// skip the extended header
+		switch version {
+		case 3:
+			extendedSize := int(binary.BigEndian.Uint32(data)) + 4
+			if extendedSize > len(data) {
+				return
+			}
+			data = data[extendedSize:]
+		case 4:
+			extendedSize := syncsafe(data[:4])
+			if extendedSize > len(data) {
+				return
+			}
+			data = data[extendedSize:]
+		}
+	}
+
+	idLength, headerLength := 4, 10
+	if version == 2 {
+		idLength, headerLength = 3, 6
+	}
+
+	for len(data) >= headerLength && data[0] != 0 {
+		id := string(data[:idLength])
+
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+		case 4:
+			frameSize = syncsafe(data[4:8])
+		}
+
+		if frameSize < 0 || headerLength+frameSize > len(data) {
+			return
+		}
+
+		frame := data[headerLength : headerLength+frameSize]
+		data = data[headerLength+frameSize:]
+
+		if name, found := id3Frames[id]; found {
+			if text := id3Text(frame); text != "" {
+				values[name] = text
+			}
+		}
+	}
+}
+
+func readId3v1(file *os.File, values map[string]string) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() < 128 {
+		return nil
+	}
+
+	tag := make([]byte, 128)
+	if _, err := file.ReadAt(tag, stat.Size()-128); err != nil {
+		return err
+	}
+	if string(tag[:3]) != "TAG" {
+		return nil
+	}
+
+	values["artist"] = latin1(trimNul(tag[33:63]))
+	values["album"] = latin1(trimNul(tag[63:93]))
+	values["year"] = latin1(trimNul(tag[93:97]))
+
+	return nil
+}
+
+// Decodes the first string of a text frame.
+func id3Text(frame []byte) string {
+	if len(frame) < 2 {
+		return ""
+	}
+
+	encoding, text := frame[0], frame[1:]
+
+	switch encoding {
+	case 0:
+		return strings.TrimSpace(latin1(trimNul(text)))
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(text) >= 2 {
+			switch {
+			case text[0] == 0xFF && text[1] == 0xFE:
+				order = binary.LittleEndian
+				text = text[2:]
+			case text[0] == 0xFE && text[1] == 0xFF:
+				text = text[2:]
+			}
+		}
+
+		units := make([]uint16, 0, len(text)/2)
+		for index := 0; index+1 < len(text); index += 2 {
+			unit := order.Uint16(text[index:])
+			if unit == 0 {
+				break
+			}
+			units = append(units, unit)
+		}
+
+		return strings.TrimSpace(string(utf16.Decode(units)))
+	case 3:
+		return strings.TrimSpace(string(trimNul(text)))
+	}
+
+	return ""
+}
+
+// Strips numeric genre references, e.g. '(17)Rock' or '17', which are only
+// meaningful with the ID3v1 genre list.
+func id3Genre(genre string) string {
+	for strings.HasPrefix(genre, "(") {
+		end := strings.Index(genre, ")")
+		if end == -1 {
+			break
+		}
+		genre = genre[end+1:]
+	}
+
+	if strings.Trim(genre, "0123456789") == "" {
+		return ""
+	}
+
+	return genre
+}
+
+func syncsafe(data []byte) int {
+	return int(data[0]&0x7F)<<21 | int(data[1]&0x7F)<<14 | int(data[2]&0x7F)<<7 | int(data[3]&0x7F)
+}
+
+func trimNul(data []byte) []byte {
+	for index, b := range data {
+		if b == 0 {
+			return data[:index]
+		}
+	}
+
+	return data
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for index, b := range data {
+		runes[index] = rune(b)
+	}
+
+	return strings.TrimSpace(string(runes))
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Determines the MIME type of the file from its contents, falling back to its
+// extension where the contents are not recognised.
+func MimeType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("%v: could not open file: %v", path, err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 512)
+	count, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("%v: could not read file: %v", path, err)
+	}
+
+	mimeType := stripParameters(http.DetectContentType(buffer[:count]))
+
+	if mimeType == "application/octet-stream" || mimeType == "text/plain" {
+		if extensionType := mime.TypeByExtension(filepath.Ext(path)); extensionType != "" {
+			return stripParameters(extensionType), nil
+		}
+	}
+
+	return mimeType, nil
+}
+
+func stripParameters(mimeType string) string {
+	if index := strings.Index(mimeType, ";"); index != -1 {
+		return strings.TrimSpace(mimeType[:index])
+	}
+
+	return mimeType
+}
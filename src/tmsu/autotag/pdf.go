@@ -0,0 +1,223 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Files larger than this only have their start and end examined.
+const pdfScanSize = 1024 * 1024
+
+// Proposes 'author' and 'year' tags and a tag per keyword from the information
+// dictionary of PDF documents.
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string {
+	return "pdf"
+}
+
+func (pdfExtractor) Extract(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(file, header); err != nil || string(header) != "%PDF-" {
+		return nil, nil
+	}
+
+	content, err := readPdfContent(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not read file: %v", path, err)
+	}
+
+	tagNames := make([]string, 0, 10)
+
+	if tagName := prefixedTagName("author", pdfString(content, "/Author")); tagName != "" {
+		tagNames = append(tagNames, tagName)
+	}
+
+	if dateYear := year(strings.TrimPrefix(pdfString(content, "/CreationDate"), "D:")); dateYear != "" {
+		tagNames = append(tagNames, "year:"+dateYear)
+	}
+
+	keywords := strings.FieldsFunc(pdfString(content, "/Keywords"), func(ch rune) bool { return ch == ',' || ch == ';' })
+	for _, keyword := range keywords {
+		if tagName := CleanTagName(keyword); tagName != "" && !containsName(tagNames, tagName) {
+			tagNames = append(tagNames, tagName)
+		}
+	}
+
+	return tagNames, nil
+}
+
+//- unexported
+
+func readPdfContent(file *os.File) ([]byte, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.Size() <= 2*pdfScanSize {
+		content := make([]byte, stat.Size())
+		_, err := file.ReadAt(content, 0)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		return content, nil
+	}
+
+	content := make([]byte, 2*pdfScanSize)
+	if _, err := file.ReadAt(content[:pdfScanSize], 0); err != nil {
+		return nil, err
+	}
+	if _, err := file.ReadAt(content[pdfScanSize:], stat.Size()-pdfScanSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// Retrieves the string value of the last occurrence of the specified key, the
+// last being the most recent should the document have been updated.
+func pdfString(content []byte, key string) string {
+	index := bytes.LastIndex(content, []byte(key))
+	if index == -1 {
+		return ""
+	}
+
+	value := bytes.TrimLeft(content[index+len(key):], " \t\r\n")
+	if len(value) == 0 {
+		return ""
+	}
+
+	var raw []byte
+	switch {
+	case value[0] == '(':
+		raw = pdfLiteralString(value[1:])
+	case value[0] == '<' && len(value) > 1 && value[1] != '<':
+		end := bytes.IndexByte(value, '>')
+		if end == -1 {
+			return ""
+		}
+
+		hexDigits := strings.Map(func(ch rune) rune {
+			if strings.ContainsRune(" \t\r\n", ch) {
+				return -1
+			}
+			return ch
+		}, string(value[1:end]))
+		if len(hexDigits)%2 == 1 {
+			hexDigits += "0"
+		}
+
+		decoded, err := hex.DecodeString(hexDigits)
+		if err != nil {
+			return ""
+		}
+		raw = decoded
+	default:
+		return ""
+	}
+
+	return strings.TrimSpace(pdfText(raw))
+}
+
+// Parses a literal string, starting after the opening parenthesis.
+func pdfLiteralString(data []byte) []byte {
+	result := make([]byte, 0, 64)
+	depth := 0
+
+	for index := 0; index < len(data); index++ {
+		ch := data[index]
+
+		switch ch {
+		case '\\':
+			index++
+			if index == len(data) {
+				return result
+			}
+
+			switch escaped := data[index]; escaped {
+			case 'n':
+				result = append(result, '\n')
+			case 'r':
+				result = append(result, '\r')
+			case 't':
+				result = append(result, '\t')
+			case 'b':
+				result = append(result, '\b')
+			case 'f':
+				result = append(result, '\f')
+			case '\r', '\n':
+				// line continuation
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := 0
+					for digits := 0; digits < 3 && index < len(data) && data[index] >= '0' && data[index] <= '7'; digits++ {
+						value = value*8 + int(data[index]-'0')
+						index++
+					}
+					index--
+					result = append(result, byte(value))
+				} else {
+					result = append(result, escaped)
+				}
+			}
+		case '(':
+			depth++
+			result = append(result, ch)
+		case ')':
+			if depth == 0 {
+				return result
+			}
+			depth--
+			result = append(result, ch)
+		default:
+			result = append(result, ch)
+		}
+	}
+
+	return result
+}
+
+// Decodes PDF text strings which are either UTF-16BE, with a byte order mark,
+// or (approximately) Latin-1.
+func pdfText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for index := 2; index+1 < len(raw); index += 2 {
+			units = append(units, uint16(raw[index])<<8|uint16(raw[index+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	return latin1(raw)
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A rule that applies a set of tags, or the tags proposed by an external
+// tagger, to the files that satisfy all of its conditions.
+type Rule struct {
+	conditions []condition
+	Tags       []string
+	Tagger     *Tagger
+}
+
+type Rules []*Rule
+
+// Loads the rules from the file at the specified path. A missing rules file
+// results in an empty set of rules.
+func LoadRules(rulesPath string) (Rules, error) {
+	file, err := os.Open(rulesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Rules{}, nil
+		}
+		return nil, fmt.Errorf("%v: could not open rules file: %v", rulesPath, err)
+	}
+	defer file.Close()
+
+	rules, err := ParseRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", rulesPath, err)
+	}
+
+	return rules, nil
+}
+
+// Parses a set of rules, one per line, of the form:
+//
+//	CONDITION... -> TAG...
+//	CONDITION... => PROGRAM [ARG]...
+//
+// Blank lines and lines starting with '#' are ignored.
+func ParseRules(reader io.Reader) (Rules, error) {
+	rules := make(Rules, 0, 10)
+	scanner := bufio.NewScanner(reader)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read rules: %v", err)
+	}
+
+	return rules, nil
+}
+
+// Determines the tags the rules apply to the specified file.
+func (rules Rules) Tags(filePath string, stat os.FileInfo) ([]string, error) {
+	file := &candidate{path: filePath, stat: stat}
+	tagNames := make([]string, 0, 10)
+
+	for _, rule := range rules {
+		matches, err := rule.matches(file)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			continue
+		}
+
+		ruleTagNames := rule.Tags
+		if rule.Tagger != nil {
+			ruleTagNames, err = rule.Tagger.Extract(filePath)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, tagName := range ruleTagNames {
+			if !containsName(tagNames, tagName) {
+				tagNames = append(tagNames, tagName)
+			}
+		}
+	}
+
+	return tagNames, nil
+}
+
+//- unexported
+
+type candidate struct {
+	path     string
+	stat     os.FileInfo
+	mimeType string
+}
+
+func (file *candidate) MimeType() (string, error) {
+	if file.mimeType == "" {
+		mimeType, err := MimeType(file.path)
+		if err != nil {
+			return "", err
+		}
+
+		file.mimeType = mimeType
+	}
+
+	return file.mimeType, nil
+}
+
+type condition func(file *candidate) (bool, error)
+
+func (rule *Rule) matches(file *candidate) (bool, error) {
+	for _, condition := range rule.conditions {
+		matches, err := condition(file)
+		if err != nil {
+			return false, err
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func parseRule(line string) (*Rule, error) {
+	separator := "->"
+	tagsIndex, taggerIndex := strings.Index(line, "->"), strings.Index(line, "=>")
+	if taggerIndex != -1 && (tagsIndex == -1 || taggerIndex < tagsIndex) {
+		separator = "=>"
+	}
+
+	parts := strings.SplitN(line, separator, 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected 'CONDITION... -> TAG...' or 'CONDITION... => PROGRAM...'")
+	}
+
+	conditionTexts := strings.Fields(parts[0])
+	if len(conditionTexts) == 0 {
+		return nil, fmt.Errorf("no conditions specified")
+	}
+
+	var tagNames []string
+	var tagger *Tagger
+
+	if separator == "=>" {
+		command := strings.Fields(parts[1])
+		if len(command) == 0 {
+			return nil, fmt.Errorf("no tagger program specified")
+		}
+
+		var err error
+		tagger, err = NewTagger(command)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tagNames = strings.Fields(parts[1])
+		if len(tagNames) == 0 {
+			return nil, fmt.Errorf("no tags specified")
+		}
+	}
+
+	conditions := make([]condition, len(conditionTexts))
+	for index, text := range conditionTexts {
+		condition, err := parseCondition(text)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions[index] = condition
+	}
+
+	return &Rule{conditions, tagNames, tagger}, nil
+}
+
+func parseCondition(text string) (condition, error) {
+	parts := strings.SplitN(text, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid condition '%v': expected 'KIND:VALUE'", text)
+	}
+
+	kind, value := parts[0], parts[1]
+
+	switch kind {
+	case "name":
+		if _, err := filepath.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%v': %v", value, err)
+		}
+
+		return func(file *candidate) (bool, error) {
+			return filepath.Match(value, filepath.Base(file.path))
+		}, nil
+	case "path":
+		pattern, err := expandHome(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%v': %v", value, err)
+		}
+
+		return func(file *candidate) (bool, error) {
+			return filepath.Match(pattern, file.path)
+		}, nil
+	case "under":
+		directory, err := expandHome(value)
+		if err != nil {
+			return nil, err
+		}
+		directory = filepath.Clean(directory)
+
+		return func(file *candidate) (bool, error) {
+			return strings.HasPrefix(file.path, directory+string(filepath.Separator)), nil
+		}, nil
+	case "regex":
+		expression, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%v': %v", value, err)
+		}
+
+		return func(file *candidate) (bool, error) {
+			return expression.MatchString(file.path), nil
+		}, nil
+	case "ext":
+		extensions := strings.Split(value, ",")
+
+		return func(file *candidate) (bool, error) {
+			extension := strings.TrimPrefix(filepath.Ext(file.path), ".")
+			for _, candidateExtension := range extensions {
+				if strings.EqualFold(extension, strings.TrimPrefix(candidateExtension, ".")) {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		}, nil
+	case "size":
+		return parseSizeCondition(value)
+	case "mime":
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%v': %v", value, err)
+		}
+
+		return func(file *candidate) (bool, error) {
+			if file.stat.IsDir() {
+				return false, nil
+			}
+
+			mimeType, err := file.MimeType()
+			if err != nil {
+				return false, err
+			}
+
+			return path.Match(value, mimeType)
+		}, nil
+	case "type":
+		switch value {
+		case "file":
+			return func(file *candidate) (bool, error) { return !file.stat.IsDir(), nil }, nil
+		case "dir":
+			return func(file *candidate) (bool, error) { return file.stat.IsDir(), nil }, nil
+		}
+
+		return nil, fmt.Errorf("invalid type '%v': expected 'file' or 'dir'", value)
+	}
+
+	return nil, fmt.Errorf("unknown condition '%v'", kind)
+}
+
+func parseSizeCondition(value string) (condition, error) {
+	operator := strings.TrimRight(value, "0123456789.KMGkmg")
+	text := value[len(operator):]
+
+	multiplier := int64(1)
+	if text != "" {
+		switch strings.ToUpper(text[len(text)-1:]) {
+		case "K":
+			multiplier = 1024
+		case "M":
+			multiplier = 1024 * 1024
+		case "G":
+			multiplier = 1024 * 1024 * 1024
+		}
+		if multiplier != 1 {
+			text = text[:len(text)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size '%v'", value)
+	}
+	size := int64(number * float64(multiplier))
+
+	var compare func(int64) bool
+	switch operator {
+	case ">":
+		compare = func(fileSize int64) bool { return fileSize > size }
+	case ">=":
+		compare = func(fileSize int64) bool { return fileSize >= size }
+	case "<":
+		compare = func(fileSize int64) bool { return fileSize < size }
+	case "<=":
+		compare = func(fileSize int64) bool { return fileSize <= size }
+	case "=", "":
+		compare = func(fileSize int64) bool { return fileSize == size }
+	default:
+		return nil, fmt.Errorf("invalid size comparison '%v'", operator)
+	}
+
+	return func(file *candidate) (bool, error) {
+		return !file.stat.IsDir() && compare(file.stat.Size()), nil
+	}, nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve current user: %v", err)
+	}
+
+	return filepath.Join(u.HomeDir, path[1:]), nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, candidateName := range names {
+		if candidateName == name {
+			return true
+		}
+	}
+
+	return false
+}
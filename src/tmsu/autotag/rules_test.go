@@ -0,0 +1,97 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRulesTags(test *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# comment
+ext:FLAC,ogg -> audio
+name:*.flac size:>10 -> big
+name:*.flac size:<=10 -> small
+regex:^/tmp/.*-rules/ type:file -> tmp audio
+type:dir -> directory`))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	path := filepath.Join(os.TempDir(), "tmsu-rules", "a.flac")
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	file.WriteString("hello")
+	file.Close()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tags, err := rules.Tags(path, stat)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tags, " ") != "audio small tmp" {
+		test.Fatalf("Unexpected tags: %v.", tags)
+	}
+}
+
+func TestMimeType(test *testing.T) {
+	path := filepath.Join(os.TempDir(), "tmsu-mime")
+
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	file.WriteString("\x89PNG\x0D\x0A\x1A\x0A")
+	file.Close()
+
+	mimeType, err := MimeType(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if mimeType != "image/png" {
+		test.Fatalf("Expected MIME type 'image/png' but is '%v'.", mimeType)
+	}
+}
+
+func TestParseRulesInvalid(test *testing.T) {
+	invalid := []string{"ext:flac", "ext:flac ->", "-> audio", "colour:red -> red", "size:~5 -> odd", "regex:( -> bad", "type:link -> link"}
+
+	for _, text := range invalid {
+		if _, err := ParseRules(strings.NewReader(text)); err == nil {
+			test.Fatalf("Expected rule '%v' to be rejected.", text)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// An external program that proposes tags for a file. The program is run with
+// the file's path as its final argument and outputs the tags either one per
+// line or as JSON: an array of tag names or an object with a 'tags' member.
+type Tagger struct {
+	command []string
+}
+
+// Creates a tagger for the specified program and arguments.
+func NewTagger(command []string) (*Tagger, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no tagger program specified")
+	}
+
+	program, err := expandHome(command[0])
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := make([]string, len(command))
+	copy(expanded, command)
+	expanded[0] = program
+
+	return &Tagger{expanded}, nil
+}
+
+func (tagger *Tagger) Name() string {
+	return tagger.command[0]
+}
+
+func (tagger *Tagger) Extract(path string) ([]string, error) {
+	arguments := append(append([]string{}, tagger.command[1:]...), path)
+	command := exec.Command(tagger.command[0], arguments...)
+
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message != "" {
+			return nil, fmt.Errorf("%v: tagger failed: %v: %v", path, err, message)
+		}
+		return nil, fmt.Errorf("%v: tagger failed: %v", path, err)
+	}
+
+	tagNames, err := parseTaggerOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not parse tagger output: %v", path, err)
+	}
+
+	return tagNames, nil
+}
+
+//- unexported
+
+func parseTaggerOutput(output []byte) ([]string, error) {
+	trimmed := bytes.TrimSpace(output)
+
+	var texts []string
+
+	switch {
+	case len(trimmed) == 0:
+		return []string{}, nil
+	case trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &texts); err != nil {
+			return nil, err
+		}
+	case trimmed[0] == '{':
+		var object struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(trimmed, &object); err != nil {
+			return nil, err
+		}
+		texts = object.Tags
+	default:
+		texts = strings.Split(string(trimmed), "\n")
+	}
+
+	tagNames := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+
+		tagName := CleanTagName(text)
+		if tagName != "" && !containsName(tagNames, tagName) {
+			tagNames = append(tagNames, tagName)
+		}
+	}
+
+	return tagNames, nil
+}
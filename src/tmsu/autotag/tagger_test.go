@@ -0,0 +1,117 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package autotag
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTaggerLines(test *testing.T) {
+	tagger, cleanup := createTagger(test, "echo '# comment'\necho music\necho 'rock music'\necho \"$1\" | grep -q flac && echo lossless\n")
+	defer cleanup()
+
+	tagNames, err := tagger.Extract("/tmp/a.flac")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tagNames, " ") != "music rock-music lossless" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+func TestTaggerJson(test *testing.T) {
+	tagger, cleanup := createTagger(test, "echo '{\"tags\": [\"cat\", \"animal\", \"cat\"]}'\n")
+	defer cleanup()
+
+	tagNames, err := tagger.Extract("/tmp/a.jpg")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tagNames, " ") != "cat animal" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+
+	tagNames, err = parseTaggerOutput([]byte(`["a", "b"]`))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tagNames, " ") != "a b" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+func TestTaggerFailure(test *testing.T) {
+	tagger, cleanup := createTagger(test, "echo 'unsupported file' >&2\nexit 3\n")
+	defer cleanup()
+
+	_, err := tagger.Extract("/tmp/a.jpg")
+	if err == nil {
+		test.Fatal("Expected tagger failure.")
+	}
+	if !strings.Contains(err.Error(), "unsupported file") {
+		test.Fatalf("Error does not include tagger output: %v.", err)
+	}
+}
+
+func TestParseTaggerRule(test *testing.T) {
+	tagger, cleanup := createTagger(test, "echo \"$1\"\necho \"$2\"\n")
+	defer cleanup()
+
+	rules, err := ParseRules(strings.NewReader("name:*-x => " + tagger.Name() + " one"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	stat, err := os.Stat(os.TempDir())
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagNames, err := rules.Tags("a-x", stat)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if strings.Join(tagNames, " ") != "one a-x" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+//- helpers
+
+func createTagger(test *testing.T, script string) (*Tagger, func()) {
+	path := filepath.Join(os.TempDir(), "tmsu-tagger")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	tagger, err := NewTagger([]string{path})
+	if err != nil {
+		os.Remove(path)
+		test.Fatal(err)
+	}
+
+	return tagger, func() { os.Remove(path) }
+}
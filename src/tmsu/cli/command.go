@@ -25,6 +25,20 @@ type Command interface {
 	Exec(options Options, args []string) error
 }
 
+// Implemented by the commands having options that take an argument, giving
+// how each such argument is completed by the option's long name.
+type OptionCompleter interface {
+	OptionCompletions() map[string]Completion
+}
+
+// The values with which an argument can be completed.
+type Completion struct {
+	Tags     bool
+	Files    bool
+	Commands bool
+	Values   []string
+}
+
 type CommandName string
 
 type CommandNames []CommandName
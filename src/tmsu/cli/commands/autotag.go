@@ -0,0 +1,245 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/autotag"
+	"tmsu/cli"
+	"tmsu/common"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+type AutotagCommand struct {
+	verbose   bool
+	recursive bool
+	pretend   bool
+	extract   bool
+	rules     autotag.Rules
+}
+
+func (AutotagCommand) Name() cli.CommandName {
+	return "autotag"
+}
+
+func (AutotagCommand) Synopsis() string {
+	return "Apply tags to files according to rules"
+}
+
+func (AutotagCommand) Description() string {
+	return `tmsu autotag [OPTION]... PATH...
+
+Tags each PATH according to the auto-tagging rules. Files that match no rule
+are not added to the database.
+
+The rules are read from the file specified by --rules or, if not specified,
+the file specified by the TMSU_RULES environment variable or, if not defined,
+'~/.tmsu/rules'. The same rules are applied by the 'tag' command whenever a
+file is first added to the database.
+
+Each line of the rules file is a rule of the form:
+
+    CONDITION... -> TAG...
+
+A file is tagged with the rule's TAGs if it satisfies all of the rule's
+CONDITIONs. Blank lines and lines starting with '#' are ignored.
+
+    name:GLOB         file name matches the glob, e.g. name:*.flac
+    path:GLOB         absolute path matches the glob
+    under:DIR         file is within the directory, e.g. under:~/music
+    regex:REGEX       absolute path matches the regular expression
+    ext:EXT[,EXT]...  file has one of the extensions (ignoring case)
+    size:OP SIZE      file size comparison, e.g. size:>10M or size:<=512K
+    mime:TYPE         MIME type matches the glob, e.g. mime:image/*
+    type:file|dir     path is a file or directory
+
+For example:
+
+    under:~/music ext:flac -> music audio lossless
+
+A rule of the form 'CONDITION... => PROGRAM [ARG]...' instead runs the external
+tagger PROGRAM for matching files (see 'tmsu help tag'):
+
+    mime:image/* => ~/bin/classify --threshold 0.8
+
+With --extract, tags are also extracted from the metadata of each file (see
+'tmsu help tag'). Combined with --pretend this lists the proposed tags.`
+}
+
+func (AutotagCommand) Options() cli.Options {
+	return cli.Options{{"--recursive", "-r", "recursively apply rules to directory contents", false, ""},
+		{"--pretend", "-p", "list the tags that would be applied without applying them", false, ""},
+		{"--rules", "-R", "read rules from the specified file", true, ""},
+		{"--extract", "-e", "apply tags extracted from file metadata", false, ""}}
+}
+
+func (AutotagCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{"--rules": {Files: true}}
+}
+
+func (command AutotagCommand) Exec(options cli.Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("at least one path must be specified.")
+	}
+
+	command.verbose = options.HasOption("--verbose")
+	command.recursive = options.HasOption("--recursive")
+	command.pretend = options.HasOption("--pretend")
+	command.extract = options.HasOption("--extract")
+
+	rulesPath := ""
+	if options.HasOption("--rules") {
+		rulesPath = options.Get("--rules").Argument
+	}
+
+	rules, err := loadRules(rulesPath)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 && !command.extract {
+		return fmt.Errorf("no auto-tagging rules are defined.")
+	}
+	command.rules = rules
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	for _, path := range args {
+		if err := command.autotagPath(store, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//- unexported
+
+func (command AutotagCommand) autotagPath(store *storage.Storage, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		switch {
+		case os.IsPermission(err):
+			return fmt.Errorf("%v: permisison denied", path)
+		case os.IsNotExist(err):
+			return fmt.Errorf("%v: no such file", path)
+		default:
+			return fmt.Errorf("%v: could not stat file: %v", path, err)
+		}
+	}
+
+	tagNames, err := command.rules.Tags(absPath, stat)
+	if err != nil {
+		return fmt.Errorf("%v: could not apply auto-tagging rules: %v", path, err)
+	}
+
+	if command.extract && !stat.IsDir() {
+		extractedNames, err := autotag.ExtractTags(absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not extract tags: %v", path, err)
+		}
+
+		for _, tagName := range extractedNames {
+			if !containsString(tagNames, tagName) {
+				tagNames = append(tagNames, tagName)
+			}
+		}
+	}
+
+	if len(tagNames) > 0 {
+		if command.verbose || command.pretend {
+			log.Infof("%v: tagging %v", path, strings.Join(tagNames, " "))
+		}
+
+		if !command.pretend {
+			tagCommand := TagCommand{}
+			tagCommand.verbose = command.verbose
+
+			tagIds, err := tagCommand.lookupTagIds(store, tagNames)
+			if err != nil {
+				return err
+			}
+
+			if err := tagCommand.tagPath(store, path, tagIds); err != nil {
+				return err
+			}
+		}
+	}
+
+	if command.recursive && stat.IsDir() {
+		osFile, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not open path: %v", path, err)
+		}
+
+		childNames, err := osFile.Readdirnames(0)
+		osFile.Close()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve directory contents: %v", path, err)
+		}
+
+		for _, childName := range childNames {
+			if err := command.autotagPath(store, filepath.Join(path, childName)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Loads the auto-tagging rules from the specified file or, if none is
+// specified, from the configured rules file.
+func loadRules(rulesPath string) (autotag.Rules, error) {
+	if rulesPath == "" {
+		var err error
+		rulesPath, err = common.GetRulesPath()
+		if err != nil {
+			return nil, fmt.Errorf("could not get rules file path: %v", err)
+		}
+	}
+
+	rules, err := autotag.LoadRules(rulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load auto-tagging rules: %v", err)
+	}
+
+	return rules, nil
+}
+
+func containsString(items []string, searchItem string) bool {
+	for _, item := range items {
+		if item == searchItem {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"os"
+	"testing"
+	"tmsu/cli"
+	"tmsu/storage"
+)
+
+func TestAutotagRecursive(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	rulesPath, err := configureRules("# music\nunder:/tmp/tmsu-autotag/music ext:flac -> music audio lossless\nname:*.mp3 -> music audio\n")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(rulesPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu-autotag/music/a.flac", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-autotag/music/b.mp3", "b"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-autotag/c.flac", "c"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-autotag")
+
+	command := AutotagCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--recursive", "-r", "", false, ""}}, []string{"/tmp/tmsu-autotag"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 2 {
+		test.Fatalf("Expected two files but are %v.", len(files))
+	}
+
+	music, _ := store.TagByName("music")
+	audio, _ := store.TagByName("audio")
+	lossless, _ := store.TagByName("lossless")
+	if music == nil || audio == nil || lossless == nil {
+		test.Fatal("Expected tags were not created.")
+	}
+
+	expectTags(test, store, files[0], music, audio, lossless)
+	expectTags(test, store, files[1], music, audio)
+}
+
+func TestTagAppliesAutotagRules(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	rulesPath, err := configureRules("ext:flac -> lossless\n")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(rulesPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu-autotag/a.flac", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-autotag/b.flac", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-autotag")
+
+	tagCommand := TagCommand{}
+
+	// test
+
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-autotag/a.flac", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options := cli.Options{cli.Option{"--no-autotag", "-n", "", false, ""}}
+	if err := tagCommand.Exec(options, []string{"/tmp/tmsu-autotag/b.flac", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	apple, _ := store.TagByName("apple")
+	lossless, _ := store.TagByName("lossless")
+	if apple == nil || lossless == nil {
+		test.Fatal("Expected tags were not created.")
+	}
+
+	a, _ := store.FileByPath("/tmp/tmsu-autotag/a.flac")
+	b, _ := store.FileByPath("/tmp/tmsu-autotag/b.flac")
+	if a == nil || b == nil {
+		test.Fatal("Expected files were not added.")
+	}
+
+	expectTags(test, store, a, apple, lossless)
+	expectTags(test, store, b, apple)
+}
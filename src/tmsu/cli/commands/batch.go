@@ -0,0 +1,227 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+type BatchCommand struct {
+	Commands        map[cli.CommandName]cli.Command
+	Parser          *cli.Parser
+	verbose         bool
+	continueOnError bool
+	null            bool
+}
+
+func (BatchCommand) Name() cli.CommandName {
+	return "batch"
+}
+
+func (BatchCommand) Synopsis() string {
+	return "Run commands read from standard input"
+}
+
+func (BatchCommand) Description() string {
+	return `tmsu batch [OPTION]...
+
+Runs the tmsu commands read from standard input, one per line and without the
+leading 'tmsu', within a single transaction. This is much quicker than running
+tmsu for each command.
+
+    $ tmsu batch <<EOF
+    tag song.mp3 music rock
+    tag "other song.mp3" music jazz
+    untag song.mp3 rock
+    EOF
+
+Words containing spaces can be quoted or the spaces escaped with a backslash.
+Blank lines and lines beginning with '#' are ignored. The commands cannot read
+files from standard input.
+
+With --null the input is instead read as NUL-delimited pairs of a path and its
+space-separated tags, the path being tagged as by 'tmsu tag':
+
+    $ find -name '*.mp3' -printf '%p\0music mp3\0' | tmsu batch --null
+
+Errors are reported along with the number of the line, or pair, responsible.
+Should any command fail no changes are made unless --continue-on-error is
+specified, in which case only the changes of the failed commands are
+abandoned.
+
+The changes made by the batch are undone together by 'tmsu undo'.`
+}
+
+func (BatchCommand) Options() cli.Options {
+	return cli.Options{{"--continue-on-error", "-c", "keep the changes of the successful commands should others fail", false, ""},
+		{"--null", "-0", "read NUL-delimited pairs of paths and tags", false, ""}}
+}
+
+func (command BatchCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+	command.continueOnError = options.HasOption("--continue-on-error")
+	command.null = options.HasOption("--null")
+
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+
+	store.ShareSession()
+
+	count, failures, err := command.runCommands(store, bufio.NewReader(os.Stdin))
+	if err != nil {
+		store.Rollback()
+		return err
+	}
+
+	if command.verbose {
+		log.Infof("committing the changes of %v command(s).", count-failures)
+	}
+
+	if err := store.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%v of %v commands failed.", failures, count)
+	}
+
+	return nil
+}
+
+// unexported
+
+// The name of the savepoint marking the start of each command's changes.
+const batchSavepoint = "batch_command"
+
+// Runs the commands read, returning the number run and the number that
+// failed. An error is returned if the batch is to be abandoned.
+func (command BatchCommand) runCommands(store *storage.Storage, reader *bufio.Reader) (int, int, error) {
+	count, failures := 0, 0
+
+	for number := 1; ; number++ {
+		words, err := command.readCommand(reader)
+		if err == io.EOF {
+			return count, failures, nil
+		}
+		if err == nil && len(words) == 0 {
+			continue
+		}
+
+		count++
+
+		if err == nil {
+			if err = store.Savepoint(batchSavepoint); err != nil {
+				return count, failures, fmt.Errorf("could not create savepoint: %v", err)
+			}
+
+			err = runCommandLine(command.Commands, command.Parser, words, command.verbose)
+
+			if err != nil {
+				if err := store.RollbackToSavepoint(batchSavepoint); err != nil {
+					return count, failures, fmt.Errorf("could not roll back changes: %v", err)
+				}
+			} else {
+				if err := store.ReleaseSavepoint(batchSavepoint); err != nil {
+					return count, failures, fmt.Errorf("could not release savepoint: %v", err)
+				}
+			}
+		}
+
+		if err != nil {
+			failures++
+			log.Warnf("%v %v: %v", command.unit(), number, err)
+
+			if !command.continueOnError {
+				return count, failures, fmt.Errorf("batch abandoned: no changes were made.")
+			}
+		}
+	}
+}
+
+// Reads the next command, returning no words for a line to be skipped and
+// io.EOF at the end of the input.
+func (command BatchCommand) readCommand(reader *bufio.Reader) ([]string, error) {
+	if command.null {
+		path, err := readField(reader, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		tags, err := readField(reader, 0)
+		if err == io.EOF {
+			return nil, fmt.Errorf("'%v': tags must be specified.", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]string{"tag", "--", path}, strings.Fields(tags)...), nil
+	}
+
+	line, err := readField(reader, '\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+
+	return cli.SplitCommandLine(line)
+}
+
+func (command BatchCommand) unit() string {
+	if command.null {
+		return "pair"
+	}
+
+	return "line"
+}
+
+// Reads up to and excluding the delimiter, returning io.EOF only if there is
+// nothing left to read.
+func readField(reader *bufio.Reader, delimiter byte) (string, error) {
+	field, err := reader.ReadString(delimiter)
+	if err == io.EOF && field != "" {
+		return field, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return field[:len(field)-1], nil
+}
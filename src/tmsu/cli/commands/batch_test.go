@@ -0,0 +1,183 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"os"
+	"testing"
+	"tmsu/cli"
+)
+
+func TestBatch(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b c", "b c"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b c")
+
+	commands := map[cli.CommandName]cli.Command{
+		"tag":   TagCommand{},
+		"untag": UntagCommand{},
+	}
+	command := BatchCommand{Commands: commands, Parser: cli.NewParser(cli.Options{}, commands)}
+
+	// test
+
+	if err := runBatch(command, cli.Options{}, "tag /tmp/tmsu/a apple banana\n# comment\n\ntag '/tmp/tmsu/b c' cherry\nuntag /tmp/tmsu/a banana\n"); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple")
+	expectPathTags(test, "/tmp/tmsu/b c", "cherry")
+
+	// test
+
+	if err := runBatch(command, cli.Options{}, "tag /tmp/tmsu/a date\nbogus\ntag /tmp/tmsu/a elderberry\n"); err == nil {
+		test.Fatal("Expected batch to fail.")
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple")
+
+	// test
+
+	options := cli.Options{cli.Option{"--continue-on-error", "-c", "", false, ""}}
+	if err := runBatch(command, options, "tag /tmp/tmsu/a date\ntag /tmp/tmsu/missing fig\ntag /tmp/tmsu/a elderberry\n"); err == nil {
+		test.Fatal("Expected batch to report the failed command.")
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "date", "elderberry")
+
+	// test
+
+	options = cli.Options{cli.Option{"--null", "-0", "", false, ""}}
+	if err := runBatch(command, options, "/tmp/tmsu/b c\x00grape honeydew\x00/tmp/tmsu/a\x00grape\x00"); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "date", "elderberry", "grape")
+	expectPathTags(test, "/tmp/tmsu/b c", "cherry", "grape", "honeydew")
+}
+
+func TestBatchContinuesAfterUnknownTag(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	commands := map[cli.CommandName]cli.Command{
+		"files": FilesCommand{},
+		"tag":   TagCommand{},
+	}
+	command := BatchCommand{Commands: commands, Parser: cli.NewParser(cli.Options{}, commands)}
+
+	// test
+
+	options := cli.Options{cli.Option{"--continue-on-error", "-c", "", false, ""}}
+	if err := runBatch(command, options, "tag /tmp/tmsu/b y\nfiles nosuch\ntag /tmp/tmsu/b z\n"); err == nil {
+		test.Fatal("Expected batch to report the failed command.")
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/b", "y", "z")
+}
+
+func TestBatchRefusesStandardInputOptions(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	commands := map[cli.CommandName]cli.Command{"tag": TagCommand{}}
+	command := BatchCommand{Commands: commands, Parser: cli.NewParser(cli.Options{}, commands)}
+
+	// test
+
+	options := cli.Options{cli.Option{"--continue-on-error", "-c", "", false, ""}}
+	if err := runBatch(command, options, "tag --from-stdin x\ntag --null x\ntag /tmp/tmsu/b y\n"); err == nil {
+		test.Fatal("Expected batch to report the refused commands.")
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/b", "y")
+}
+
+// unexported
+
+func runBatch(command BatchCommand, options cli.Options, input string) error {
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	inPath, err := configureInput(input)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(inPath)
+	defer os.Stdin.Close()
+
+	return command.Exec(options, []string{})
+}
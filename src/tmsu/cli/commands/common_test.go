@@ -29,13 +29,44 @@ func configureOutput() (string, string, error) {
 	return outPath, errPath, nil
 }
 
+func configureInput(input string) (string, error) {
+	inPath := filepath.Join(os.TempDir(), "tmsu_test.in")
+	inFile, err := os.Create(inPath)
+	if err != nil {
+		return "", fmt.Errorf("could not create input file '%v': %v", inPath, err)
+	}
+
+	if _, err := inFile.WriteString(input); err != nil {
+		return "", fmt.Errorf("could not write input file '%v': %v", inPath, err)
+	}
+	inFile.Seek(0, 0)
+
+	os.Stdin = inFile
+
+	return inPath, nil
+}
+
 func configureDatabase() string {
 	databasePath := filepath.Join(os.TempDir(), "tmsu_test.db")
 	os.Setenv("TMSU_DB", databasePath)
 
+	// ensure the user's own auto-tagging rules are not applied
+	os.Setenv("TMSU_RULES", filepath.Join(os.TempDir(), "tmsu_test.rules"))
+
 	return databasePath
 }
 
+func configureRules(rules string) (string, error) {
+	rulesPath := filepath.Join(os.TempDir(), "tmsu_test.rules")
+	os.Setenv("TMSU_RULES", rulesPath)
+
+	if err := createFile(rulesPath, rules); err != nil {
+		return "", fmt.Errorf("could not create rules file '%v': %v", rulesPath, err)
+	}
+
+	return rulesPath, nil
+}
+
 func compareOutput(test *testing.T, expected, actual string) {
 	if actual != expected {
 		test.Fatal("Output was not as expected.\nExpected: " + strings.Replace(expected, "\n", "\\n", -1) + "\nActual: " + strings.Replace(actual, "\n", "\\n", -1))
@@ -77,3 +108,13 @@ func createFile(path string, contents string) error {
 
 	return nil
 }
+
+func addTags(store *storage.Storage, tagNames ...string) error {
+	for _, tagName := range tagNames {
+		if _, err := store.AddTag(tagName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
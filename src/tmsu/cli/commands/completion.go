@@ -0,0 +1,710 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"tmsu/cli"
+	"tmsu/log"
+)
+
+type CompletionCommand struct {
+	Commands      map[cli.CommandName]cli.Command
+	GlobalOptions cli.Options
+}
+
+func (CompletionCommand) Name() cli.CommandName {
+	return "completion"
+}
+
+func (CompletionCommand) Synopsis() string {
+	return "Generate a shell completion script"
+}
+
+func (CompletionCommand) Description() string {
+	return `tmsu completion bash|zsh|fish
+
+Outputs a completion script for the specified shell. The script is generated
+from the commands and their options, so is always in step with the version of
+tmsu installed. Tag names are completed by calling 'tmsu tags --all'.
+
+    $ source <(tmsu completion bash)
+    $ tmsu completion zsh >~/.zsh/functions/_tmsu
+    $ tmsu completion fish >~/.config/fish/completions/tmsu.fish
+
+The arguments of each command are completed according to the first line of
+its help, e.g. 'tmsu tag [OPTION]... FILE TAG...' completes a file and then
+tags, and the arguments of its options as declared by the command.`
+}
+
+func (CompletionCommand) Options() cli.Options {
+	return cli.Options{}
+}
+
+func (command CompletionCommand) Exec(options cli.Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("shell must be specified.")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = command.bashScript()
+	case "zsh":
+		script = command.zshScript()
+	case "fish":
+		script = command.fishScript()
+	default:
+		return fmt.Errorf("unsupported shell '%v': must be one of bash, zsh or fish.", args[0])
+	}
+
+	log.Print(strings.TrimRight(script, "\n"))
+
+	return nil
+}
+
+// unexported
+
+// The completion of an argument: the tags, files, commands and literal
+// values it may be.
+type argumentCompletion struct {
+	name     string
+	tags     bool
+	files    bool
+	commands bool
+	values   []string
+}
+
+// The completions of a command's arguments by position. If repeated, the last
+// completion also applies to any subsequent arguments.
+type argumentCompletions struct {
+	positions []argumentCompletion
+	repeated  bool
+}
+
+// Determines the completion of an argument from its name in the command's
+// synopsis, e.g. 'TAG', 'FILE|TAG' or 'bash|zsh|fish'.
+func newArgumentCompletion(word string) argumentCompletion {
+	completion := argumentCompletion{name: strings.ToLower(strings.Replace(word, "|", " or ", -1))}
+
+	for _, part := range strings.Split(word, "|") {
+		switch {
+		case part != strings.ToUpper(part):
+			completion.values = append(completion.values, part)
+		case strings.Contains(part, "TAG"):
+			completion.tags = true
+		case part == "COMMAND":
+			completion.commands = true
+		case strings.Contains(part, "FILE"), strings.Contains(part, "PATH"), strings.Contains(part, "DIR"), part == "MOUNTPOINT":
+			completion.files = true
+		}
+	}
+
+	if completion.values != nil {
+		completion.name = "value"
+	}
+
+	return completion
+}
+
+// Determines the completion of an option's argument from the completions
+// declared by the command, if any.
+func newOptionCompletion(command cli.Command, option cli.Option) argumentCompletion {
+	completion := argumentCompletion{name: strings.TrimLeft(option.LongName, "-")}
+
+	if completer, ok := command.(cli.OptionCompleter); ok {
+		declared := completer.OptionCompletions()[option.LongName]
+
+		completion.tags = declared.Tags
+		completion.files = declared.Files
+		completion.commands = declared.Commands
+		completion.values = declared.Values
+	}
+
+	return completion
+}
+
+// Determines the completions of the command's arguments from the longest of
+// the synopsis lines, at the start of its description, that use no options.
+func commandArguments(command cli.Command) argumentCompletions {
+	var synopsis []string
+
+	for _, line := range strings.Split(command.Description(), "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 || words[0] != "tmsu" {
+			break
+		}
+
+		words = wordsAfter(words, string(command.Name()))
+		if words == nil {
+			continue
+		}
+
+		arguments, ok := synopsisArguments(words)
+		if ok && len(arguments) > len(synopsis) {
+			synopsis = arguments
+		}
+	}
+
+	var arguments argumentCompletions
+	for _, word := range synopsis {
+		repeated := strings.HasSuffix(word, "...")
+		optional := strings.HasPrefix(word, "[")
+		word = strings.Trim(word, `[]."`)
+
+		// optional keywords, such as imply's 'and', are not completed
+		if optional && !strings.Contains(word, "|") && strings.ToLower(word) == word {
+			continue
+		}
+
+		arguments.positions = append(arguments.positions, newArgumentCompletion(word))
+
+		if repeated {
+			arguments.repeated = true
+			break
+		}
+	}
+
+	return arguments
+}
+
+func wordsAfter(words []string, word string) []string {
+	for index, candidate := range words {
+		if candidate == word {
+			return words[index+1:]
+		}
+	}
+
+	return nil
+}
+
+// Removes the '[OPTION]...' placeholders from the synopsis words, returning
+// false should the synopsis use a particular option.
+func synopsisArguments(words []string) ([]string, bool) {
+	arguments := make([]string, 0, len(words))
+
+	for _, word := range words {
+		switch {
+		case strings.Contains(word, "OPTION"):
+			continue
+		case strings.HasPrefix(strings.TrimLeft(word, "["), "-"):
+			return nil, false
+		}
+
+		arguments = append(arguments, word)
+	}
+
+	return arguments, true
+}
+
+// The commands to complete, in name order, omitting internal commands.
+func (command CompletionCommand) commands() []cli.Command {
+	commandNames := make(cli.CommandNames, 0, len(command.Commands))
+	for commandName, subcommand := range command.Commands {
+		if subcommand.Synopsis() != "" {
+			commandNames = append(commandNames, commandName)
+		}
+	}
+
+	sort.Sort(commandNames)
+
+	commands := make([]cli.Command, len(commandNames))
+	for index, commandName := range commandNames {
+		commands[index] = command.Commands[commandName]
+	}
+
+	return commands
+}
+
+func (command CompletionCommand) commandNames() string {
+	names := make([]string, 0, len(command.Commands))
+	for _, subcommand := range command.commands() {
+		names = append(names, string(subcommand.Name()))
+	}
+
+	return strings.Join(names, " ")
+}
+
+// bash
+
+const bashFunctions = `# bash completion for tmsu: generated by 'tmsu completion bash'
+
+_tmsu_tags() {
+	local IFS=$'\n'
+	COMPREPLY+=($(compgen -W "$(tmsu tags --all 2>/dev/null)" -- "$cur"))
+}
+
+_tmsu_files() {
+	local IFS=$'\n'
+	compopt -o filenames 2>/dev/null
+	COMPREPLY+=($(compgen -f -- "$cur"))
+}
+
+_tmsu_values() {
+	COMPREPLY+=($(compgen -W "$*" -- "$cur"))
+}
+
+_tmsu() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	local command= position=0 completer= word index
+	COMPREPLY=()
+
+	for (( index = 1; index < COMP_CWORD; index++ ))
+	do
+		word=${COMP_WORDS[index]}
+
+		if [[ -n $completer ]]
+		then
+			completer=
+		elif [[ $word == -* ]]
+		then
+			[[ $word == *=* ]] || completer=$(_tmsu_option_completer "$command" "$word")
+		elif [[ -z $command ]]
+		then
+			command=$word
+		else
+			(( position++ ))
+		fi
+	done
+
+	if [[ -n $completer ]]
+	then
+		$completer
+	elif [[ $cur == -* ]]
+	then
+		_tmsu_values $(_tmsu_options "$command")
+	elif [[ -z $command ]]
+	then
+		_tmsu_commands
+	else
+		_tmsu_arguments "$command" "$position"
+	fi
+}
+`
+
+func (command CompletionCommand) bashScript() string {
+	var script bytes.Buffer
+
+	script.WriteString(bashFunctions)
+
+	fmt.Fprintf(&script, "\n_tmsu_commands() {\n\t_tmsu_values %v\n}\n", command.commandNames())
+
+	script.WriteString("\n_tmsu_options() {\n")
+	fmt.Fprintf(&script, "\techo %v\n\n\tcase \"$1\" in\n", longNames(command.GlobalOptions))
+	for _, subcommand := range command.commands() {
+		if len(subcommand.Options()) > 0 {
+			fmt.Fprintf(&script, "\t\t(%v) echo %v ;;\n", subcommand.Name(), longNames(subcommand.Options()))
+		}
+	}
+	script.WriteString("\tesac\n}\n")
+
+	// outputs the function completing the option's argument, if it has one
+	script.WriteString("\n_tmsu_option_completer() {\n\tcase \"$1 $2\" in\n")
+	for _, option := range command.GlobalOptions {
+		if option.HasArgument {
+			fmt.Fprintf(&script, "\t\t(%v) echo %v ;;\n", bashOptionPatterns("*", option), bashCompletion(newOptionCompletion(nil, option)))
+		}
+	}
+	for _, subcommand := range command.commands() {
+		for _, option := range subcommand.Options() {
+			if option.HasArgument {
+				fmt.Fprintf(&script, "\t\t(%v) echo %v ;;\n", bashOptionPatterns(string(subcommand.Name()), option), bashCompletion(newOptionCompletion(subcommand, option)))
+			}
+		}
+	}
+	script.WriteString("\t\t(*) return 1 ;;\n\tesac\n}\n")
+
+	script.WriteString("\n_tmsu_arguments() {\n\tcase \"$1\" in\n")
+	for _, subcommand := range command.commands() {
+		arguments := commandArguments(subcommand)
+		if len(arguments.positions) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&script, "\t\t(%v)\n\t\t\tcase \"$2\" in\n", subcommand.Name())
+		for index, completion := range arguments.positions {
+			position := strconv.Itoa(index)
+			if arguments.repeated && index == len(arguments.positions)-1 {
+				position = "*"
+			}
+
+			fmt.Fprintf(&script, "\t\t\t\t(%v) %v ;;\n", position, bashCompletion(completion))
+		}
+		script.WriteString("\t\t\tesac\n\t\t;;\n")
+	}
+	script.WriteString("\tesac\n}\n")
+
+	script.WriteString("\ncomplete -F _tmsu tmsu\n")
+
+	return script.String()
+}
+
+func bashOptionPatterns(commandPattern string, option cli.Option) string {
+	patterns := []string{commandPattern + `" ` + option.LongName + `"`}
+	if option.ShortName != "" {
+		patterns = append(patterns, commandPattern+`" `+option.ShortName+`"`)
+	}
+
+	return strings.Join(patterns, "|")
+}
+
+// The commands completing the argument: a no-op for arguments not completed.
+// (An option's argument is completed by a single command.)
+func bashCompletion(completion argumentCompletion) string {
+	commands := make([]string, 0, 4)
+
+	if completion.tags {
+		commands = append(commands, "_tmsu_tags")
+	}
+	if completion.files {
+		commands = append(commands, "_tmsu_files")
+	}
+	if completion.commands {
+		commands = append(commands, "_tmsu_commands")
+	}
+	if completion.values != nil {
+		commands = append(commands, "_tmsu_values "+strings.Join(completion.values, " "))
+	}
+
+	if len(commands) == 0 {
+		return ":"
+	}
+
+	return strings.Join(commands, "; ")
+}
+
+func longNames(options cli.Options) string {
+	names := make([]string, len(options))
+	for index, option := range options {
+		names[index] = option.LongName
+	}
+
+	return strings.Join(names, " ")
+}
+
+// zsh
+
+const zshFunctions = `#compdef tmsu
+# zsh completion for tmsu: generated by 'tmsu completion zsh'
+
+_tmsu() {
+	local curcontext="$curcontext" state line ret=1
+	typeset -A opt_args
+
+	_arguments -C -s -w \
+		$_tmsu_global_options \
+		'1: :_tmsu_commands' \
+		'*:: :->args' \
+	&& ret=0
+
+	case $state in
+		(args)
+			curcontext="${curcontext%:*:*}:tmsu-$words[1]:"
+			if (( $+functions[_tmsu_cmd_$words[1]] ))
+			then
+				_tmsu_cmd_$words[1] && ret=0
+			fi
+		;;
+	esac
+
+	return ret
+}
+
+_tmsu_tags() {
+	local -a tags expl
+	tags=(${(f)"$(_call_program tags tmsu tags --all 2>/dev/null)"})
+	_wanted tags expl 'tag' compadd -a tags
+}
+`
+
+func (command CompletionCommand) zshScript() string {
+	var script bytes.Buffer
+
+	script.WriteString(zshFunctions)
+
+	script.WriteString("\n_tmsu_commands() {\n\tlocal -a commands\n\tcommands=(\n")
+	for _, subcommand := range command.commands() {
+		fmt.Fprintf(&script, "\t\t%v\n", zshQuote(string(subcommand.Name())+":"+subcommand.Synopsis()))
+	}
+	script.WriteString("\t)\n\t_describe -t commands 'command' commands \"$@\"\n}\n")
+
+	script.WriteString("\n_tmsu_global_options=(\n")
+	for _, option := range command.GlobalOptions {
+		fmt.Fprintf(&script, "\t%v\n", zshOptionSpec(nil, option))
+	}
+	script.WriteString(")\n")
+
+	for _, subcommand := range command.commands() {
+		fmt.Fprintf(&script, "\n_tmsu_cmd_%v() {\n\t_arguments -s -w \\\n\t\t$_tmsu_global_options \\\n", subcommand.Name())
+
+		for _, option := range subcommand.Options() {
+			fmt.Fprintf(&script, "\t\t%v \\\n", zshOptionSpec(subcommand, option))
+		}
+
+		arguments := commandArguments(subcommand)
+		for index, completion := range arguments.positions {
+			position := strconv.Itoa(index + 1)
+			if arguments.repeated && index == len(arguments.positions)-1 {
+				position = "*"
+			}
+
+			fmt.Fprintf(&script, "\t\t%v \\\n", zshQuote(position+":"+completion.name+":"+zshAction(completion)))
+		}
+
+		script.WriteString("\t&& return 0\n}\n")
+	}
+
+	script.WriteString("\n_tmsu \"$@\"\n")
+
+	return script.String()
+}
+
+func zshOptionSpec(command cli.Command, option cli.Option) string {
+	description := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(option.Description)
+
+	argument := ""
+	if option.HasArgument {
+		completion := newOptionCompletion(command, option)
+		argument = ":" + completion.name + ":" + zshAction(completion)
+	}
+
+	if option.ShortName == "" {
+		return zshQuote(option.LongName + suffix(option, "=") + "[" + description + "]" + argument)
+	}
+
+	return "{" + option.LongName + suffix(option, "=") + "," + option.ShortName + suffix(option, "+") + "}" +
+		zshQuote("["+description+"]"+argument)
+}
+
+func suffix(option cli.Option, suffix string) string {
+	if option.HasArgument {
+		return suffix
+	}
+
+	return ""
+}
+
+// The action completing the argument, combining alternatives with
+// _alternative.
+func zshAction(completion argumentCompletion) string {
+	alternatives := make([]string, 0, 4)
+	actions := make([]string, 0, 4)
+
+	if completion.tags {
+		alternatives = append(alternatives, "tags:tag")
+		actions = append(actions, "_tmsu_tags")
+	}
+	if completion.files {
+		alternatives = append(alternatives, "files:file")
+		actions = append(actions, "_files")
+	}
+	if completion.commands {
+		alternatives = append(alternatives, "commands:command")
+		actions = append(actions, "_tmsu_commands")
+	}
+	if completion.values != nil {
+		alternatives = append(alternatives, "values:value")
+		actions = append(actions, "("+strings.Join(completion.values, " ")+")")
+	}
+
+	switch len(actions) {
+	case 0:
+		return ""
+	case 1:
+		return actions[0]
+	}
+
+	for index, action := range actions {
+		alternatives[index] = zshQuote(alternatives[index] + ":" + action)
+	}
+
+	return "_alternative " + strings.Join(alternatives, " ")
+}
+
+func zshQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+// fish
+
+const fishFunctions = `# fish completion for tmsu: generated by 'tmsu completion fish'
+
+function __tmsu_tags
+	tmsu tags --all 2>/dev/null
+end
+
+# outputs the argument position, whether the next word is an option's argument
+# and the command of the command line being completed
+function __tmsu_state
+	set -l words (commandline -opc)
+	set -e words[1]
+
+	set -l command
+	set -l position 0
+	set -l skip 0
+
+	for word in $words
+		if test $skip -eq 1
+			set skip 0
+		else if string match -q -- '-*' $word
+			if not string match -q -- '*=*' $word; and __tmsu_option_has_argument "$command" $word
+				set skip 1
+			end
+		else if test -z "$command"
+			set command $word
+		else
+			set position (math $position + 1)
+		end
+	end
+
+	echo $position
+	echo $skip
+	echo $command
+end
+
+function __tmsu_needs_command
+	set -l state (__tmsu_state)
+	test $state[2] -eq 0 -a -z "$state[3]"
+end
+
+function __tmsu_using_command --argument-names command
+	set -l state (__tmsu_state)
+	test "$state[3]" = $command
+end
+
+function __tmsu_at_argument --argument-names command first last
+	set -l state (__tmsu_state)
+	test "$state[3]" = $command -a $state[2] -eq 0 -a $state[1] -ge $first; or return 1
+	test -z "$last"; or test $state[1] -le $last
+end
+
+complete -c tmsu -f
+`
+
+func (command CompletionCommand) fishScript() string {
+	var script bytes.Buffer
+
+	script.WriteString(fishFunctions)
+
+	fmt.Fprintf(&script, "\nfunction __tmsu_commands\n\tprintf '%%s\\n' %v\nend\n", command.commandNames())
+	script.WriteString("\nfunction __tmsu_option_has_argument --argument-names command option\n\tswitch \"$command $option\"\n")
+	patterns := make([]string, 0, 10)
+	for _, option := range command.GlobalOptions {
+		if option.HasArgument {
+			patterns = append(patterns, fishOptionPatterns("*", option)...)
+		}
+	}
+	for _, subcommand := range command.commands() {
+		for _, option := range subcommand.Options() {
+			if option.HasArgument {
+				patterns = append(patterns, fishOptionPatterns(string(subcommand.Name()), option)...)
+			}
+		}
+	}
+	if len(patterns) > 0 {
+		fmt.Fprintf(&script, "\t\tcase %v\n\t\t\treturn 0\n", strings.Join(patterns, " "))
+	}
+	script.WriteString("\tend\n\n\treturn 1\nend\n\n")
+
+	for _, option := range command.GlobalOptions {
+		fmt.Fprintf(&script, "complete -c tmsu%v\n", fishOption(nil, option))
+	}
+
+	for _, subcommand := range command.commands() {
+		fmt.Fprintf(&script, "complete -c tmsu -n __tmsu_needs_command -a %v -d %v\n", subcommand.Name(), fishQuote(subcommand.Synopsis()))
+	}
+
+	for _, subcommand := range command.commands() {
+		condition := fishQuote("__tmsu_using_command " + string(subcommand.Name()))
+
+		for _, option := range subcommand.Options() {
+			fmt.Fprintf(&script, "complete -c tmsu -n %v%v\n", condition, fishOption(subcommand, option))
+		}
+
+		arguments := commandArguments(subcommand)
+		for index, completion := range arguments.positions {
+			positions := strconv.Itoa(index)
+			if !arguments.repeated || index < len(arguments.positions)-1 {
+				positions += " " + positions
+			}
+
+			condition := fishQuote("__tmsu_at_argument " + string(subcommand.Name()) + " " + positions)
+			if completion := fishCompletion(completion); completion != "" {
+				fmt.Fprintf(&script, "complete -c tmsu -n %v%v\n", condition, completion)
+			}
+		}
+	}
+
+	return script.String()
+}
+
+func fishOptionPatterns(commandPattern string, option cli.Option) []string {
+	patterns := []string{fishQuote(commandPattern + " " + option.LongName)}
+	if option.ShortName != "" {
+		patterns = append(patterns, fishQuote(commandPattern+" "+option.ShortName))
+	}
+
+	return patterns
+}
+
+func fishOption(command cli.Command, option cli.Option) string {
+	arguments := " -l " + strings.TrimLeft(option.LongName, "-")
+	if option.ShortName != "" {
+		arguments += " -s " + strings.TrimLeft(option.ShortName, "-")
+	}
+
+	if option.HasArgument {
+		arguments += " -r" + fishCompletion(newOptionCompletion(command, option))
+	}
+
+	return arguments + " -d " + fishQuote(option.Description)
+}
+
+// The arguments of 'complete' completing the argument.
+func fishCompletion(completion argumentCompletion) string {
+	candidates := make([]string, 0, 10)
+
+	if completion.tags {
+		candidates = append(candidates, "(__tmsu_tags)")
+	}
+	if completion.commands {
+		candidates = append(candidates, "(__tmsu_commands)")
+	}
+	candidates = append(candidates, completion.values...)
+
+	arguments := ""
+	if completion.files {
+		arguments += " -F"
+	}
+	if len(candidates) > 0 {
+		arguments += " -a " + fishQuote(strings.Join(candidates, " "))
+	}
+
+	return arguments
+}
+
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text) + "'"
+}
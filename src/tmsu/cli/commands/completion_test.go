@@ -0,0 +1,159 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/cli"
+	"tmsu/log"
+)
+
+func TestCompletionArguments(test *testing.T) {
+	// test
+
+	tagArguments := commandArguments(TagCommand{})
+	logArguments := commandArguments(LogCommand{})
+	implyArguments := commandArguments(ImplyCommand{})
+	completionArguments := commandArguments(CompletionCommand{})
+
+	// validate
+
+	if len(tagArguments.positions) != 2 || !tagArguments.positions[0].files || !tagArguments.positions[1].tags || !tagArguments.repeated {
+		test.Fatalf("Expected a file followed by tags but were: %+v", tagArguments)
+	}
+
+	if len(logArguments.positions) != 1 || !logArguments.positions[0].files || !logArguments.positions[0].tags || logArguments.repeated {
+		test.Fatalf("Expected a file or tag but were: %+v", logArguments)
+	}
+
+	if len(implyArguments.positions) != 2 || !implyArguments.positions[0].tags || !implyArguments.positions[1].tags || !implyArguments.repeated {
+		test.Fatalf("Expected tags but were: %+v", implyArguments)
+	}
+
+	if len(completionArguments.positions) != 1 || strings.Join(completionArguments.positions[0].values, " ") != "bash zsh fish" {
+		test.Fatalf("Expected the shells but were: %+v", completionArguments)
+	}
+}
+
+func TestCompletionOptionArgumentsDeclared(test *testing.T) {
+	// set-up
+
+	commands := []cli.Command{AutotagCommand{}, BatchCommand{}, CompletionCommand{}, CopyCommand{},
+		DeleteCommand{}, DupesCommand{}, FilesCommand{}, GroupCommand{}, HelpCommand{}, HistoryCommand{},
+		ImplyCommand{}, LogCommand{}, MergeCommand{}, MountCommand{}, RedoCommand{}, RenameCommand{},
+		RepairCommand{}, ServeCommand{}, ShellCommand{}, StatsCommand{}, StatusCommand{}, TagCommand{},
+		TagsCommand{}, UndoCommand{}, UnmountCommand{}, UntagCommand{}, VersionCommand{}, WatchCommand{},
+		WebCommand{}, VfsCommand{}}
+
+	// test & validate
+
+	for _, command := range commands {
+		var completions map[string]cli.Completion
+		if completer, ok := command.(cli.OptionCompleter); ok {
+			completions = completer.OptionCompletions()
+		}
+
+		for _, option := range command.Options() {
+			if _, declared := completions[option.LongName]; declared != option.HasArgument {
+				test.Fatalf("%v %v: expected completion to be declared only if the option takes an argument.", command.Name(), option.LongName)
+			}
+		}
+
+		for longName := range completions {
+			if option := command.Options().Get(longName); option == nil || !option.HasArgument {
+				test.Fatalf("%v %v: completion declared for unknown option.", command.Name(), longName)
+			}
+		}
+	}
+
+	completion := newOptionCompletion(DupesCommand{}, *DupesCommand{}.Options().Get("--keep"))
+	if strings.Join(completion.values, " ") != "oldest newest shortest" {
+		test.Fatalf("Expected the rules but were: %+v", completion)
+	}
+}
+
+func TestCompletionBash(test *testing.T) {
+	// set-up
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	commands := map[cli.CommandName]cli.Command{
+		"dupes": DupesCommand{},
+		"tag":   TagCommand{},
+		"vfs":   VfsCommand{},
+	}
+	command := CompletionCommand{Commands: commands, GlobalOptions: cli.Options{cli.Option{"--verbose", "-v", "show verbose messages", false, ""}}}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"bash"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	script := string(bytes)
+
+	for _, expected := range []string{
+		"_tmsu_values dupes tag\n",
+		"echo --verbose\n",
+		"(tag) echo --tags --recursive",
+		`(tag" --tags"|tag" -t") echo _tmsu_tags ;;`,
+		`(dupes" --keep"|dupes" -k") echo _tmsu_values oldest newest shortest ;;`,
+		"(0) _tmsu_files ;;\n\t\t\t\t(*) _tmsu_tags ;;",
+		"complete -F _tmsu tmsu\n",
+	} {
+		if !strings.Contains(script, expected) {
+			test.Fatalf("Expected script to contain '%v' but was: %v", expected, script)
+		}
+	}
+
+	if strings.Contains(script, "vfs") {
+		test.Fatalf("Expected internal command to be omitted.")
+	}
+}
+
+func TestCompletionUnsupportedShell(test *testing.T) {
+	// set-up
+
+	command := CompletionCommand{}
+
+	// test
+
+	err := command.Exec(cli.Options{}, []string{"csh"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Expected unsupported shell to be rejected.")
+	}
+}
@@ -19,9 +19,11 @@ package commands
 
 import (
 	"fmt"
+	"sort"
 	"tmsu/cli"
 	"tmsu/log"
 	"tmsu/storage"
+	"tmsu/storage/database"
 )
 
 type DeleteCommand struct {
@@ -39,7 +41,8 @@ func (DeleteCommand) Synopsis() string {
 func (DeleteCommand) Description() string {
 	return `tmsu delete TAG...
 
-Permanently deletes the TAGs specified.`
+Permanently deletes the TAGs specified along with their descendant tags, e.g.
+deleting 'media' also deletes 'media/audio' and 'media/audio/podcast'.`
 }
 
 func (DeleteCommand) Options() cli.Options {
@@ -78,6 +81,28 @@ func (command DeleteCommand) deleteTag(store *storage.Storage, tagName string) e
 		return fmt.Errorf("no such tag '%v'.", tagName)
 	}
 
+	descendants, err := store.TagDescendants(tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve descendants of tag '%v': %v", tagName, err)
+	}
+
+	return store.InTransaction(func() error {
+		// descendants are deleted deepest first as a tag cannot be deleted
+		// whilst it has descendants
+		sort.Sort(sort.Reverse(descendants))
+		for _, descendant := range descendants {
+			if err := command.deleteSingleTag(store, descendant); err != nil {
+				return err
+			}
+		}
+
+		return command.deleteSingleTag(store, tag)
+	})
+}
+
+func (command DeleteCommand) deleteSingleTag(store *storage.Storage, tag *database.Tag) error {
+	tagName := tag.Name
+
 	if command.verbose {
 		log.Infof("finding files tagged '%v'.", tagName)
 	}
@@ -105,6 +130,15 @@ func (command DeleteCommand) deleteTag(store *storage.Storage, tagName string) e
 		return fmt.Errorf("could not remove tag implications involving tag '%v': %v", tagName, err)
 	}
 
+	if command.verbose {
+		log.Infof("removing tag '%v' from tag groups.", tagName)
+	}
+
+	err = store.RemoveTagGroupsForTagId(tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not remove tag '%v' from tag groups: %v", tagName, err)
+	}
+
 	if command.verbose {
 		log.Infof("deleting tag '%v'.", tagName)
 	}
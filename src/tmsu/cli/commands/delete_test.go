@@ -38,17 +38,17 @@ func TestDeleteSuccessful(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileF, err := store.AddFile("/tmp/f", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileF, err := store.AddFile("/tmp/f", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -145,3 +145,68 @@ func TestDeleteNonExistentTag(test *testing.T) {
 		test.Fatal("Non-existent from tag was not identified.")
 	}
 }
+
+func TestDeleteDescendants(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	podcastTag, err := store.AddTag("media/audio/podcast")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag("mediaeval"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, podcastTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	mediaTag, err := store.TagByName("media")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := store.DeleteTag(mediaTag.Id); err == nil {
+		test.Fatal("Tag with descendants was deleted by storage.")
+	}
+
+	command := DeleteCommand{false}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"media"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "mediaeval" {
+		test.Fatalf("Expected only tag 'mediaeval' to remain but there are %v tags.", len(tags))
+	}
+
+	file, err := store.File(fileA.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file != nil {
+		test.Fatal("File left untagged was not removed.")
+	}
+}
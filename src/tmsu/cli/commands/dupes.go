@@ -19,8 +19,12 @@ package commands
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"tmsu/cli"
+	"tmsu/common"
 	"tmsu/fingerprint"
 	"tmsu/log"
 	_path "tmsu/path"
@@ -29,7 +33,14 @@ import (
 )
 
 type DupesCommand struct {
-	verbose bool
+	verbose   bool
+	recursive bool
+	tag       bool
+	keep      string
+	prefer    string
+	delete    bool
+	hardlink  bool
+	pretend   bool
 }
 
 func (DupesCommand) Name() cli.CommandName {
@@ -41,27 +52,101 @@ func (DupesCommand) Synopsis() string {
 }
 
 func (DupesCommand) Description() string {
-	return `tmsu dupes [FILE]...
+	return `tmsu dupes [OPTION]... [FILE]...
+tmsu dupes [OPTION]... --recursive DIR...
 
 Identifies all files in the database that are exact duplicates of FILE. If no
-FILE is specified then identifies duplicates between files in the database.`
+FILE is specified then identifies duplicates between files in the database.
+
+With --recursive the directory trees under each DIR are scanned for duplicate
+files whether or not they are tagged: files are reported if they duplicate
+each other or a file in the database. Files are only fingerprinted if another
+file of the same size exists, so most files are never read. Empty files are
+ignored.
+
+Where no FILE is specified, actions can be applied to each set of duplicates:
+
+  --tag       applies the union of the set's tags to every file in the set.
+  --delete    deletes all but one file of the set, the tags of the deleted
+              files being applied to the file that is kept.
+  --hardlink  replaces all but one file of the set with hard links to the file
+              that is kept.
+
+The file that is kept is chosen according to the --keep rule, which is one of
+'oldest' (the default), 'newest' or 'shortest' (shortest path). Where --prefer
+is specified, files under that directory are chosen in favour of others.
+
+Use --pretend to see what would be done without making any changes.`
 }
 
 func (DupesCommand) Options() cli.Options {
-	return cli.Options{}
+	return cli.Options{{"--recursive", "-r", "scan the directory trees under each DIR, including untagged files", false, ""},
+		{"--tag", "-t", "apply the union of tags to each file in a set", false, ""},
+		{"--delete", "-d", "delete all but one file in each set", false, ""},
+		{"--hardlink", "-l", "replace all but one file in each set with hard links", false, ""},
+		{"--keep", "-k", "rule for choosing the file to keep: oldest, newest or shortest", true, ""},
+		{"--prefer", "-P", "prefer to keep files under the specified directory", true, ""},
+		{"--pretend", "-p", "do not make any changes", false, ""}}
+}
+
+func (DupesCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{
+		"--keep":   {Values: []string{"oldest", "newest", "shortest"}},
+		"--prefer": {Files: true}}
 }
 
 func (command DupesCommand) Exec(options cli.Options, args []string) error {
 	command.verbose = options.HasOption("--verbose")
+	command.recursive = options.HasOption("--recursive")
+	command.tag = options.HasOption("--tag")
+	command.delete = options.HasOption("--delete")
+	command.hardlink = options.HasOption("--hardlink")
+	command.pretend = options.HasOption("--pretend")
+
+	command.keep = "oldest"
+	if options.HasOption("--keep") {
+		command.keep = options.Get("--keep").Argument
+	}
 
-	switch len(args) {
-	case 0:
-		command.findDuplicatesInDb()
+	switch command.keep {
+	case "oldest", "newest", "shortest":
 	default:
-		return command.findDuplicatesOf(args)
+		return fmt.Errorf("invalid keep rule '%v': must be one of oldest, newest or shortest.", command.keep)
 	}
 
-	return nil
+	if options.HasOption("--prefer") {
+		prefer, err := filepath.Abs(options.Get("--prefer").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", options.Get("--prefer").Argument, err)
+		}
+
+		command.prefer = prefer
+	}
+
+	if command.delete && command.hardlink {
+		return fmt.Errorf("--delete and --hardlink cannot be used together.")
+	}
+
+	if (options.HasOption("--keep") || options.HasOption("--prefer")) && !command.delete && !command.hardlink {
+		return fmt.Errorf("--keep and --prefer can only be used with --delete or --hardlink.")
+	}
+
+	if len(args) > 0 && command.hasActions() {
+		return fmt.Errorf("actions can only be applied to duplicates within the database.")
+	}
+
+	switch {
+	case command.recursive:
+		if len(args) == 0 {
+			return fmt.Errorf("at least one directory to scan must be specified.")
+		}
+
+		return command.findDuplicatesUnder(args)
+	case len(args) == 0:
+		return command.findDuplicatesInDb()
+	default:
+		return command.findDuplicatesOf(args)
+	}
 }
 
 func (command DupesCommand) findDuplicatesInDb() error {
@@ -95,6 +180,12 @@ func (command DupesCommand) findDuplicatesInDb() error {
 			relPath := _path.Rel(file.Path())
 			log.Printf("  %v", relPath)
 		}
+
+		if command.hasActions() {
+			if err := command.applyActions(store, fileSet); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -158,3 +249,455 @@ func (command DupesCommand) findDuplicatesOf(paths []string) error {
 
 	return nil
 }
+
+func (command DupesCommand) findDuplicatesUnder(paths []string) error {
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	if command.verbose {
+		log.Info("retrieving all files from the database.")
+	}
+
+	dbFiles, err := store.Files()
+	if err != nil {
+		return fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	dbFilesByPath := make(map[string]*database.File, len(dbFiles))
+	dbFilesBySize := make(map[int64]database.Files, len(dbFiles))
+	for _, dbFile := range dbFiles {
+		if dbFile.IsDir || dbFile.Fingerprint == fingerprint.EMPTY {
+			continue
+		}
+
+		dbFilesByPath[dbFile.Path()] = dbFile
+		dbFilesBySize[dbFile.Size] = append(dbFilesBySize[dbFile.Size], dbFile)
+	}
+
+	fsPathsBySize := make(map[int64][]string, 100)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		if command.verbose {
+			log.Infof("%v: scanning for files.", path)
+		}
+
+		if err := enumerateRegularFiles(absPath, fsPathsBySize); err != nil {
+			return err
+		}
+	}
+
+	sizes := make([]int64, 0, len(fsPathsBySize))
+	for size := range fsPathsBySize {
+		sizes = append(sizes, size)
+	}
+	sort.Sort(int64Slice(sizes))
+
+	fileSets := make([][]string, 0, 10)
+	for _, size := range sizes {
+		fsPaths := fsPathsBySize[size]
+		sizeDbFiles := dbFilesBySize[size]
+
+		// size-first prefilter: only a file with a same-sized counterpart can be a duplicate
+		if len(fsPaths) < 2 && len(sizeDbFiles) == 0 {
+			continue
+		}
+
+		pathsByFingerprint := make(map[fingerprint.Fingerprint][]string, len(fsPaths))
+		seen := make(map[string]bool, len(fsPaths)+len(sizeDbFiles))
+
+		for _, fsPath := range fsPaths {
+			var fp fingerprint.Fingerprint
+
+			if dbFile, found := dbFilesByPath[fsPath]; found && !modifiedSince(dbFile, fsPath) {
+				fp = dbFile.Fingerprint
+			} else {
+				if command.verbose {
+					log.Infof("%v: creating fingerprint.", fsPath)
+				}
+
+				fp, err = fingerprint.Create(fsPath)
+				if err != nil {
+					log.Warnf("%v: could not create fingerprint: %v", fsPath, err)
+					continue
+				}
+			}
+
+			pathsByFingerprint[fp] = append(pathsByFingerprint[fp], fsPath)
+			seen[fsPath] = true
+		}
+
+		for _, dbFile := range sizeDbFiles {
+			if seen[dbFile.Path()] {
+				continue
+			}
+
+			if _, found := pathsByFingerprint[dbFile.Fingerprint]; found {
+				pathsByFingerprint[dbFile.Fingerprint] = append(pathsByFingerprint[dbFile.Fingerprint], dbFile.Path())
+			}
+		}
+
+		for _, fileSet := range pathsByFingerprint {
+			if len(fileSet) > 1 {
+				sort.Strings(fileSet)
+				fileSets = append(fileSets, fileSet)
+			}
+		}
+	}
+
+	sort.Sort(pathSets(fileSets))
+
+	if command.verbose {
+		log.Infof("found %v sets of duplicate files.", len(fileSets))
+	}
+
+	for index, fileSet := range fileSets {
+		if index > 0 {
+			log.Print()
+		}
+
+		log.Printf("Set of %v duplicates:", len(fileSet))
+
+		for _, path := range fileSet {
+			log.Printf("  %v", _path.Rel(path))
+		}
+	}
+
+	return nil
+}
+
+func (command DupesCommand) hasActions() bool {
+	return command.tag || command.delete || command.hardlink
+}
+
+func (command DupesCommand) applyActions(store *storage.Storage, fileSet database.Files) error {
+	if command.tag {
+		if err := command.tagSet(store, fileSet); err != nil {
+			return err
+		}
+	}
+
+	if !command.delete && !command.hardlink {
+		return nil
+	}
+
+	// the files are only removed if each is unchanged since it was fingerprinted
+	if err := verifyUnchanged(fileSet); err != nil {
+		log.Warnf("%v: skipping duplicate set.", err)
+		return nil
+	}
+
+	keeper := command.chooseKeeper(fileSet)
+	log.Infof("%v: keeping", _path.Rel(keeper.Path()))
+
+	for _, file := range fileSet {
+		if file.Id == keeper.Id {
+			continue
+		}
+
+		var err error
+		switch {
+		case command.delete:
+			err = command.deleteDuplicate(store, file, keeper)
+		case command.hardlink:
+			err = command.hardlinkDuplicate(store, file, keeper)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (command DupesCommand) tagSet(store *storage.Storage, fileSet database.Files) error {
+	tagsByFileId := make(map[uint]database.Tags, len(fileSet))
+	union := make(database.Tags, 0, 10)
+
+	for _, file := range fileSet {
+		tags, err := store.TagsByFileId(file.Id)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve tags: %v", file.Path(), err)
+		}
+
+		tagsByFileId[file.Id] = tags
+
+		for _, tag := range tags {
+			tagId := tag.Id
+			if !union.Any(func(tag *database.Tag) bool { return tag.Id == tagId }) {
+				union = append(union, tag)
+			}
+		}
+	}
+
+	for _, file := range fileSet {
+		missing := make(database.Tags, 0, len(union))
+		for _, tag := range union {
+			tagId := tag.Id
+			if !tagsByFileId[file.Id].Any(func(tag *database.Tag) bool { return tag.Id == tagId }) {
+				missing = append(missing, tag)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		log.Infof("%v: tagging %v", _path.Rel(file.Path()), tagLine(missing))
+
+		if command.pretend {
+			continue
+		}
+
+		tagIds := make([]uint, len(missing))
+		for index, tag := range missing {
+			tagIds[index] = tag.Id
+		}
+
+		if err := store.AddFileTags(file.Id, tagIds); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+func (command DupesCommand) chooseKeeper(fileSet database.Files) *database.File {
+	candidates := fileSet
+	if command.prefer != "" {
+		preferred := fileSet.Where(func(file *database.File) bool {
+			return strings.HasPrefix(file.Path(), command.prefer+string(filepath.Separator))
+		})
+
+		if len(preferred) > 0 {
+			candidates = preferred
+		}
+	}
+
+	keeper := candidates[0]
+	for _, file := range candidates[1:] {
+		switch command.keep {
+		case "oldest":
+			if file.ModTime.Before(keeper.ModTime) {
+				keeper = file
+			}
+		case "newest":
+			if file.ModTime.After(keeper.ModTime) {
+				keeper = file
+			}
+		case "shortest":
+			if len(file.Path()) < len(keeper.Path()) {
+				keeper = file
+			}
+		}
+	}
+
+	return keeper
+}
+
+func (command DupesCommand) deleteDuplicate(store *storage.Storage, file, keeper *database.File) error {
+	relPath := _path.Rel(file.Path())
+
+	if command.verbose {
+		log.Infof("%v: moving tags to %v", relPath, _path.Rel(keeper.Path()))
+	}
+
+	tags, err := store.TagsByFileId(file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve tags: %v", file.Path(), err)
+	}
+
+	tagIds := make([]uint, len(tags))
+	for index, tag := range tags {
+		tagIds[index] = tag.Id
+	}
+
+	log.Infof("%v: deleted", relPath)
+
+	if command.pretend {
+		return nil
+	}
+
+	// the database changes are abandoned should the file not be deleted
+	return store.InTransaction(func() error {
+		if err := store.AddFileTags(keeper.Id, tagIds); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %v", keeper.Path(), err)
+		}
+
+		if err := store.RemoveFileTagsByFileId(file.Id); err != nil {
+			return fmt.Errorf("%v: could not delete file-tags: %v", file.Path(), err)
+		}
+
+		if err := store.RemoveFile(file.Id); err != nil {
+			return fmt.Errorf("%v: could not delete file: %v", file.Path(), err)
+		}
+
+		if err := os.Remove(file.Path()); err != nil {
+			return fmt.Errorf("%v: could not delete file: %v", file.Path(), err)
+		}
+
+		return nil
+	})
+}
+
+func (command DupesCommand) hardlinkDuplicate(store *storage.Storage, file, keeper *database.File) error {
+	relPath := _path.Rel(file.Path())
+
+	keeperStat, err := os.Stat(keeper.Path())
+	if err != nil {
+		return fmt.Errorf("%v: could not stat file: %v", keeper.Path(), err)
+	}
+
+	stat, err := os.Stat(file.Path())
+	if err != nil {
+		return fmt.Errorf("%v: could not stat file: %v", file.Path(), err)
+	}
+
+	if os.SameFile(stat, keeperStat) {
+		if command.verbose {
+			log.Infof("%v: already linked to %v", relPath, _path.Rel(keeper.Path()))
+		}
+
+		return nil
+	}
+
+	log.Infof("%v: linked to %v", relPath, _path.Rel(keeper.Path()))
+
+	if command.pretend {
+		return nil
+	}
+
+	// link to a temporary name first so the duplicate is not lost should linking fail
+	linkPath := file.Path() + ".tmsu-link"
+	if err := os.Link(keeper.Path(), linkPath); err != nil {
+		return fmt.Errorf("%v: could not create hard link: %v", file.Path(), err)
+	}
+
+	if err := os.Rename(linkPath, file.Path()); err != nil {
+		os.Remove(linkPath)
+		return fmt.Errorf("%v: could not replace file with hard link: %v", file.Path(), err)
+	}
+
+	device, inode := common.DeviceAndInode(keeperStat)
+
+	_, err = store.UpdateFile(file.Id, file.Path(), keeper.Fingerprint, keeperStat.ModTime(), keeperStat.Size(), false, device, inode)
+	if err != nil {
+		return fmt.Errorf("%v: could not update file in database: %v", file.Path(), err)
+	}
+
+	return nil
+}
+
+// Determines whether the file has been modified since it was fingerprinted, in
+// which case its recorded fingerprint cannot be relied upon.
+func modifiedSince(file *database.File, path string) bool {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+
+	return file.Size != stat.Size() || file.ModTime != stat.ModTime().UTC()
+}
+
+// Checks that each file still exists with the fingerprint recorded for it.
+func verifyUnchanged(fileSet database.Files) error {
+	for _, file := range fileSet {
+		stat, err := os.Stat(file.Path())
+		if err != nil {
+			return fmt.Errorf("%v: could not stat file: %v", file.Path(), err)
+		}
+		if !stat.Mode().IsRegular() {
+			return fmt.Errorf("%v: not a regular file", file.Path())
+		}
+
+		fp, err := fingerprint.Create(file.Path())
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %v", file.Path(), err)
+		}
+		if fp != file.Fingerprint {
+			return fmt.Errorf("%v: file has been modified", file.Path())
+		}
+	}
+
+	return nil
+}
+
+func enumerateRegularFiles(path string, pathsBySize map[int64][]string) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		switch {
+		case os.IsPermission(err):
+			log.Warnf("%v: permission denied", path)
+			return nil
+		case os.IsNotExist(err):
+			return nil
+		default:
+			return fmt.Errorf("%v: could not stat file: %v", path, err)
+		}
+	}
+
+	switch {
+	case common.IsRegular(stat):
+		if stat.Size() > 0 {
+			pathsBySize[stat.Size()] = append(pathsBySize[stat.Size()], path)
+		}
+	case stat.IsDir():
+		dir, err := os.Open(path)
+		if err != nil {
+			if os.IsPermission(err) {
+				log.Warnf("%v: permission denied", path)
+				return nil
+			}
+
+			return fmt.Errorf("%v: could not open directory: %v", path, err)
+		}
+
+		names, err := dir.Readdirnames(0)
+		dir.Close()
+		if err != nil {
+			return fmt.Errorf("%v: could not read directory entries: %v", path, err)
+		}
+
+		for _, name := range names {
+			if err := enumerateRegularFiles(filepath.Join(path, name), pathsBySize); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type int64Slice []int64
+
+func (slice int64Slice) Len() int {
+	return len(slice)
+}
+
+func (slice int64Slice) Less(i, j int) bool {
+	return slice[i] < slice[j]
+}
+
+func (slice int64Slice) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+type pathSets [][]string
+
+func (sets pathSets) Len() int {
+	return len(sets)
+}
+
+func (sets pathSets) Less(i, j int) bool {
+	return sets[i][0] < sets[j][0]
+}
+
+func (sets pathSets) Swap(i, j int) {
+	sets[i], sets[j] = sets[j], sets[i]
+}
@@ -48,17 +48,17 @@ func TestDupesSingle(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -92,29 +92,29 @@ func TestDupesMultiple(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("def"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("def"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("def"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -148,28 +148,28 @@ func TestDupesNone(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("def"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("ghi"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("ghi"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("jkl"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("jkl"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("mno"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("mno"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -210,28 +210,28 @@ func TestDupesSingleUntaggedFile(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("xxx"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("xxx"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("xxx"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("xxx"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -272,28 +272,28 @@ func TestDupesMultipleUntaggedFile(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("xxx"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("xxx"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("xxx"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("xxx"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -334,28 +334,28 @@ func TestDupesNoneUntaggedFile(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/b", fingerprint.Fingerprint("def"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("ghi"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("ghi"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("klm"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/e/f", fingerprint.Fingerprint("klm"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
-	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("nop"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/a/d", fingerprint.Fingerprint("nop"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	command := DupesCommand{false}
+	command := DupesCommand{}
 
 	// test
 
@@ -370,3 +370,399 @@ func TestDupesNoneUntaggedFile(test *testing.T) {
 	bytes, err := ioutil.ReadAll(log.Outfile)
 	compareOutput(test, "", string(bytes))
 }
+
+func TestDupesTagAction(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--tag", "-t", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	appleTag, err := store.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	bananaTag, err := store.TagByName("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.FileByPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	expectTags(test, store, fileA, appleTag, bananaTag)
+
+	fileB, err := store.FileByPath("/tmp/tmsu/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	expectTags(test, store, fileB, appleTag, bananaTag)
+}
+
+func TestDupesDeleteAction(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes("/tmp/tmsu/b", yesterday, yesterday); err != nil {
+		test.Fatal(err)
+	}
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--delete", "-d", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Stat("/tmp/tmsu/a"); !os.IsNotExist(err) {
+		test.Fatal("Newer duplicate was not deleted.")
+	}
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 {
+		test.Fatalf("Expected one file but are %v", len(files))
+	}
+	if files[0].Path() != "/tmp/tmsu/b" {
+		test.Fatalf("Expected oldest file to be kept but was '%v'.", files[0].Path())
+	}
+
+	appleTag, err := store.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	bananaTag, err := store.TagByName("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, files[0], appleTag, bananaTag)
+}
+
+func TestDupesDeleteActionPretend(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/bb", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/bb")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/bb", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--delete", "-d", "", false, ""},
+		cli.Option{"--keep", "-k", "", true, "shortest"},
+		cli.Option{"--pretend", "-p", "", false, ""}}
+	if err := command.Exec(options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Stat("/tmp/tmsu/bb"); err != nil {
+		test.Fatal("File was deleted despite --pretend.")
+	}
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "tmsu: New tag 'apple'.\nSet of 2 duplicates:\n  /tmp/tmsu/a\n  /tmp/tmsu/bb\ntmsu: /tmp/tmsu/a: keeping\ntmsu: /tmp/tmsu/bb: deleted\n", string(bytes))
+}
+
+func TestDupesDeleteActionModifiedKeeper(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/bb", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/bb")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/bb", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// the keeper is modified after it was fingerprinted
+	if err := createFile("/tmp/tmsu/a", "goodbye"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--delete", "-d", "", false, ""},
+		cli.Option{"--keep", "-k", "", true, "shortest"}}
+	if err := command.Exec(options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Stat("/tmp/tmsu/bb"); err != nil {
+		test.Fatal("File was deleted despite the keeper having been modified.")
+	}
+
+	log.Errfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Errfile)
+	compareOutput(test, "tmsu: /tmp/tmsu/a: file has been modified: skipping duplicate set.\n", string(bytes))
+}
+
+func TestDupesKeepWithoutAction(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	command := DupesCommand{}
+
+	// test
+
+	keepErr := command.Exec(cli.Options{cli.Option{"--keep", "-k", "", true, "newest"}}, []string{})
+	preferErr := command.Exec(cli.Options{cli.Option{"--prefer", "-P", "", true, "/tmp"}}, []string{})
+
+	// validate
+
+	if keepErr == nil || preferErr == nil {
+		test.Fatal("Expected --keep and --prefer to require an action.")
+	}
+}
+
+func TestDupesRecursive(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu-scan/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-scan/c/d", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-scan/e", "world"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-scan/f", "unique"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-scan")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--recursive", "-r", "", false, ""}}, []string{"/tmp/tmsu-scan"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "tmsu: New tag 'apple'.\nSet of 3 duplicates:\n  /tmp/tmsu-scan/b\n  /tmp/tmsu-scan/c/d\n  /tmp/tmsu/a\n", string(bytes))
+}
+
+func TestDupesRecursiveModifiedFile(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-scan/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-scan/c", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-scan")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-scan/b", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// same size but different contents
+	if err := createFile("/tmp/tmsu-scan/b", "jello"); err != nil {
+		test.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes("/tmp/tmsu-scan/b", later, later); err != nil {
+		test.Fatal(err)
+	}
+
+	command := DupesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--recursive", "-r", "", false, ""}}, []string{"/tmp/tmsu-scan"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "tmsu: New tag 'apple'.\n", string(bytes))
+}
@@ -52,7 +52,10 @@ func (FilesCommand) Description() string {
 
 Lists the files, if any, that have all of the TAGs specified. Tags can be
 excluded by prefixing their names with a minus character (option processing
-must first be disabled with '--').`
+must first be disabled with '--').
+
+A tag also matches the files tagged with any of its descendants, e.g. 'media'
+matches files tagged 'media/audio' or 'media/audio/podcast'.`
 }
 
 func (FilesCommand) Options() cli.Options {
@@ -139,7 +142,7 @@ func (command FilesCommand) listFilesForTags(args []string) error {
 			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
 		}
 		if tag == nil {
-			log.Fatalf("no such tag '%v'.", tagName)
+			return fmt.Errorf("no such tag '%v'.", tagName)
 		}
 
 		if include {
@@ -47,17 +47,17 @@ func TestFilesAll(test *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	_, err = store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	_, err = store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	_, err = store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -97,17 +97,17 @@ func TestFilesSingleTag(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -169,17 +169,17 @@ func TestFilesNotSingleTag(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -241,17 +241,17 @@ func TestFilesAnd(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -322,17 +322,17 @@ func TestFilesAndNot(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileBA, err := store.AddFile("/tmp/b/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -385,3 +385,173 @@ func TestFilesAndNot(test *testing.T) {
 }
 
 //TODO tests for 'file' and 'directory' options.
+
+func TestFilesDescendants(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	podcastTag, err := store.AddTag("media/audio/podcast")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	mediaTag, err := store.TagByName("media")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if mediaTag == nil {
+		test.Fatal("Ancestor tag was not created.")
+	}
+
+	otherTag, err := store.AddTag("other")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, podcastTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileB.Id, mediaTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileB.Id, otherTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileC.Id, otherTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := FilesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"media"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"other", "-media/audio"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"-media"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/b\n/tmp/c\n/tmp/c\n", string(bytes))
+}
+
+func TestFilesImplied(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := addTags(store, "apple/braeburn", "banana", "fruit", "food"); err != nil {
+		test.Fatal(err)
+	}
+
+	braeburnTag, err := store.TagByName("apple/braeburn")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bananaTag, err := store.TagByName("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, braeburnTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileB.Id, bananaTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	implyCommand := ImplyCommand{}
+	for _, pair := range [][]string{{"apple", "fruit"}, {"fruit", "food"}} {
+		if err := implyCommand.Exec(cli.Options{}, pair); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	command := FilesCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"food"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"-fruit"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n", string(bytes))
+}
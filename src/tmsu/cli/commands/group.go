@@ -0,0 +1,213 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+type GroupCommand struct {
+	verbose bool
+}
+
+func (GroupCommand) Name() cli.CommandName {
+	return "group"
+}
+
+func (GroupCommand) Synopsis() string {
+	return "Creates a group of mutually exclusive tags"
+}
+
+func (GroupCommand) Description() string {
+	return `tmsu group GROUP TAG...
+tmsu group --list
+tmsu group --delete GROUP [TAG]...
+
+Adds the TAGs to the tag group GROUP, creating the group if necessary. A file
+can have at most one tag from each group: tagging a file with another tag from
+the group fails unless the 'tag' command's --replace option is specified, in
+which case the file's existing tag from the group is removed.
+
+Only the tags applied explicitly are constrained: a file may still have a
+second tag from the group by implication or through a descendant tag, e.g.
+'status/done/archived' under 'status/done'.
+
+    $ tmsu group rating rating-1 rating-2 rating-3 rating-4 rating-5
+    $ tmsu group status status/todo status/doing status/done
+
+TAGs that do not exist are created. A warning is shown for files that already
+have more than one tag from the group.
+
+With --delete the TAGs are removed from the group or, if no TAGs are
+specified, the group itself is deleted. The tags are not deleted.`
+}
+
+func (GroupCommand) Options() cli.Options {
+	return cli.Options{{"--delete", "-d", "removes tags from the tag group or deletes the tag group", false, ""},
+		{"--list", "-l", "lists the tag groups", false, ""}}
+}
+
+func (command GroupCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	switch {
+	case options.HasOption("--list"):
+		return command.listGroups(store)
+	case options.HasOption("--delete"):
+		if len(args) < 1 {
+			return fmt.Errorf("tag group must be specified.")
+		}
+
+		return command.deleteGroup(store, args[0], args[1:])
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf("tag group and tags must be specified.")
+	}
+
+	return command.addGroup(store, args[0], args[1:])
+}
+
+// unexported
+
+func (command GroupCommand) listGroups(store *storage.Storage) error {
+	if command.verbose {
+		log.Infof("retrieving tag groups.")
+	}
+
+	groups, err := store.TagGroups()
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag groups: %v", err)
+	}
+
+	for _, group := range groups {
+		tagNames := make([]string, len(group.Tags))
+		for index, tag := range group.Tags {
+			tagNames[index] = tag.Name
+		}
+
+		log.Printf("%v: %v", group.Name, strings.Join(tagNames, " "))
+	}
+
+	return nil
+}
+
+func (command GroupCommand) addGroup(store *storage.Storage, groupName string, tagNames []string) error {
+	tagIds, err := TagCommand{}.lookupTagIds(store, tagNames)
+	if err != nil {
+		return err
+	}
+
+	if command.verbose {
+		log.Infof("adding tags to tag group '%v'.", groupName)
+	}
+
+	group, err := store.AddTagGroupMembers(groupName, tagIds)
+	if err != nil {
+		return err
+	}
+
+	return command.warnConflicts(store, group)
+}
+
+func (command GroupCommand) deleteGroup(store *storage.Storage, groupName string, tagNames []string) error {
+	group, err := store.TagGroupByName(groupName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag group '%v': %v", groupName, err)
+	}
+	if group == nil {
+		return fmt.Errorf("no such tag group '%v'.", groupName)
+	}
+
+	if len(tagNames) == 0 {
+		if command.verbose {
+			log.Infof("deleting tag group '%v'.", groupName)
+		}
+
+		if err := store.RemoveTagGroup(group.Id); err != nil {
+			return fmt.Errorf("could not delete tag group '%v': %v", groupName, err)
+		}
+
+		return nil
+	}
+
+	tagIds := make([]uint, len(tagNames))
+	for index, tagName := range tagNames {
+		tag, err := store.TagByName(tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return fmt.Errorf("no such tag '%v'.", tagName)
+		}
+
+		tagIds[index] = tag.Id
+	}
+
+	if command.verbose {
+		log.Infof("removing tags from tag group '%v'.", groupName)
+	}
+
+	if err := store.RemoveTagGroupMembers(group.Id, tagIds); err != nil {
+		return fmt.Errorf("could not remove tags from tag group '%v': %v", groupName, err)
+	}
+
+	return nil
+}
+
+// Warns of the files that already have more than one tag from the group.
+func (command GroupCommand) warnConflicts(store *storage.Storage, group *database.TagGroup) error {
+	counts := make(map[uint]uint)
+	fileIds := make([]uint, 0)
+
+	for _, tag := range group.Tags {
+		fileTags, err := store.FileTagsByTagId(tag.Id)
+		if err != nil {
+			return fmt.Errorf("could not retrieve files tagged '%v': %v", tag.Name, err)
+		}
+
+		for _, fileTag := range fileTags {
+			counts[fileTag.FileId]++
+			if counts[fileTag.FileId] == 2 {
+				fileIds = append(fileIds, fileTag.FileId)
+			}
+		}
+	}
+
+	for _, fileId := range fileIds {
+		file, err := store.File(fileId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file #%v: %v", fileId, err)
+		}
+
+		log.Warnf("%v: has more than one tag from tag group '%v'.", file.Path(), group.Name)
+	}
+
+	return nil
+}
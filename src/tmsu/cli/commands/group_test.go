@@ -0,0 +1,78 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+func TestGroupList(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "rating-1", "rating-2", "todo", "doing", "done"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := GroupCommand{}
+
+	if err := command.Exec(cli.Options{}, []string{"rating", "rating-2", "rating-1"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"status", "todo", "doing", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{cli.Option{"--delete", "-d", "", false, ""}}, []string{"status", "doing"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--list", "-l", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "rating: rating-1 rating-2\nstatus: done todo\n", string(bytes))
+}
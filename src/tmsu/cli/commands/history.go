@@ -0,0 +1,78 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package commands
+
+import (
+	"fmt"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+type HistoryCommand struct {
+	verbose bool
+}
+
+func (HistoryCommand) Name() cli.CommandName {
+	return "history"
+}
+
+func (HistoryCommand) Synopsis() string {
+	return "List the changes that can be undone"
+}
+
+func (HistoryCommand) Description() string {
+	return `tmsu history
+
+Lists the recorded commands that changed the database, oldest first, along with
+when they were run. Commands that have been undone, and so can be redone, are
+marked '(undone)'.`
+}
+
+func (HistoryCommand) Options() cli.Options {
+	return cli.Options{}
+}
+
+func (command HistoryCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	if command.verbose {
+		log.Infof("retrieving history.")
+	}
+
+	operations, err := store.Operations()
+	if err != nil {
+		return fmt.Errorf("could not retrieve history: %v", err)
+	}
+
+	for _, operation := range operations {
+		suffix := ""
+		if operation.Undone {
+			suffix = " (undone)"
+		}
+
+		log.Printf("%v  %v  %v%v", operation.Id, operation.Time.Format("2006-01-02 15:04:05"), operation.Description, suffix)
+	}
+
+	return nil
+}
@@ -19,13 +19,16 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 	"tmsu/cli"
 	"tmsu/log"
 	"tmsu/storage"
+	"tmsu/storage/database"
 )
 
 type ImplyCommand struct {
 	verbose bool
+	prune   bool
 }
 
 func (ImplyCommand) Name() cli.CommandName {
@@ -37,19 +40,67 @@ func (ImplyCommand) Synopsis() string {
 }
 
 func (ImplyCommand) Description() string {
-	return `tmsu [OPTION] imply TAG1 TAG2
+	return `tmsu [OPTION] imply TAG1 [and TAG]... [not] TAG2
 tmsu imply --list
+tmsu imply --graph
+tmsu imply --reduce
+tmsu imply --conflicts
+tmsu imply --apply [TAG1 [and TAG]... TAG2]
+tmsu imply --delete [--prune] TAG1 [and TAG]... [not] TAG2
 
-Creates a tag implication such that whenever TAG1 is applied, TAG2 is automatically applied.`
+Creates a tag implication such that any file tagged TAG1 also has TAG2. The
+implied tags are not stored against the files but are evaluated whenever files
+or tags are listed, so adding or removing an implication affects files that are
+already tagged. The implications of a tag also apply to its descendants.
+
+Further implying tags can be specified using 'and', in which case a file must
+have all of the implying tags to have the implied tag:
+
+    $ tmsu imply holiday and 2023 holiday-2023
+
+With 'not' the implied tag is instead excluded: a file with the implying tags
+that also has TAG2 is in conflict. The 'tag' command warns when a file is
+tagged such that it is in conflict and --conflicts lists the conflicting files:
+
+    $ tmsu imply draft not published
+
+An implication that would result in a cycle, such as TAG2 already implying TAG1
+(directly or indirectly), is rejected. An implication that is redundant as
+TAG1 already implies TAG2 indirectly is not added. These checks, and --reduce,
+only consider implications with a single implying tag.
+
+--graph outputs the implications in Graphviz DOT format, e.g.:
+
+    $ tmsu imply --graph | dot -Tpng >implications.png
+
+--reduce removes the redundant implications, i.e. those where the implied tag
+is also implied indirectly via the other implications, leaving the smallest
+set of implications with the same effect.
+
+--apply adds the implied tags to the files that have the implying tags so
+that they are stored against the files, e.g. for use by other programs. With
+TAG1 and TAG2 the implication is added and then applied, otherwise every
+implication is applied. Tags applied in this way are recorded as implied
+rather than explicit and are not listed by 'tmsu tags --explicit'.
+
+--prune, when deleting an implication, removes the implied tag from those
+files where it was only applied by --apply and is no longer implied by the
+remaining implications.`
 }
 
 func (ImplyCommand) Options() cli.Options {
 	return cli.Options{cli.Option{"--delete", "-d", "deletes the tag implication", false, ""},
-		cli.Option{"--list", "-l", "lists the tag implications", false, ""}}
+		cli.Option{"--list", "-l", "lists the tag implications", false, ""},
+		cli.Option{"--graph", "-g", "outputs the tag implications in Graphviz DOT format", false, ""},
+		cli.Option{"--reduce", "-r", "removes redundant tag implications", false, ""},
+		cli.Option{"--conflicts", "-c", "lists the files with conflicting tags", false, ""},
+		cli.Option{"--apply", "-a", "applies the implied tags to the files with the implying tags", false, ""},
+		cli.Option{"--prune", "-p", "with --delete, removes the implied tag where applied by --apply", false, ""}}
 }
 
 func (command ImplyCommand) Exec(options cli.Options, args []string) error {
 	command.verbose = options.HasOption("--verbose")
+	command.prune = options.HasOption("--prune")
 
 	store, err := storage.Open()
 	if err != nil {
@@ -60,19 +111,35 @@ func (command ImplyCommand) Exec(options cli.Options, args []string) error {
 	switch {
 	case options.HasOption("--list"):
 		return command.listImplications(store)
+	case options.HasOption("--graph"):
+		return command.graphImplications(store)
+	case options.HasOption("--reduce"):
+		return command.reduceImplications(store)
+	case options.HasOption("--conflicts"):
+		return command.listConflicts(store)
 	case options.HasOption("--delete"):
-		if len(args) < 2 {
-			return fmt.Errorf("Implying and implied tag must be specified.")
-		}
+		return command.deleteImplication(store, args)
+	case options.HasOption("--apply"):
+		// the implications are only applied should none conflict with a tag
+		// group
+		return store.InTransaction(func() error {
+			if len(args) == 0 {
+				return command.applyImplications(store)
+			}
 
-		return command.deleteImplication(store, args[0], args[1])
+			if err := command.addImplication(store, args); err != nil {
+				return err
+			}
+
+			return command.applyImplication(store, args)
+		})
 	}
 
-	if len(args) < 2 {
-		return fmt.Errorf("Implying and implied tag must be specified.")
+	if command.prune {
+		return fmt.Errorf("--prune can only be used with --delete.")
 	}
 
-	return command.addImplication(store, args[0], args[1])
+	return command.addImplication(store, args)
 }
 
 // unexported
@@ -87,6 +154,11 @@ func (command ImplyCommand) listImplications(store *storage.Storage) error {
 		return fmt.Errorf("could not retrieve implications: %v", err)
 	}
 
+	compoundImplications, err := store.CompoundImplications()
+	if err != nil {
+		return fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
 	width := 0
 	for _, implication := range implications {
 		length := len(implication.ImplyingTag.Name)
@@ -94,6 +166,12 @@ func (command ImplyCommand) listImplications(store *storage.Storage) error {
 			width = length
 		}
 	}
+	for _, implication := range compoundImplications {
+		length := len(implyingTagNames(implication.ImplyingTags))
+		if length > width {
+			width = length
+		}
+	}
 
 	previousImplyingTagName := ""
 	for _, implication := range implications {
@@ -109,26 +187,57 @@ func (command ImplyCommand) listImplications(store *storage.Storage) error {
 			fmt.Printf(", %v", implication.ImpliedTag.Name)
 		}
 	}
-	fmt.Println()
+	if len(implications) > 0 {
+		fmt.Println()
+	}
+
+	for _, implication := range compoundImplications {
+		fmt.Printf("%*v -> %v\n", width, implyingTagNames(implication.ImplyingTags), impliedTagName(implication))
+	}
 
 	return nil
 }
 
-func (command ImplyCommand) addImplication(store *storage.Storage, tagName, impliedTagName string) error {
-	tag, err := store.Db.TagByName(tagName)
+func (command ImplyCommand) addImplication(store *storage.Storage, args []string) error {
+	tags, impliedTag, negated, err := command.lookupImplication(store, args)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		return err
 	}
-	if tag == nil {
-		return fmt.Errorf("no such tag '%v'.", tagName)
+
+	if len(tags) > 1 || negated {
+		return command.addCompoundImplication(store, tags, impliedTag, negated)
 	}
 
-	impliedTag, err := store.Db.TagByName(impliedTagName)
+	tag := tags[0]
+	tagName, impliedTagName := tag.Name, impliedTag.Name
+
+	if tag.Id == impliedTag.Id {
+		return fmt.Errorf("a tag cannot imply itself.")
+	}
+
+	chain, err := store.ImplicationChain(impliedTag.Id, tag.Id)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
+		return err
 	}
-	if impliedTag == nil {
-		return fmt.Errorf("no such tag '%v'.", impliedTagName)
+	if chain != nil {
+		return fmt.Errorf("cannot add tag implication of '%v' to '%v' as '%v' already implies '%v' (%v): this would create a cycle.", tagName, impliedTagName, impliedTagName, tagName, implicationChainText(chain))
+	}
+
+	chain, err = store.ImplicationChain(tag.Id, impliedTag.Id)
+	if err != nil {
+		return err
+	}
+	if chain != nil {
+		if len(chain) > 2 {
+			log.Warnf("'%v' already implies '%v' (%v): implication is redundant.", tagName, impliedTagName, implicationChainText(chain))
+		}
+
+		return nil
+	}
+
+	redundant, err := store.RedundantImplications()
+	if err != nil {
+		return fmt.Errorf("could not identify redundant implications: %v", err)
 	}
 
 	if command.verbose {
@@ -139,33 +248,368 @@ func (command ImplyCommand) addImplication(store *storage.Storage, tagName, impl
 		return fmt.Errorf("could not add tag implication of '%v' to '%v': %v", tagName, impliedTagName, err)
 	}
 
+	nowRedundant, err := store.RedundantImplications()
+	if err != nil {
+		return fmt.Errorf("could not identify redundant implications: %v", err)
+	}
+
+	for _, implication := range nowRedundant {
+		if !containsImplication(redundant, implication) {
+			log.Warnf("implication of '%v' to '%v' is now redundant: use --reduce to remove.", implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+		}
+	}
+
 	return nil
 }
 
-func (command ImplyCommand) deleteImplication(store *storage.Storage, tagName, impliedTagName string) error {
-	tag, err := store.Db.TagByName(tagName)
+func (command ImplyCommand) addCompoundImplication(store *storage.Storage, tags database.Tags, impliedTag *database.Tag, negated bool) error {
+	if tags.Any(func(tag *database.Tag) bool { return tag.Id == impliedTag.Id }) {
+		if negated {
+			return fmt.Errorf("a tag cannot conflict with itself.")
+		}
+		return fmt.Errorf("a tag cannot imply itself.")
+	}
+
+	if command.verbose {
+		if negated {
+			log.Infof("adding tag implication of %v to not '%v'.", implyingTagsText(tags), impliedTag.Name)
+		} else {
+			log.Infof("adding tag implication of %v to '%v'.", implyingTagsText(tags), impliedTag.Name)
+		}
+	}
+
+	if err := store.AddCompoundImplication(tagIdsOf(tags), impliedTag.Id, negated); err != nil {
+		return fmt.Errorf("could not add tag implication of %v to '%v': %v", implyingTagsText(tags), impliedTag.Name, err)
+	}
+
+	return nil
+}
+
+func (command ImplyCommand) graphImplications(store *storage.Storage) error {
+	if command.verbose {
+		log.Infof("retrieving tag implications.")
+	}
+
+	implications, err := store.Implications()
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		return fmt.Errorf("could not retrieve implications: %v", err)
 	}
-	if tag == nil {
-		return fmt.Errorf("no such tag '%v'.", tagName)
+
+	compoundImplications, err := store.CompoundImplications()
+	if err != nil {
+		return fmt.Errorf("could not retrieve compound implications: %v", err)
 	}
 
-	impliedTag, err := store.Db.TagByName(impliedTagName)
+	log.Print("digraph implications {")
+	for _, implication := range implications {
+		log.Printf("    %v -> %v;", dotId(implication.ImplyingTag.Name), dotId(implication.ImpliedTag.Name))
+	}
+	for _, implication := range compoundImplications {
+		attributes := ""
+		if implication.Negated {
+			attributes = " [style=dashed, arrowhead=tee]"
+		}
+
+		if len(implication.ImplyingTags) == 1 {
+			log.Printf("    %v -> %v%v;", dotId(implication.ImplyingTags[0].Name), dotId(implication.ImpliedTag.Name), attributes)
+			continue
+		}
+
+		// conjunctions are drawn as a point joining the implying tags
+		node := fmt.Sprintf("and%v", implication.Id)
+		log.Printf("    %v [shape=point];", node)
+		for _, tag := range implication.ImplyingTags {
+			log.Printf("    %v -> %v [arrowhead=none];", dotId(tag.Name), node)
+		}
+		log.Printf("    %v -> %v%v;", node, dotId(implication.ImpliedTag.Name), attributes)
+	}
+	log.Print("}")
+
+	return nil
+}
+
+func (command ImplyCommand) reduceImplications(store *storage.Storage) error {
+	if command.verbose {
+		log.Infof("checking for cycles.")
+	}
+
+	cycle, err := store.ImplicationCycle()
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
+		return fmt.Errorf("could not check implications for cycles: %v", err)
 	}
-	if impliedTag == nil {
-		return fmt.Errorf("no such tag '%v'.", impliedTagName)
+	if cycle != nil {
+		return fmt.Errorf("cannot reduce implications as %v is a cycle: delete one of these implications first.", implicationChainText(cycle))
+	}
+
+	if command.verbose {
+		log.Infof("identifying redundant implications.")
+	}
+
+	redundant, err := store.RedundantImplications()
+	if err != nil {
+		return fmt.Errorf("could not identify redundant implications: %v", err)
+	}
+
+	for _, implication := range redundant {
+		log.Infof("removing redundant implication of '%v' to '%v'.", implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+
+		if err := store.RemoveImplication(implication.ImplyingTag.Id, implication.ImpliedTag.Id); err != nil {
+			return fmt.Errorf("could not delete tag implication of '%v' to '%v': %v", implication.ImplyingTag.Name, implication.ImpliedTag.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (command ImplyCommand) deleteImplication(store *storage.Storage, args []string) error {
+	tags, impliedTag, negated, err := command.lookupImplication(store, args)
+	if err != nil {
+		return err
+	}
+
+	if command.verbose {
+		log.Infof("removing tag implication of %v to %v.", implyingTagsText(tags), impliedTagText(impliedTag, negated))
+	}
+
+	if len(tags) > 1 || negated {
+		implication, err := store.CompoundImplication(tagIdsOf(tags), impliedTag.Id, negated)
+		if err != nil {
+			return err
+		}
+
+		if implication != nil {
+			if err := store.RemoveCompoundImplication(implication.Id); err != nil {
+				return fmt.Errorf("could not delete tag implication of %v to %v: %v", implyingTagsText(tags), impliedTagText(impliedTag, negated), err)
+			}
+		}
+	} else {
+		if err := store.RemoveImplication(tags[0].Id, impliedTag.Id); err != nil {
+			return fmt.Errorf("could not delete tag implication of %v to %v: %v", implyingTagsText(tags), impliedTagText(impliedTag, negated), err)
+		}
+	}
+
+	if command.prune && !negated {
+		if command.verbose {
+			log.Infof("pruning '%v' from files tagged %v.", impliedTag.Name, implyingTagsText(tags))
+		}
+
+		count, err := store.PruneImpliedFileTags(tagIdsOf(tags), impliedTag.Id)
+		if err != nil {
+			return fmt.Errorf("could not prune tag '%v': %v", impliedTag.Name, err)
+		}
+
+		if command.verbose {
+			log.Infof("removed '%v' from %v file(s).", impliedTag.Name, count)
+		}
 	}
 
+	return nil
+}
+
+func (command ImplyCommand) applyImplications(store *storage.Storage) error {
 	if command.verbose {
-		log.Infof("removing tag implication of '%v' to '%v'.", tagName, impliedTagName)
+		log.Infof("retrieving tag implications.")
 	}
 
-	if err = store.RemoveImplication(tag.Id, impliedTag.Id); err != nil {
-		return fmt.Errorf("could not add delete tag implication of '%v' to '%v': %v", tagName, impliedTagName, err)
+	implications, err := store.Implications()
+	if err != nil {
+		return fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	for _, implication := range implications {
+		implyingTag, impliedTag := implication.ImplyingTag, implication.ImpliedTag
+		if err := command.applyTags(store, database.Tags{&implyingTag}, &impliedTag); err != nil {
+			return err
+		}
+	}
+
+	compoundImplications, err := store.CompoundImplications()
+	if err != nil {
+		return fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	for _, implication := range compoundImplications {
+		if implication.Negated {
+			continue
+		}
+
+		if err := command.applyTags(store, implication.ImplyingTags, &implication.ImpliedTag); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+func (command ImplyCommand) applyImplication(store *storage.Storage, args []string) error {
+	tags, impliedTag, negated, err := command.lookupImplication(store, args)
+	if err != nil {
+		return err
+	}
+	if negated {
+		return fmt.Errorf("cannot apply an implication to not '%v'.", impliedTag.Name)
+	}
+
+	return command.applyTags(store, tags, impliedTag)
+}
+
+func (command ImplyCommand) applyTags(store *storage.Storage, tags database.Tags, impliedTag *database.Tag) error {
+	if command.verbose {
+		log.Infof("applying '%v' to files tagged %v.", impliedTag.Name, implyingTagsText(tags))
+	}
+
+	count, err := store.ApplyImplication(tagIdsOf(tags), impliedTag.Id)
+	if err != nil {
+		return fmt.Errorf("could not apply tag implication of %v to '%v': %v", implyingTagsText(tags), impliedTag.Name, err)
+	}
+
+	if command.verbose {
+		log.Infof("applied '%v' to %v file(s).", impliedTag.Name, count)
+	}
+
+	return nil
+}
+
+func (command ImplyCommand) listConflicts(store *storage.Storage) error {
+	if command.verbose {
+		log.Infof("identifying files with conflicting tags.")
+	}
+
+	conflicts, err := store.Conflicts()
+	if err != nil {
+		return fmt.Errorf("could not identify conflicts: %v", err)
+	}
+
+	for _, conflict := range conflicts {
+		log.Printf("%v: '%v' conflicts with %v", conflict.File.Path(), conflict.Implication.ImpliedTag.Name, implyingTagsText(conflict.Implication.ImplyingTags))
+	}
+
+	return nil
+}
+
+// Looks up the tags of an implication specified as 'TAG [and TAG]... [not] TAG'.
+func (command ImplyCommand) lookupImplication(store *storage.Storage, args []string) (database.Tags, *database.Tag, bool, error) {
+	tagNames, impliedTagName, negated, err := parseImplication(args)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	tags := make(database.Tags, len(tagNames))
+	for index, tagName := range tagNames {
+		tag, err := store.Db.TagByName(tagName)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return nil, nil, false, fmt.Errorf("no such tag '%v'.", tagName)
+		}
+
+		tags[index] = tag
+	}
+
+	impliedTag, err := store.Db.TagByName(impliedTagName)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
+	}
+	if impliedTag == nil {
+		return nil, nil, false, fmt.Errorf("no such tag '%v'.", impliedTagName)
+	}
+
+	return tags, impliedTag, negated, nil
+}
+
+func parseImplication(args []string) ([]string, string, bool, error) {
+	if len(args) < 2 {
+		return nil, "", false, fmt.Errorf("Implying and implied tag must be specified.")
+	}
+
+	impliedTagName := args[len(args)-1]
+	args = args[:len(args)-1]
+
+	negated := args[len(args)-1] == "not"
+	if negated {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) == 0 {
+		return nil, "", false, fmt.Errorf("Implying and implied tag must be specified.")
+	}
+
+	tagNames := []string{args[0]}
+	for index := 1; index < len(args); index += 2 {
+		if args[index] != "and" || index+1 == len(args) {
+			return nil, "", false, fmt.Errorf("expected 'TAG1 [and TAG]... [not] TAG2'.")
+		}
+
+		tagNames = append(tagNames, args[index+1])
+	}
+
+	return tagNames, impliedTagName, negated, nil
+}
+
+func implicationChainText(chain database.Tags) string {
+	names := make([]string, len(chain))
+	for index, tag := range chain {
+		names[index] = "'" + tag.Name + "'"
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+func containsImplication(implications database.Implications, implication *database.Implication) bool {
+	for _, candidate := range implications {
+		if candidate.ImplyingTag.Id == implication.ImplyingTag.Id && candidate.ImpliedTag.Id == implication.ImpliedTag.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func implyingTagNames(tags database.Tags) string {
+	names := make([]string, len(tags))
+	for index, tag := range tags {
+		names[index] = tag.Name
+	}
+
+	return strings.Join(names, " and ")
+}
+
+func implyingTagsText(tags database.Tags) string {
+	names := make([]string, len(tags))
+	for index, tag := range tags {
+		names[index] = "'" + tag.Name + "'"
+	}
+
+	return strings.Join(names, " and ")
+}
+
+func impliedTagName(implication *database.CompoundImplication) string {
+	if implication.Negated {
+		return "not " + implication.ImpliedTag.Name
+	}
+
+	return implication.ImpliedTag.Name
+}
+
+func impliedTagText(tag *database.Tag, negated bool) string {
+	if negated {
+		return "not '" + tag.Name + "'"
+	}
+
+	return "'" + tag.Name + "'"
+}
+
+func tagIdsOf(tags database.Tags) []uint {
+	ids := make([]uint, len(tags))
+	for index, tag := range tags {
+		ids[index] = tag.Id
+	}
+
+	return ids
+}
+
+// Quotes a tag name for use as a DOT identifier.
+func dotId(name string) string {
+	return `"` + strings.Replace(strings.Replace(name, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,551 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"tmsu/cli"
+	"tmsu/fingerprint"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+func TestImplyRejectsCycle(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "a", "b", "c"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	if err := command.Exec(cli.Options{}, []string{"a", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"b", "c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = command.Exec(cli.Options{}, []string{"c", "a"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Cyclic implication was not rejected.")
+	}
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 2 {
+		test.Fatalf("Expected 2 implications but are %v.", len(implications))
+	}
+}
+
+func TestImplySkipsRedundantImplication(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "a", "b", "c"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	if err := command.Exec(cli.Options{}, []string{"a", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.Exec(cli.Options{}, []string{"b", "c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"a", "c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 2 {
+		test.Fatalf("Expected 2 implications but are %v.", len(implications))
+	}
+}
+
+func TestImplyGraph(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "a", `b"c`); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	if err := command.Exec(cli.Options{}, []string{"a", `b"c`}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--graph", "-g", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "digraph implications {\n    \"a\" -> \"b\\\"c\";\n}\n", string(bytes))
+}
+
+func TestImplyReduce(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "a", "b", "c", "d"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	// added in this order the later implications make the earlier redundant
+	for _, pair := range [][]string{{"a", "c"}, {"a", "d"}, {"b", "c"}, {"c", "d"}, {"a", "b"}} {
+		if err := command.Exec(cli.Options{}, pair); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--reduce", "-r", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 3 {
+		test.Fatalf("Expected 3 implications but are %v.", len(implications))
+	}
+
+	expected := [][]string{{"a", "b"}, {"b", "c"}, {"c", "d"}}
+	for index, implication := range implications {
+		if implication.ImplyingTag.Name != expected[index][0] || implication.ImpliedTag.Name != expected[index][1] {
+			test.Fatalf("Unexpected implication of '%v' to '%v'.", implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+		}
+	}
+}
+
+func TestImplyApply(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	aTag, err := store.AddTag("a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bTag, err := store.AddTag("b")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, aTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--apply", "-a", "", false, ""}}, []string{"a", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectTags(test, store, file, aTag, bTag)
+
+	explicitTags, err := store.ExplicitTagsByFileId(file.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(explicitTags) != 1 || explicitTags[0].Id != aTag.Id {
+		test.Fatalf("Expected only tag 'a' to be explicit but are %v.", len(explicitTags))
+	}
+}
+
+func TestImplyDeletePrune(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	aFile, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bFile, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("456"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	aTag, err := store.AddTag("a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bTag, err := store.AddTag("b")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(aFile.Id, aTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(bFile.Id, aTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(bFile.Id, bTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	if err := command.Exec(cli.Options{cli.Option{"--apply", "-a", "", false, ""}}, []string{"a", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := cli.Options{cli.Option{"--delete", "-d", "", false, ""}, cli.Option{"--prune", "-p", "", false, ""}}
+	if err := command.Exec(options, []string{"a", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectTags(test, store, aFile, aTag)
+	expectTags(test, store, bFile, aTag, bTag)
+}
+
+func TestImplyCompound(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	aFile, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bFile, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("456"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	holidayTag, err := store.AddTag("holiday")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	yearTag, err := store.AddTag("2023")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	holidayYearTag, err := store.AddTag("holiday-2023")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(aFile.Id, holidayTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(aFile.Id, yearTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(bFile.Id, holidayTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"holiday", "and", "2023", "holiday-2023"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.FilesWithTags([]uint{holidayYearTag.Id}, []uint{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Id != aFile.Id {
+		test.Fatalf("Expected only file '%v' to have tag 'holiday-2023' but found %v files.", aFile.Path(), len(files))
+	}
+
+	tags, err := store.TagsByFileId(bFile.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	impliedTags, err := store.ImpliedTags(tags)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(impliedTags) != 0 {
+		test.Fatalf("File '%v' has %v implied tags but expected none.", bFile.Path(), len(impliedTags))
+	}
+}
+
+func TestImplyConflicts(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	aFile, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bFile, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("456"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	draftTag, err := store.AddTag("draft")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	publishedTag, err := store.AddTag("published")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(aFile.Id, draftTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(bFile.Id, draftTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(bFile.Id, publishedTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	if err := command.Exec(cli.Options{}, []string{"draft", "not", "published"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--conflicts", "-c", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "/tmp/tmsu/b: 'published' conflicts with 'draft'\n", string(bytes))
+}
+
+func TestImplyApplyRespectsTagGroups(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("456"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	favouriteTag, err := store.AddTag("favourite")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rating3Tag, err := store.AddTag("rating-3")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rating5Tag, err := store.AddTag("rating-5")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTagGroupMembers("rating", []uint{rating3Tag.Id, rating5Tag.Id}); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, favouriteTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, favouriteTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, rating3Tag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := ImplyCommand{}
+
+	// test
+
+	err = command.Exec(cli.Options{cli.Option{"--apply", "-a", "", false, ""}}, []string{"favourite", "rating-5"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Conflict with tag group was not reported.")
+	}
+
+	expectTags(test, store, fileA, favouriteTag)
+	expectTags(test, store, fileB, favouriteTag, rating3Tag)
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no implications but are %v.", len(implications))
+	}
+}
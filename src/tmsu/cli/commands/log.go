@@ -0,0 +1,184 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+type LogCommand struct {
+	verbose bool
+}
+
+func (LogCommand) Name() cli.CommandName {
+	return "log"
+}
+
+func (LogCommand) Synopsis() string {
+	return "Show the history of changes to files' tags"
+}
+
+func (LogCommand) Description() string {
+	return `tmsu log [OPTION]... [FILE|TAG]
+
+Shows when each tag was applied to or removed from a file, by which user and
+with which command, oldest first.
+
+If FILE is specified then only the changes to that file are shown, including
+those made whilst it had a different path; if TAG then only the changes to that
+tag. An argument that names an existing tag is taken to be a TAG, otherwise a
+FILE: use --file or --tag to choose explicitly, such as for a deleted tag.
+
+    $ tmsu log mountain.jpg
+    $ tmsu log --since 2013-05-01 --until 2013-06-01 holiday
+    $ tmsu log --tag status/obsolete
+
+Times are specified in local time as 'YYYY-MM-DD', 'YYYY-MM-DD HH:MM' or
+'YYYY-MM-DD HH:MM:SS'.`
+}
+
+func (LogCommand) Options() cli.Options {
+	return cli.Options{{"--since", "-s", "show only the changes made at or after the specified time", true, ""},
+		{"--until", "-u", "show only the changes made before the specified time", true, ""},
+		{"--file", "-f", "treat the argument as a file", false, ""},
+		{"--tag", "-t", "treat the argument as a tag", false, ""}}
+}
+
+func (LogCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{
+		"--since": {},
+		"--until": {}}
+}
+
+func (command LogCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	isFile, isTag := options.HasOption("--file"), options.HasOption("--tag")
+	if isFile && isTag {
+		return fmt.Errorf("--file and --tag cannot be specified together.")
+	}
+	if (isFile || isTag) && len(args) == 0 {
+		return fmt.Errorf("a file or tag must be specified.")
+	}
+
+	since, err := parseLogTime(options, "--since")
+	if err != nil {
+		return err
+	}
+
+	until, err := parseLogTime(options, "--until")
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	if len(args) == 1 && !isFile && !isTag {
+		tag, err := store.TagByName(args[0])
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", args[0], err)
+		}
+
+		isTag = tag != nil
+	}
+
+	var entries database.LogEntries
+
+	switch {
+	case len(args) == 0:
+		if command.verbose {
+			log.Infof("retrieving log.")
+		}
+
+		entries, err = store.LogEntries(since, until)
+	case isTag:
+		if command.verbose {
+			log.Infof("retrieving log for tag '%v'.", args[0])
+		}
+
+		entries, err = store.LogEntriesByTag(args[0], since, until)
+	default:
+		entries, err = command.fileLogEntries(store, args[0], since, until)
+	}
+	if err != nil {
+		return fmt.Errorf("could not retrieve log: %v", err)
+	}
+
+	for _, entry := range entries {
+		log.Printf("%v  %v  %v  %v  %v  (%v)", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.User, entry.Action, entry.Path(), entry.Tag, entry.Command)
+	}
+
+	return nil
+}
+
+// unexported
+
+var logTimeFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func parseLogTime(options cli.Options, name string) (time.Time, error) {
+	if !options.HasOption(name) {
+		return time.Time{}, nil
+	}
+
+	text := options.Get(name).Argument
+	for _, format := range logTimeFormats {
+		if parsed, err := time.ParseInLocation(format, text, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%v': must be of the form 'YYYY-MM-DD [HH:MM[:SS]]'.", text)
+}
+
+// Retrieves the log entries for the file, by its identifier where it is tracked
+// so that the changes made under its previous paths are included.
+func (command LogCommand) fileLogEntries(store *storage.Storage, path string, since, until time.Time) (database.LogEntries, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	if command.verbose {
+		log.Infof("retrieving log for file '%v'.", absPath)
+	}
+
+	if file != nil {
+		return store.LogEntriesByFileId(file.Id, since, until)
+	}
+
+	return store.LogEntriesByPath(absPath, since, until)
+}
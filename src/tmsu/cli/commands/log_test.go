@@ -0,0 +1,204 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+func TestLog(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "apple", "banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (UntagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := (LogCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (LogCommand{}).Exec(cli.Options{}, []string{"banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (LogCommand{}).Exec(cli.Options{cli.Option{"--since", "-s", "", true, "2099-01-01"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := []string{"tag /tmp/tmsu/a apple",
+		"tag /tmp/tmsu/a banana",
+		"untag /tmp/tmsu/a banana",
+		"tag /tmp/tmsu/a banana",
+		"tag /tmp/tmsu/b banana",
+		"untag /tmp/tmsu/a banana"}
+
+	lines := strings.Split(strings.TrimRight(string(bytes), "\n"), "\n")
+	if len(lines) != len(expected) {
+		test.Fatalf("Expected %v log entries but got %v: %v", len(expected), len(lines), lines)
+	}
+
+	for index, line := range lines {
+		fields := strings.Split(line, "  ")
+		if len(fields) != 6 {
+			test.Fatalf("Unexpected log entry format: '%v'.", line)
+		}
+
+		if actual := strings.Join(fields[2:5], " "); actual != expected[index] {
+			test.Fatalf("Expected log entry '%v' but got '%v'.", expected[index], actual)
+		}
+	}
+}
+
+func TestLogHierarchicalTagAndMovedFile(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a", "status/todo"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Rename("/tmp/tmsu/a", "/tmp/tmsu/b"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (RepairCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/b", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := log.Outfile.Truncate(0); err != nil {
+		test.Fatal(err)
+	}
+	log.Outfile.Seek(0, 0)
+
+	// test
+
+	if err := (LogCommand{}).Exec(cli.Options{}, []string{"status/todo"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (LogCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (LogCommand{}).Exec(cli.Options{cli.Option{"--tag", "-t", "", false, ""}}, []string{"/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := []string{"tag /tmp/tmsu/a status/todo",
+		"tag /tmp/tmsu/a status/todo",
+		"tag /tmp/tmsu/b done"}
+
+	lines := strings.Split(strings.TrimRight(string(bytes), "\n"), "\n")
+	if len(lines) != len(expected) {
+		test.Fatalf("Expected %v log entries but got %v: %v", len(expected), len(lines), lines)
+	}
+
+	for index, line := range lines {
+		fields := strings.Split(line, "  ")
+		if len(fields) != 6 {
+			test.Fatalf("Unexpected log entry format: '%v'.", line)
+		}
+
+		if actual := strings.Join(fields[2:5], " "); actual != expected[index] {
+			test.Fatalf("Expected log entry '%v' but got '%v'.", expected[index], actual)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"tmsu/cli"
 	"tmsu/log"
 	"tmsu/storage"
+	"tmsu/storage/database"
 )
 
 type MergeCommand struct {
@@ -81,51 +82,78 @@ func (command MergeCommand) Exec(options cli.Options, args []string) error {
 			return fmt.Errorf("no such tag '%v'.", sourceTagName)
 		}
 
-		if command.verbose {
-			log.Infof("finding files tagged '%v'.", sourceTagName)
+		descendants, err := store.TagDescendants(sourceTagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve descendants of tag '%v': %v", sourceTagName, err)
+		}
+		if len(descendants) > 0 {
+			return fmt.Errorf("cannot merge tag '%v' as it has descendant tags.", sourceTagName)
 		}
 
-		fileTags, err := store.FileTagsByTagId(sourceTag.Id)
+		err = store.InTransaction(func() error {
+			return command.mergeTag(store, sourceTag, destTag)
+		})
 		if err != nil {
-			return fmt.Errorf("could not retrieve files for tag '%v': %v", sourceTagName, err)
+			return err
 		}
+	}
 
-		if command.verbose {
-			log.Infof("applying tag '%v' to these files.", destTagName)
-		}
+	return nil
+}
 
-		for _, fileTag := range fileTags {
-			_, err = store.AddFileTag(fileTag.FileId, destTag.Id)
-			if err != nil {
-				return fmt.Errorf("could not apply tag '%v' to file #%v: %v", destTagName, fileTag.FileId, err)
-			}
-		}
+// Merges the source tag into the destination tag. Files are untagged before
+// being tagged with the destination tag so that merging tags from the same tag
+// group is permitted.
+func (command MergeCommand) mergeTag(store *storage.Storage, sourceTag, destTag *database.Tag) error {
+	sourceTagName := sourceTag.Name
+	destTagName := destTag.Name
 
-		if command.verbose {
-			log.Infof("untagging files '%v'.", sourceTagName)
-		}
+	if command.verbose {
+		log.Infof("finding files tagged '%v'.", sourceTagName)
+	}
 
-		if err := store.RemoveFileTagsByTagId(sourceTag.Id); err != nil {
-			return fmt.Errorf("could not remove all applications of tag '%v': %v", sourceTagName, err)
-		}
+	fileTags, err := store.FileTagsByTagId(sourceTag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files for tag '%v': %v", sourceTagName, err)
+	}
 
-		if command.verbose {
-			log.Infof("updating tag implications involving tag '%v'.", sourceTagName)
-		}
+	if command.verbose {
+		log.Infof("updating tag groups featuring tag '%v'.", sourceTagName)
+	}
 
-		if err := store.UpdateImplicationsForTagId(sourceTag.Id, destTag.Id); err != nil {
-			return fmt.Errorf("could not update tag implications involving tag '%v': %v", sourceTagName, err)
-		}
+	if err := store.UpdateTagGroupsForTagId(sourceTag.Id, destTag.Id); err != nil {
+		return fmt.Errorf("could not update tag groups featuring tag '%v': %v", sourceTagName, err)
+	}
+
+	if command.verbose {
+		log.Infof("retagging files tagged '%v' with tag '%v'.", sourceTagName, destTagName)
+	}
 
-		if command.verbose {
-			log.Infof("deleting tag '%v'.", sourceTagName)
+	for _, fileTag := range fileTags {
+		if err := store.RemoveFileTag(fileTag.FileId, sourceTag.Id); err != nil {
+			return fmt.Errorf("could not remove tag '%v' from file #%v: %v", sourceTagName, fileTag.FileId, err)
 		}
 
-		err = store.DeleteTag(sourceTag.Id)
-		if err != nil {
-			return fmt.Errorf("could not delete tag '%v': %v", sourceTagName, err)
+		if _, err := store.AddFileTag(fileTag.FileId, destTag.Id); err != nil {
+			return fmt.Errorf("could not apply tag '%v' to file #%v: %v", destTagName, fileTag.FileId, err)
 		}
 	}
 
+	if command.verbose {
+		log.Infof("updating tag implications involving tag '%v'.", sourceTagName)
+	}
+
+	if err := store.UpdateImplicationsForTagId(sourceTag.Id, destTag.Id); err != nil {
+		return fmt.Errorf("could not update tag implications involving tag '%v': %v", sourceTagName, err)
+	}
+
+	if command.verbose {
+		log.Infof("deleting tag '%v'.", sourceTagName)
+	}
+
+	if err := store.DeleteTag(sourceTag.Id); err != nil {
+		return fmt.Errorf("could not delete tag '%v': %v", sourceTagName, err)
+	}
+
 	return nil
 }
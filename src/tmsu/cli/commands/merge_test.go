@@ -19,6 +19,7 @@ package commands
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 	"tmsu/cli"
@@ -38,22 +39,22 @@ func TestMergeSingleTag(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileA1, err := store.AddFile("/tmp/a/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileA1, err := store.AddFile("/tmp/a/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB1, err := store.AddFile("/tmp/b/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileB1, err := store.AddFile("/tmp/b/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -128,32 +129,32 @@ func TestMergeMultipleTags(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileA1, err := store.AddFile("/tmp/a/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileA1, err := store.AddFile("/tmp/a/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileB1, err := store.AddFile("/tmp/b/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileB1, err := store.AddFile("/tmp/b/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileC1, err := store.AddFile("/tmp/c/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	fileC1, err := store.AddFile("/tmp/c/1", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -316,3 +317,147 @@ func TestMergeSourceAndDestinationTheSame(test *testing.T) {
 		test.Fatal("Expected source and destination the same tag to be identified.")
 	}
 }
+
+func TestMergeRespectsTagGroups(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fooTag, err := store.AddTag("foo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rating3Tag, err := store.AddTag("rating-3")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rating4Tag, err := store.AddTag("rating-4")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTagGroupMembers("rating", []uint{rating3Tag.Id, rating4Tag.Id}); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, fooTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileA.Id, rating3Tag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, rating3Tag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, rating4Tag.Id); err == nil {
+		test.Fatal("Mutually exclusive tag was applied by storage.")
+	}
+
+	command := MergeCommand{false}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"foo", "rating-4"}); err == nil {
+		test.Fatal("Merge into a tag group member did not report the conflict.")
+	}
+
+	expectTags(test, store, fileA, fooTag, rating3Tag)
+
+	if err := command.Exec(cli.Options{}, []string{"rating-3", "rating-4"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectTags(test, store, fileA, fooTag, rating4Tag)
+	expectTags(test, store, fileB, rating4Tag)
+}
+
+func TestMergeRemovesSelfImplyingCompoundImplications(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "dest", "source", "x", "y"); err != nil {
+		test.Fatal(err)
+	}
+
+	destTag, _ := store.TagByName("dest")
+	sourceTag, _ := store.TagByName("source")
+	xTag, _ := store.TagByName("x")
+	yTag, _ := store.TagByName("y")
+
+	if err := store.AddCompoundImplication([]uint{destTag.Id, xTag.Id}, sourceTag.Id, false); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddCompoundImplication([]uint{destTag.Id, xTag.Id}, sourceTag.Id, true); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddCompoundImplication([]uint{sourceTag.Id, xTag.Id}, yTag.Id, false); err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileA.Id, destTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileA.Id, xTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := MergeCommand{false}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"source", "dest"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	implications, err := store.CompoundImplications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 1 || implications[0].ImpliedTag.Name != "y" || implications[0].Negated {
+		test.Fatalf("Expected only the implication of 'y' to remain but were %v implications.", len(implications))
+	}
+
+	tagNames := make([]string, len(implications[0].ImplyingTags))
+	for index, tag := range implications[0].ImplyingTags {
+		tagNames[index] = tag.Name
+	}
+	if strings.Join(tagNames, " ") != "dest x" {
+		test.Fatalf("Expected 'y' to be implied by 'dest' and 'x' but was implied by %v.", tagNames)
+	}
+}
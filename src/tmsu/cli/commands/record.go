@@ -0,0 +1,81 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"tmsu/cli"
+	"tmsu/log"
+)
+
+// A machine-readable description of the status of a path, as output by the
+// 'repair' and 'status' commands when run with --format=json.
+type pathRecord struct {
+	Status         string `json:"status"`
+	Path           string `json:"path"`
+	OldPath        string `json:"old_path,omitempty"`
+	NewPath        string `json:"new_path,omitempty"`
+	OldFingerprint string `json:"old_fingerprint,omitempty"`
+	NewFingerprint string `json:"new_fingerprint,omitempty"`
+	FileId         uint   `json:"file_id,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+}
+
+// Writes the record as a single line of JSON. The paths are made absolute so
+// that they do not depend upon the working directory.
+func printRecord(record pathRecord) error {
+	for _, path := range []*string{&record.Path, &record.OldPath, &record.NewPath} {
+		if *path == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(*path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", *path, err)
+		}
+		*path = absPath
+	}
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("%v: could not format record: %v", record.Path, err)
+	}
+
+	log.Print(string(bytes))
+
+	return nil
+}
+
+// Determines whether JSON output was requested via the --format option.
+func jsonFormat(options cli.Options) (bool, error) {
+	if !options.HasOption("--format") {
+		return false, nil
+	}
+
+	format := options.Get("--format").Argument
+	switch format {
+	case "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+
+	return false, fmt.Errorf("invalid format '%v': must be one of text or json.", format)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package commands
+
+import (
+	"fmt"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+type RedoCommand struct {
+	verbose bool
+}
+
+func (RedoCommand) Name() cli.CommandName {
+	return "redo"
+}
+
+func (RedoCommand) Synopsis() string {
+	return "Redo the most recently undone change"
+}
+
+func (RedoCommand) Description() string {
+	return `tmsu redo [COUNT]
+
+Reapplies the changes of the most recently undone command, or the COUNT most
+recently undone commands. Undone commands can only be redone until another
+change is made.`
+}
+
+func (RedoCommand) Options() cli.Options {
+	return cli.Options{}
+}
+
+func (command RedoCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	count, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	for index := 0; index < count; index++ {
+		operation, err := store.Redo()
+		if err != nil {
+			return fmt.Errorf("could not redo: %v", err)
+		}
+		if operation == nil {
+			return fmt.Errorf("nothing to redo.")
+		}
+
+		log.Infof("redid '%v'.", operation.Description)
+	}
+
+	return nil
+}
@@ -66,9 +66,12 @@ func (command RenameCommand) Exec(options cli.Options, args []string) error {
 		return fmt.Errorf("too many arguments")
 	}
 
-	sourceTagName := args[0]
-	destTagName := args[1]
+	return command.renameTag(store, args[0], args[1])
+}
+
+// unexported
 
+func (command RenameCommand) renameTag(store *storage.Storage, sourceTagName, destTagName string) error {
 	sourceTag, err := store.TagByName(sourceTagName)
 	if err != nil {
 		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err)
@@ -38,12 +38,12 @@ func TestRenameSuccessful(test *testing.T) {
 	}
 	defer store.Close()
 
-	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	fileAB, err := store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	fileAB, err := store.AddFile("/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, true, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -123,7 +123,7 @@ func TestRenameInvalidDestTag(test *testing.T) {
 
 	// test
 
-	err := command.Exec(cli.Options{}, []string{"source", "slash/invalid"})
+	err := command.Exec(cli.Options{}, []string{"source", "slash//invalid"})
 
 	// validate
 
@@ -166,3 +166,46 @@ func TestRenameDestTagAlreadyExists(test *testing.T) {
 		test.Fatal("Existing dest tag not identified.")
 	}
 }
+
+func TestRenameDescendants(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	podcastTag, err := store.AddTag("media/audio/podcast")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	command := RenameCommand{false}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"media", "library/media"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(tags) != 4 {
+		test.Fatalf("Expected 4 tags but are %v.", len(tags))
+	}
+	if tags[0].Name != "library" || tags[1].Name != "library/media" || tags[2].Name != "library/media/audio" || tags[3].Name != "library/media/audio/podcast" {
+		test.Fatalf("Unexpected tags: %v, %v, %v, %v.", tags[0].Name, tags[1].Name, tags[2].Name, tags[3].Name)
+	}
+	if tags[3].Id != podcastTag.Id {
+		test.Fatal("Renamed descendant tag has different ID.")
+	}
+}
@@ -18,10 +18,12 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package commands
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
 	"tmsu/cli"
+	"tmsu/common"
 	"tmsu/fingerprint"
 	"tmsu/log"
 	_path "tmsu/path"
@@ -30,9 +32,17 @@ import (
 )
 
 type RepairCommand struct {
-	verbose bool
-	pretend bool
-	force   bool
+	verbose        bool
+	pretend        bool
+	force          bool
+	searchPaths    []string
+	indexPath      string
+	json           bool
+	pruneFiles     bool
+	pruneTags      bool
+	ignoreUntagged bool
+	followInodes   bool
+	noCache        bool
 }
 
 func (RepairCommand) Name() cli.CommandName {
@@ -60,32 +70,92 @@ Where no PATHS are specified all files in the database are checked.
     1. missing files are only removed from the database when --force is
        specified.
 
-Modified files are identified by a change to the file's modification time or
-file size. These files are repaired by updating the modification time, size and
-fingerprint in the database.
+Modified files are identified by a change to the file's modification time,
+file size or inode number. These files are repaired by updating the
+modification time, size, device and inode numbers and fingerprint in the
+database.
 
-Moved files will only be repaired if a file with the same fingerprint can be
-found under PATHs: this means files that are simultaneously moved and modified
-will not be identified. Where no PATHs are specified, moved files will only be
-identified if moved to a tagged directory.
+Moved files will only be repaired if a file with the same device and inode
+numbers or the same fingerprint can be found under PATHs: this means files that
+are simultaneously moved and modified will not be identified. Files moved within
+a file system are matched by inode without being fingerprinted. Where no PATHs
+are specified, moved files will only be identified if moved to a tagged
+directory.
+
+To find files that have been moved elsewhere, additional directories can be
+searched using --search (which can be repeated) and an index file listing
+candidate paths, one per line, can be specified with --index. (Such a file can
+be produced with, for example, 'find / -type f >index' or 'locate /'.) Only
+candidates of the same size as the missing file are fingerprinted.
 
 Missing files are reported but are not, by default, removed from the database
 as this would destroy the tagging information associated with it. If you do
 wish to clear missing files from the database and destroying the associated
 tagging information then use the --force option.
 
-Untagged files are reported but not added to the database.`
+Untagged files are reported but not added to the database.
+
+Directory listings are cached in the database, as with the status command, so
+that directories that have not changed since the previous scan need not be
+read again. Use --no-cache to bypass the cache.
+
+Once repaired, the database can be pruned of orphaned entries: the
+--prune-untagged-files option removes files that have no tags applied and the
+--prune-unused-tags option removes tags that are neither applied to any file
+nor feature in any tag implication. Pruning applies to the whole database
+irrespective of PATHs.
+
+With --format=json a JSON object is output per line for each path reported,
+with members for the status, absolute path, old and new paths (for moved
+files), old and new fingerprints and the file's database identifier.`
 }
 
 func (RepairCommand) Options() cli.Options {
 	return cli.Options{{"--pretend", "-p", "do not make any changes", false, ""},
-		{"--force", "-f", "remove missing files from the database", false, ""}}
+		{"--force", "-f", "remove missing files from the database", false, ""},
+		{"--search", "-s", "search the specified directory for moved files", true, ""},
+		{"--index", "-i", "search the paths listed in the specified file for moved files", true, ""},
+		{"--format", "-F", "output format: text (default) or json", true, ""},
+		{"--prune-untagged-files", "-u", "remove files that have no tags from the database", false, ""},
+		{"--prune-unused-tags", "-t", "remove tags that are not applied to any file from the database", false, ""},
+		{"--no-cache", "-n", "do not use or update the directory listing cache", false, ""}}
+}
+
+func (RepairCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{
+		"--search": {Files: true},
+		"--index":  {Files: true},
+		"--format": {Values: []string{"text", "json"}}}
 }
 
 func (command RepairCommand) Exec(options cli.Options, args []string) error {
 	command.verbose = options.HasOption("--verbose")
 	command.pretend = options.HasOption("--pretend")
 	command.force = options.HasOption("--force")
+	command.pruneFiles = options.HasOption("--prune-untagged-files")
+	command.pruneTags = options.HasOption("--prune-unused-tags")
+	command.noCache = options.HasOption("--no-cache")
+
+	json, err := jsonFormat(options)
+	if err != nil {
+		return err
+	}
+	command.json = json
+
+	for _, option := range options {
+		if option.LongName == "--search" {
+			searchPath, err := filepath.Abs(option.Argument)
+			if err != nil {
+				return fmt.Errorf("%v: could not get absolute path: %v", option.Argument, err)
+			}
+
+			command.searchPaths = append(command.searchPaths, searchPath)
+		}
+	}
+
+	if options.HasOption("--index") {
+		command.indexPath = options.Get("--index").Argument
+	}
 
 	store, err := storage.Open()
 	if err != nil {
@@ -94,10 +164,27 @@ func (command RepairCommand) Exec(options cli.Options, args []string) error {
 	defer store.Close()
 
 	if len(args) == 0 {
-		return command.repairDatabase(store)
+		err = command.repairDatabase(store)
+	} else {
+		err = command.repairPaths(store, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	if command.pruneFiles {
+		if err := command.pruneUntaggedFiles(store); err != nil {
+			return err
+		}
 	}
 
-	return command.repairPaths(store, args)
+	if command.pruneTags {
+		if err := command.pruneUnusedTags(store); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 //- unexported
@@ -156,17 +243,36 @@ func (command RepairCommand) checkFiles(store *storage.Storage, paths []string)
 	}
 	paths = tree.TopLevel().Paths()
 
-	fsPaths, err := enumerateFileSystemPaths(paths)
+	var cache *scanCache
+	if !command.noCache {
+		cache = newScanCache(store, command.verbose)
+	}
+
+	for _, path := range paths {
+		if err := cache.load(path); err != nil {
+			return err
+		}
+	}
+
+	fsPaths, err := enumerateFileSystemPaths(paths, cache)
 	if err != nil {
 		return err
 	}
 
+	if !command.pretend {
+		cache.save()
+	}
+
 	dbPaths, err := enumerateDatabasePaths(store, paths)
 	if err != nil {
 		return err
 	}
 
-	_, untagged, modified, missing := command.determineStatuses(fsPaths, dbPaths)
+	tagged, untagged, modified, missing := command.determineStatuses(fsPaths, dbPaths)
+
+	if err = command.recordIdentities(store, tagged, fsPaths); err != nil {
+		return err
+	}
 
 	if err = command.repairModified(store, modified); err != nil {
 		return err
@@ -176,46 +282,53 @@ func (command RepairCommand) checkFiles(store *storage.Storage, paths []string)
 		return err
 	}
 
+	if err = command.repairMovedElsewhere(store, missing); err != nil {
+		return err
+	}
+
 	if err = command.repairMissing(store, missing); err != nil {
 		return err
 	}
 
-	for path, _ := range untagged {
-		log.Infof("%v: untagged", path)
+	if command.ignoreUntagged {
+		return nil
 	}
 
-	//TODO cleanup: any files that have no tags: remove
-	//TODO cleanup: any tags that do not correspond to a file: remove
+	for path, _ := range untagged {
+		if err := command.report(pathRecord{Status: "untagged", Path: path}); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 type fileInfoMap map[string]os.FileInfo
-type fileIdAndInfoMap map[string]struct {
-	fileId uint
+type databaseFileAndInfoMap map[string]struct {
+	dbFile database.File
 	stat   os.FileInfo
 }
 type databaseFileMap map[string]database.File
 
-func (command RepairCommand) determineStatuses(fsPaths fileInfoMap, dbPaths databaseFileMap) (tagged databaseFileMap, untagged fileInfoMap, modified fileIdAndInfoMap, missing databaseFileMap) {
+func (command RepairCommand) determineStatuses(fsPaths fileInfoMap, dbPaths databaseFileMap) (tagged databaseFileMap, untagged fileInfoMap, modified databaseFileAndInfoMap, missing databaseFileMap) {
 	if command.verbose {
 		log.Info("determining file statuses")
 	}
 
 	tagged = make(databaseFileMap, 100)
 	untagged = make(fileInfoMap, 100)
-	modified = make(fileIdAndInfoMap, 100)
+	modified = make(databaseFileAndInfoMap, 100)
 	missing = make(databaseFileMap, 100)
 
 	for path, stat := range fsPaths {
 		if dbFile, isTagged := dbPaths[path]; isTagged {
-			if dbFile.ModTime == stat.ModTime().UTC() && dbFile.Size == stat.Size() {
+			if dbFile.ModTime == stat.ModTime().UTC() && dbFile.Size == stat.Size() && !identityChanged(dbFile, stat) {
 				tagged[path] = dbFile
 			} else {
 				modified[path] = struct {
-					fileId uint
+					dbFile database.File
 					stat   os.FileInfo
-				}{dbFile.Id, stat}
+				}{dbFile, stat}
 			}
 		} else {
 			untagged[path] = stat
@@ -231,24 +344,58 @@ func (command RepairCommand) determineStatuses(fsPaths fileInfoMap, dbPaths data
 	return tagged, untagged, modified, missing
 }
 
-func (command RepairCommand) repairModified(store *storage.Storage, modified fileIdAndInfoMap) error {
+func (command RepairCommand) recordIdentities(store *storage.Storage, tagged databaseFileMap, fsPaths fileInfoMap) error {
+	if command.pretend {
+		return nil
+	}
+
+	for path, dbFile := range tagged {
+		if dbFile.Inode != 0 {
+			continue
+		}
+
+		stat := fsPaths[path]
+		device, inode := common.DeviceAndInode(stat)
+		if inode == 0 {
+			continue
+		}
+
+		if command.verbose {
+			log.Infof("%v: recording device and inode numbers", path)
+		}
+
+		_, err := store.UpdateFile(dbFile.Id, path, dbFile.Fingerprint, dbFile.ModTime, dbFile.Size, dbFile.IsDir, device, inode)
+		if err != nil {
+			return fmt.Errorf("%v: could not update file in database: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (command RepairCommand) repairModified(store *storage.Storage, modified databaseFileAndInfoMap) error {
 	if command.verbose {
 		log.Info("repairing modified files")
 	}
 
-	for path, fileIdAndStat := range modified {
-		fileId := fileIdAndStat.fileId
-		stat := fileIdAndStat.stat
-
-		log.Infof("%v: modified", path)
+	for path, dbFileAndStat := range modified {
+		dbFile := dbFileAndStat.dbFile
+		stat := dbFileAndStat.stat
 
 		fingerprint, err := fingerprint.Create(path)
 		if err != nil {
 			return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
 		}
 
+		record := pathRecord{Status: "modified", Path: path, OldFingerprint: string(dbFile.Fingerprint), NewFingerprint: string(fingerprint), FileId: dbFile.Id}
+		if err := command.report(record); err != nil {
+			return err
+		}
+
 		if !command.pretend {
-			_, err := store.UpdateFile(fileId, path, fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			device, inode := common.DeviceAndInode(stat)
+
+			_, err := store.UpdateFile(dbFile.Id, path, fingerprint, stat.ModTime(), stat.Size(), stat.IsDir(), device, inode)
 			if err != nil {
 				return fmt.Errorf("%v: could not update file in database: %v", path, err)
 			}
@@ -266,11 +413,33 @@ func (command RepairCommand) repairMoved(store *storage.Storage, missing databas
 
 	moved := make([]string, 0, 10)
 
+	untaggedByIdentity := make(map[[2]uint64]string, len(untagged))
+	for candidatePath, stat := range untagged {
+		device, inode := common.DeviceAndInode(stat)
+		if inode != 0 {
+			untaggedByIdentity[[2]uint64{device, inode}] = candidatePath
+		}
+	}
+
 	for path, dbFile := range missing {
 		if command.verbose {
 			log.Infof("%v: searching for new location", path)
 		}
 
+		if dbFile.Inode != 0 {
+			candidatePath, found := untaggedByIdentity[[2]uint64{dbFile.Device, dbFile.Inode}]
+			if found && (sameFile(dbFile, untagged[candidatePath]) || command.followInodes) {
+				if err := command.moveFile(store, dbFile, path, candidatePath, untagged[candidatePath]); err != nil {
+					return err
+				}
+
+				moved = append(moved, path)
+				delete(untagged, candidatePath)
+
+				continue
+			}
+		}
+
 		for candidatePath, stat := range untagged {
 			if stat.Size() == dbFile.Size {
 				fingerprint, err := fingerprint.Create(candidatePath)
@@ -279,22 +448,127 @@ func (command RepairCommand) repairMoved(store *storage.Storage, missing databas
 				}
 
 				if fingerprint == dbFile.Fingerprint {
-					log.Infof("%v: moved to %v", path, candidatePath)
+					if err := command.moveFile(store, dbFile, path, candidatePath, stat); err != nil {
+						return err
+					}
 
 					moved = append(moved, path)
+					delete(untagged, candidatePath)
+
+					break
+				}
+			}
+		}
+	}
+
+	for _, path := range moved {
+		delete(missing, path)
+	}
 
-					if !command.pretend {
-						_, err := store.UpdateFile(dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
-						if err != nil {
-							return fmt.Errorf("%v: could not update file in database: %v", path, err)
+	return nil
+}
+
+func (command RepairCommand) repairMovedElsewhere(store *storage.Storage, missing databaseFileMap) error {
+	if len(missing) == 0 || (len(command.searchPaths) == 0 && command.indexPath == "") {
+		return nil
+	}
+
+	if command.verbose {
+		log.Info("searching for files moved elsewhere")
+	}
+
+	candidatePathsBySize := make(map[int64][]string, 100)
+
+	for _, searchPath := range command.searchPaths {
+		if command.verbose {
+			log.Infof("%v: enumerating candidate files", searchPath)
+		}
+
+		if err := enumerateRegularFiles(searchPath, candidatePathsBySize); err != nil {
+			return err
+		}
+	}
+
+	if command.indexPath != "" {
+		if err := enumerateIndexedFiles(command.indexPath, candidatePathsBySize); err != nil {
+			return err
+		}
+	}
+
+	fingerprints := make(map[string]fingerprint.Fingerprint, 100)
+	moved := make([]string, 0, 10)
+
+	for path, dbFile := range missing {
+		if dbFile.IsDir || dbFile.Fingerprint == fingerprint.EMPTY {
+			continue
+		}
+
+		if command.verbose {
+			log.Infof("%v: searching for new location", path)
+		}
+
+		for _, candidatePath := range candidatePathsBySize[dbFile.Size] {
+			fp, found := fingerprints[candidatePath]
+			if found && fp == fingerprint.EMPTY {
+				continue
+			}
+
+			if !found {
+				existingFile, err := store.FileByPath(candidatePath)
+				if err != nil {
+					return fmt.Errorf("%v: could not retrieve file from database: %v", candidatePath, err)
+				}
+				if existingFile != nil {
+					// already tracked so cannot be the new location of another file
+					fingerprints[candidatePath] = fingerprint.EMPTY
+					continue
+				}
+			}
+
+			// a candidate that has since gone or cannot be read is not a match
+			stat, err := os.Stat(candidatePath)
+			if err != nil {
+				if command.verbose {
+					log.Infof("%v: could not stat candidate file: %v", candidatePath, err)
+				}
+
+				fingerprints[candidatePath] = fingerprint.EMPTY
+				continue
+			}
+
+			if !found {
+				if sameFile(dbFile, stat) {
+					// same inode so no need to fingerprint
+					fp = dbFile.Fingerprint
+				} else {
+					fp, err = fingerprint.Create(candidatePath)
+					if err != nil {
+						if command.verbose {
+							log.Infof("%v: could not create fingerprint of candidate file: %v", candidatePath, err)
 						}
+
+						fingerprints[candidatePath] = fingerprint.EMPTY
+						continue
 					}
+				}
 
-					delete(untagged, candidatePath)
+				fingerprints[candidatePath] = fp
+			}
 
-					break
-				}
+			if fp != dbFile.Fingerprint {
+				continue
+			}
+
+			if err := command.moveFile(store, dbFile, path, candidatePath, stat); err != nil {
+				return err
 			}
+
+			moved = append(moved, path)
+
+			// prevent the candidate being matched to a second missing file
+			fingerprints[candidatePath] = fingerprint.EMPTY
+
+			break
 		}
 	}
 
@@ -305,6 +579,41 @@ func (command RepairCommand) repairMoved(store *storage.Storage, missing databas
 	return nil
 }
 
+func (command RepairCommand) moveFile(store *storage.Storage, dbFile database.File, path, newPath string, stat os.FileInfo) error {
+	if err := command.reportMoved(dbFile, path, newPath); err != nil {
+		return err
+	}
+
+	fp := dbFile.Fingerprint
+	if dbFile.Size != stat.Size() || dbFile.ModTime != stat.ModTime().UTC() {
+		// only followed inodes can be both moved and modified
+		newFingerprint, err := fingerprint.Create(newPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %v", newPath, err)
+		}
+
+		record := pathRecord{Status: "modified", Path: newPath, OldFingerprint: string(fp), NewFingerprint: string(newFingerprint), FileId: dbFile.Id}
+		if err := command.report(record); err != nil {
+			return err
+		}
+
+		fp = newFingerprint
+	}
+
+	if command.pretend {
+		return nil
+	}
+
+	device, inode := common.DeviceAndInode(stat)
+
+	_, err := store.UpdateFile(dbFile.Id, newPath, fp, stat.ModTime(), stat.Size(), stat.IsDir(), device, inode)
+	if err != nil {
+		return fmt.Errorf("%v: could not update file in database: %v", path, err)
+	}
+
+	return nil
+}
+
 func (command RepairCommand) repairMissing(store *storage.Storage, missing databaseFileMap) error {
 	for path, dbFile := range missing {
 		if command.force && !command.pretend {
@@ -316,20 +625,111 @@ func (command RepairCommand) repairMissing(store *storage.Storage, missing datab
 				return fmt.Errorf("%v: could not delete file: %v", path, err)
 			}
 
-			log.Infof("%v: removed", path)
+			if err := command.report(pathRecord{Status: "removed", Path: path, OldFingerprint: string(dbFile.Fingerprint), FileId: dbFile.Id}); err != nil {
+				return err
+			}
 		} else {
-			log.Infof("%v: missing", path)
+			if err := command.report(pathRecord{Status: "missing", Path: path, OldFingerprint: string(dbFile.Fingerprint), FileId: dbFile.Id}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (command RepairCommand) pruneUntaggedFiles(store *storage.Storage) error {
+	if command.verbose {
+		log.Info("identifying untagged files")
+	}
+
+	files, err := store.UntaggedFiles()
+	if err != nil {
+		return fmt.Errorf("could not retrieve untagged files: %v", err)
+	}
+
+	for _, file := range files {
+		if err := command.report(pathRecord{Status: "pruned", Path: file.Path(), OldFingerprint: string(file.Fingerprint), FileId: file.Id}); err != nil {
+			return err
+		}
+	}
+
+	if command.pretend || len(files) == 0 {
+		return nil
+	}
+
+	count, err := store.RemoveUntaggedFiles()
+	if err != nil {
+		return fmt.Errorf("could not remove untagged files: %v", err)
+	}
+
+	if command.verbose {
+		log.Infof("removed %v untagged files.", count)
+	}
+
+	return nil
+}
+
+func (command RepairCommand) pruneUnusedTags(store *storage.Storage) error {
+	if command.verbose {
+		log.Info("identifying unused tags")
+	}
+
+	tags, err := store.UnusedTags()
+	if err != nil {
+		return fmt.Errorf("could not retrieve unused tags: %v", err)
+	}
+
+	for _, tag := range tags {
+		if err := command.report(pathRecord{Status: "pruned", Tag: tag.Name}); err != nil {
+			return err
 		}
 	}
 
+	if command.pretend || len(tags) == 0 {
+		return nil
+	}
+
+	count, err := store.DeleteUnusedTags()
+	if err != nil {
+		return fmt.Errorf("could not delete unused tags: %v", err)
+	}
+
+	if command.verbose {
+		log.Infof("deleted %v unused tags.", count)
+	}
+
 	return nil
 }
 
-func enumerateFileSystemPaths(paths []string) (fileInfoMap, error) {
+func (command RepairCommand) reportMoved(dbFile database.File, oldPath, newPath string) error {
+	record := pathRecord{Status: "moved", Path: newPath, OldPath: oldPath, NewPath: newPath, OldFingerprint: string(dbFile.Fingerprint), NewFingerprint: string(dbFile.Fingerprint), FileId: dbFile.Id}
+
+	return command.report(record)
+}
+
+func (command RepairCommand) report(record pathRecord) error {
+	if command.json {
+		return printRecord(record)
+	}
+
+	switch {
+	case record.Status == "moved":
+		log.Infof("%v: moved to %v", record.OldPath, record.NewPath)
+	case record.Tag != "":
+		log.Infof("tag '%v': %v", record.Tag, record.Status)
+	default:
+		log.Infof("%v: %v", record.Path, record.Status)
+	}
+
+	return nil
+}
+
+func enumerateFileSystemPaths(paths []string, cache *scanCache) (fileInfoMap, error) {
 	files := make(fileInfoMap, 100)
 
 	for _, path := range paths {
-		if err := enumerateFileSystemPath(files, path); err != nil {
+		if err := enumerateFileSystemPath(files, path, cache); err != nil {
 			return nil, err
 		}
 	}
@@ -337,7 +737,7 @@ func enumerateFileSystemPaths(paths []string) (fileInfoMap, error) {
 	return files, nil
 }
 
-func enumerateFileSystemPath(files fileInfoMap, path string) error {
+func enumerateFileSystemPath(files fileInfoMap, path string, cache *scanCache) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		switch {
@@ -354,23 +754,49 @@ func enumerateFileSystemPath(files fileInfoMap, path string) error {
 	files[path] = stat
 
 	if stat.IsDir() {
-		file, err := os.Open(path)
+		entries, err := cache.entries(path, stat)
 		if err != nil {
-			return fmt.Errorf("%v: could not open file: %v", path, err)
+			return err
+		}
+
+		for _, entry := range entries {
+			childPath := filepath.Join(path, entry.name)
+			enumerateFileSystemPath(files, childPath, cache)
+		}
+	}
+
+	return nil
+}
+
+func enumerateIndexedFiles(indexPath string, pathsBySize map[int64][]string) error {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not open index: %v", indexPath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		path := scanner.Text()
+		if path == "" || !filepath.IsAbs(path) {
+			continue
 		}
 
-		childFilenames, err := file.Readdirnames(0)
-		file.Close()
+		stat, err := os.Stat(path)
 		if err != nil {
-			return fmt.Errorf("%v: could not read directory: %v", file.Name(), err)
+			// index may be stale
+			continue
 		}
 
-		for _, childFilename := range childFilenames {
-			childPath := filepath.Join(path, childFilename)
-			enumerateFileSystemPath(files, childPath)
+		if common.IsRegular(stat) && stat.Size() > 0 {
+			pathsBySize[stat.Size()] = append(pathsBySize[stat.Size()], path)
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%v: could not read index: %v", indexPath, err)
+	}
+
 	return nil
 }
 
@@ -398,3 +824,27 @@ func enumerateDatabasePaths(store *storage.Storage, paths []string) (databaseFil
 
 	return dbFiles, nil
 }
+
+// Determines whether the file has been replaced by a different file at the
+// same path. Files recorded without an inode number are never considered
+// replaced.
+func identityChanged(dbFile database.File, stat os.FileInfo) bool {
+	if dbFile.Inode == 0 {
+		return false
+	}
+
+	device, inode := common.DeviceAndInode(stat)
+	return device != dbFile.Device || inode != dbFile.Inode
+}
+
+// Determines whether the file on disk is the same, unmodified file as that
+// recorded in the database without needing to fingerprint it.
+func sameFile(dbFile database.File, stat os.FileInfo) bool {
+	if dbFile.Inode == 0 {
+		return false
+	}
+
+	device, inode := common.DeviceAndInode(stat)
+	return device == dbFile.Device && inode == dbFile.Inode &&
+		dbFile.Size == stat.Size() && dbFile.ModTime == stat.ModTime().UTC()
+}
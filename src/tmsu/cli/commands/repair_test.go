@@ -20,7 +20,9 @@ package commands
 import (
 	"io/ioutil"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 	"tmsu/cli"
 	"tmsu/log"
 	"tmsu/storage"
@@ -43,7 +45,7 @@ func TestRepairMovedFile(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/a")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
 		test.Fatal(err)
 	}
@@ -52,7 +54,7 @@ func TestRepairMovedFile(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	command := RepairCommand{false, false, false}
+	command := RepairCommand{}
 
 	// test
 
@@ -76,6 +78,141 @@ func TestRepairMovedFile(test *testing.T) {
 	}
 }
 
+func TestRepairMovedFileElsewhere(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "far away"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := createFile("/tmp/tmsu-elsewhere/x/b", "far afield"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-elsewhere")
+
+	if err := os.Rename("/tmp/tmsu/a", "/tmp/tmsu-elsewhere/x/a"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := RepairCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--search", "-s", "", true, "/tmp/tmsu-elsewhere"}}
+	if err := command.Exec(options, []string{"/tmp/tmsu"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		test.Fatalf("Expected one file but are %v", len(files))
+	}
+
+	if files[0].Path() != "/tmp/tmsu-elsewhere/x/a" {
+		test.Fatalf("File move was not repaired.")
+	}
+
+	tags, err := store.TagsByFileId(files[0].Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "a" {
+		test.Fatalf("Moved file's tags were not retained.")
+	}
+}
+
+func TestRepairMovedFileByInode(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "inode one"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	stat, err := os.Stat("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Rename("/tmp/tmsu/a", "/tmp/tmsu/c"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/c")
+
+	// change the contents in place so that the move can only be identified by inode
+	if err := createFile("/tmp/tmsu/c", "inode two"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chtimes("/tmp/tmsu/c", stat.ModTime(), stat.ModTime()); err != nil {
+		test.Fatal(err)
+	}
+
+	command := RepairCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{"/tmp/tmsu"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		test.Fatalf("Expected one file but are %v", len(files))
+	}
+
+	if files[0].Path() != "/tmp/tmsu/c" {
+		test.Fatalf("File rename was not repaired.")
+	}
+}
+
 func TestRepairModifiedFile(test *testing.T) {
 	// set-up
 
@@ -93,7 +230,7 @@ func TestRepairModifiedFile(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/a")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
 		test.Fatal(err)
 	}
@@ -102,7 +239,7 @@ func TestRepairModifiedFile(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	command := RepairCommand{false, false, false}
+	command := RepairCommand{}
 
 	// test
 
@@ -149,7 +286,7 @@ func TestReportsMissingFiles(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
 		test.Fatal(err)
 	}
@@ -158,7 +295,7 @@ func TestReportsMissingFiles(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	command := RepairCommand{false, false, false}
+	command := RepairCommand{}
 
 	// test
 
@@ -173,3 +310,206 @@ func TestReportsMissingFiles(test *testing.T) {
 	bytes, err := ioutil.ReadAll(log.Outfile)
 	compareOutput(test, "tmsu: New tag 'a'.\ntmsu: /tmp/tmsu/a: missing\n", string(bytes))
 }
+
+func TestRepairReportJson(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "json"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.FileByPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Remove("/tmp/tmsu/a"); err != nil {
+		test.Fatal(err)
+	}
+
+	command := RepairCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--format", "-F", "", true, "json"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	expected := "tmsu: New tag 'a'.\n" +
+		`{"status":"missing","path":"/tmp/tmsu/a","old_fingerprint":"` + string(file.Fingerprint) + `","file_id":` + strconv.Itoa(int(file.Id)) + "}\n"
+	compareOutput(test, expected, string(bytes))
+}
+
+func TestRepairPrune(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "tagged"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "untagged"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	banana, err := store.TagByName("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := store.RemoveFileTagsByTagId(banana.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag("cherry"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag("date"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag("elderberry"); err != nil {
+		test.Fatal(err)
+	}
+	date, err := store.TagByName("date")
+	if err != nil {
+		test.Fatal(err)
+	}
+	elderberry, err := store.TagByName("elderberry")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddImplication(date.Id, elderberry.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	command := RepairCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--prune-untagged-files", "-u", "", false, ""},
+		cli.Option{"--prune-unused-tags", "-t", "", false, ""}}
+	if err := command.Exec(options, []string{"/tmp/tmsu/a", "/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path() != "/tmp/tmsu/a" {
+		test.Fatalf("Expected only '/tmp/tmsu/a' to remain but were %v files.", len(files))
+	}
+
+	tags, err := store.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 3 || tags[0].Name != "apple" || tags[1].Name != "date" || tags[2].Name != "elderberry" {
+		test.Fatalf("Expected tags 'apple', 'date' and 'elderberry' to remain but were %v tags.", len(tags))
+	}
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "tmsu: New tag 'apple'.\ntmsu: New tag 'banana'.\ntmsu: /tmp/tmsu/b: pruned\ntmsu: tag 'banana': pruned\ntmsu: tag 'cherry': pruned\n", string(bytes))
+}
+
+func TestRepairUsesDirectoryCache(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-cache/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-cache")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-cache/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	if err := os.Chtimes("/tmp/tmsu-cache", lastWeek, lastWeek); err != nil {
+		test.Fatal(err)
+	}
+
+	command := RepairCommand{}
+
+	// test
+
+	if err := command.Exec(cli.Options{cli.Option{"--no-cache", "-n", "", false, ""}}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	expectCachedDirectories(test, "/tmp/tmsu-cache")
+
+	if err := command.Exec(cli.Options{}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectCachedDirectories(test, "/tmp/tmsu-cache", "/tmp/tmsu-cache")
+}
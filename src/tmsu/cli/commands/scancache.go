@@ -0,0 +1,200 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common"
+	"tmsu/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+// Directories modified more recently than this are not cached as further
+// changes within the file-system's timestamp granularity would go unnoticed.
+const scanCacheSettleTime = 2 * time.Second
+
+// A persisted cache of directory listings used to avoid re-reading directories
+// that have not changed since the previous scan. A directory is deemed to be
+// unchanged if its device, inode and modification time are as recorded.
+//
+// A nil cache is valid and simply reads every directory.
+type scanCache struct {
+	store       *storage.Storage
+	verbose     bool
+	directories map[string]*database.CachedDirectory
+	updated     database.CachedDirectories
+}
+
+type directoryEntry struct {
+	name  string
+	isDir bool
+}
+
+type directoryEntries []directoryEntry
+
+func (entries directoryEntries) Len() int {
+	return len(entries)
+}
+
+func (entries directoryEntries) Less(i, j int) bool {
+	return entries[i].name < entries[j].name
+}
+
+func (entries directoryEntries) Swap(i, j int) {
+	entries[i], entries[j] = entries[j], entries[i]
+}
+
+func newScanCache(store *storage.Storage, verbose bool) *scanCache {
+	return &scanCache{store, verbose, make(map[string]*database.CachedDirectory, 100), make(database.CachedDirectories, 0, 10)}
+}
+
+// Loads the cached listings for the specified directory and those beneath it.
+func (cache *scanCache) load(path string) error {
+	if cache == nil {
+		return nil
+	}
+
+	directories, err := cache.store.CachedDirectoriesByPath(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve cached directory listings: %v", path, err)
+	}
+
+	for _, directory := range directories {
+		// LIKE is case-insensitive so other directories may be matched
+		if directory.Path == path || strings.HasPrefix(directory.Path, path+"/") || path == "/" {
+			cache.directories[directory.Path] = directory
+		}
+	}
+
+	return nil
+}
+
+// Retrieves the entries of the directory at the specified absolute path, from
+// the cache where the directory is unchanged.
+func (cache *scanCache) entries(path string, stat os.FileInfo) ([]directoryEntry, error) {
+	device, inode := common.DeviceAndInode(stat)
+	modTime := stat.ModTime().UTC()
+
+	if cache != nil {
+		if directory, found := cache.directories[path]; found {
+			// listings left once the scan is complete are stale
+			delete(cache.directories, path)
+
+			if directory.Device == device && directory.Inode == inode && directory.ModTime.Equal(modTime) {
+				if cache.verbose {
+					log.Infof("%v: directory is unchanged.", path)
+				}
+
+				entries := make([]directoryEntry, len(directory.Entries))
+				for index, entry := range directory.Entries {
+					if strings.HasSuffix(entry, "/") {
+						entries[index] = directoryEntry{entry[:len(entry)-1], true}
+					} else {
+						entries[index] = directoryEntry{entry, false}
+					}
+				}
+
+				return entries, nil
+			}
+		}
+	}
+
+	entries, err := readDirectoryEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil && time.Since(modTime) > scanCacheSettleTime {
+		names := make([]string, len(entries))
+		for index, entry := range entries {
+			if entry.isDir {
+				names[index] = entry.name + "/"
+			} else {
+				names[index] = entry.name
+			}
+		}
+
+		cache.updated = append(cache.updated, &database.CachedDirectory{path, device, inode, modTime, names})
+	}
+
+	return entries, nil
+}
+
+// Persists the listings of directories that were read and removes those of
+// directories that were not encountered, which no longer exist. As the cache is
+// merely an optimisation, failure to update it is reported as a warning.
+func (cache *scanCache) save() {
+	if cache == nil {
+		return
+	}
+
+	stale := make([]string, 0, len(cache.directories))
+	for path := range cache.directories {
+		stale = append(stale, path)
+	}
+
+	if cache.verbose {
+		log.Infof("updating %v and removing %v cached directory listings.", len(cache.updated), len(stale))
+	}
+
+	if err := cache.store.UpdateCachedDirectories(cache.updated); err != nil {
+		log.Warnf("could not update cached directory listings: %v", err)
+	} else if err := cache.store.DeleteCachedDirectories(stale); err != nil {
+		log.Warnf("could not remove stale cached directory listings: %v", err)
+	}
+
+	cache.directories = make(map[string]*database.CachedDirectory, 100)
+	cache.updated = make(database.CachedDirectories, 0, 10)
+}
+
+func readDirectoryEntries(path string) ([]directoryEntry, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+	}
+
+	infos, err := dir.Readdir(0)
+	dir.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not read directory listing: %v", path, err)
+	}
+
+	entries := make([]directoryEntry, len(infos))
+	for index, info := range infos {
+		isDir := info.IsDir()
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			// follow symbolic links to determine the type of the target
+			if stat, err := os.Stat(filepath.Join(path, info.Name())); err == nil {
+				isDir = stat.IsDir()
+			}
+		}
+
+		entries[index] = directoryEntry{info.Name(), isDir}
+	}
+
+	sort.Sort(directoryEntries(entries))
+
+	return entries, nil
+}
@@ -0,0 +1,717 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+const defaultServeAddress = "localhost:8686"
+
+type ServeCommand struct {
+	verbose bool
+}
+
+func (ServeCommand) Name() cli.CommandName {
+	return "serve"
+}
+
+func (ServeCommand) Synopsis() string {
+	return "Serve the database over an HTTP JSON API"
+}
+
+func (ServeCommand) Description() string {
+	return `tmsu serve [OPTION]...
+
+Serves the database over an HTTP API that accepts and returns JSON, allowing
+other programs to query and change tags without running tmsu for each file.
+The server listens on ` + defaultServeAddress + ` unless another address is specified.
+
+  GET    /api/files?query=TAG...        files with the tags (-TAG excludes)
+  GET    /api/file?path=PATH            the file's tags
+  POST   /api/file?path=PATH            applies {"tags": [TAG...]}
+  PUT    /api/file?path=PATH            sets the file's tags to {"tags": [...]}
+  DELETE /api/file?path=PATH[&tag=TAG]  removes the tags, or all tags
+  GET    /api/tags                      tags and their file counts
+  PUT    /api/tag?name=TAG              renames the tag to {"name": NEW}
+  DELETE /api/tag?name=TAG              deletes the tag
+  GET    /api/implications              tag implications
+  POST   /api/implications              adds {"tags": [TAG...], "implied": TAG,
+                                        "negated": false}
+  DELETE /api/implications              removes the implication
+  GET    /api/stats                     tag, file and tagging counts
+
+PATHs must be absolute. Errors are returned as {"error": MESSAGE}. Each request
+that changes the database can be undone separately.
+
+Requests that change the database must have a content type of application/json.
+Only requests made to the listen address or to localhost are served and
+requests made by other web sites are refused.
+
+    $ tmsu serve --address localhost:9000
+    $ curl 'localhost:9000/api/files?query=music+-jazz'`
+}
+
+func (ServeCommand) Options() cli.Options {
+	return cli.Options{{"--address", "-a", "the address to listen on", true, ""}}
+}
+
+func (ServeCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{"--address": {}}
+}
+
+func (command ServeCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	address := defaultServeAddress
+	if options.HasOption("--address") {
+		address = options.Get("--address").Argument
+	}
+
+	if command.verbose {
+		log.Infof("listening on %v.", address)
+	}
+
+	if err := http.ListenAndServe(address, newApiHandler(address, command.verbose)); err != nil {
+		return fmt.Errorf("could not serve on %v: %v", address, err)
+	}
+
+	return nil
+}
+
+// unexported
+
+type apiFile struct {
+	Path  string   `json:"path"`
+	IsDir bool     `json:"is_dir"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type apiTag struct {
+	Name      string `json:"name"`
+	FileCount uint   `json:"file_count"`
+}
+
+type apiImplication struct {
+	Tags    []string `json:"tags"`
+	Implied string   `json:"implied"`
+	Negated bool     `json:"negated,omitempty"`
+}
+
+type apiStats struct {
+	Tags     uint `json:"tags"`
+	Files    uint `json:"files"`
+	Taggings uint `json:"taggings"`
+}
+
+type apiTagNames struct {
+	Tags []string `json:"tags"`
+}
+
+type apiRename struct {
+	Name string `json:"name"`
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func (err apiError) Error() string {
+	return err.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return apiError{http.StatusNotFound, fmt.Sprintf(format, args...)}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return apiError{http.StatusForbidden, fmt.Sprintf(format, args...)}
+}
+
+// An API function handles a request using the storage, returning the value to
+// respond with.
+type apiFunc func(store *storage.Storage, request *http.Request) (interface{}, error)
+
+// Serves the API. Requests are handled one at a time, each with its own
+// storage session, such that each request is journaled as a separate operation.
+type apiHandler struct {
+	mux     *http.ServeMux
+	mutex   sync.Mutex
+	address string
+	verbose bool
+}
+
+func newApiHandler(address string, verbose bool) *apiHandler {
+	handler := &apiHandler{mux: http.NewServeMux(), address: address, verbose: verbose}
+
+	handler.handle("/api/files", map[string]apiFunc{"GET": handler.files})
+	handler.handle("/api/file", map[string]apiFunc{"GET": handler.file,
+		"POST":   handler.tagFile,
+		"PUT":    handler.setFileTags,
+		"DELETE": handler.untagFile})
+	handler.handle("/api/tags", map[string]apiFunc{"GET": handler.tags})
+	handler.handle("/api/tag", map[string]apiFunc{"PUT": handler.renameTag,
+		"DELETE": handler.deleteTag})
+	handler.handle("/api/implications", map[string]apiFunc{"GET": handler.implications,
+		"POST":   handler.addImplication,
+		"DELETE": handler.deleteImplication})
+	handler.handle("/api/stats", map[string]apiFunc{"GET": handler.stats})
+
+	return handler
+}
+
+func (handler *apiHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if handler.verbose {
+		log.Infof("%v %v", request.Method, request.URL)
+	}
+
+	if err := checkRequestSource(request, handler.address); err != nil {
+		writeResponse(writer, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	handler.mux.ServeHTTP(writer, request)
+}
+
+func (handler *apiHandler) handle(pattern string, methods map[string]apiFunc) {
+	handler.mux.HandleFunc(pattern, func(writer http.ResponseWriter, request *http.Request) {
+		function, ok := methods[request.Method]
+		if !ok {
+			writeResponse(writer, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed."})
+			return
+		}
+
+		if request.Method != "GET" && !isJsonContent(request) {
+			writeResponse(writer, http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be application/json."})
+			return
+		}
+
+		value, err := handler.call(function, request)
+		if err != nil {
+			status := http.StatusBadRequest
+			if apiErr, ok := err.(apiError); ok {
+				status = apiErr.status
+			}
+
+			writeResponse(writer, status, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(writer, http.StatusOK, value)
+	})
+}
+
+func (handler *apiHandler) call(function apiFunc, request *http.Request) (interface{}, error) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	store, err := storage.Open()
+	if err != nil {
+		return nil, apiError{http.StatusInternalServerError, fmt.Sprintf("could not open storage: %v", err)}
+	}
+	defer store.Close()
+
+	return function(store, request)
+}
+
+// Checks that the request was made to this server, rather than to another name
+// that has been resolved to it, and that it was not made by another web site.
+func checkRequestSource(request *http.Request, address string) error {
+	if !isServedHost(request.Host, address) {
+		return forbidden("host '%v' is not served.", request.Host)
+	}
+
+	if origin := request.Header.Get("Origin"); origin != "" {
+		originUrl, err := url.Parse(origin)
+		if err != nil || originUrl.Host != request.Host {
+			return forbidden("cross-site requests are not permitted.")
+		}
+	}
+
+	switch request.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return forbidden("cross-site requests are not permitted.")
+	}
+
+	return nil
+}
+
+// Determines whether the host is the listen address or the local machine.
+func isServedHost(host, address string) bool {
+	if host == address {
+		return true
+	}
+
+	hostname := host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		hostname = name
+	}
+
+	switch strings.Trim(hostname, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+
+	return false
+}
+
+func isJsonContent(request *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+func writeResponse(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.Warnf("could not write response: %v", err)
+	}
+}
+
+func (handler *apiHandler) files(store *storage.Storage, request *http.Request) (interface{}, error) {
+	files, err := queryFiles(store, strings.Fields(request.URL.Query().Get("query")))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]apiFile, len(files))
+	for index, file := range files {
+		result[index] = apiFile{Path: file.Path(), IsDir: file.IsDir}
+	}
+
+	return result, nil
+}
+
+func (handler *apiHandler) file(store *storage.Storage, request *http.Request) (interface{}, error) {
+	path, err := requestPath(request)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := store.FileByPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		return nil, notFound("%v: file is not tagged.", path)
+	}
+
+	return fileResponse(store, file)
+}
+
+func (handler *apiHandler) tagFile(store *storage.Storage, request *http.Request) (interface{}, error) {
+	path, err := requestPath(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var body apiTagNames
+	if err := decodeBody(request, &body); err != nil {
+		return nil, err
+	}
+	if len(body.Tags) == 0 {
+		return nil, badRequest("tags to apply must be specified.")
+	}
+
+	if err := applyTagNames(store, path, body.Tags, false, handler.verbose); err != nil {
+		return nil, err
+	}
+
+	return handler.file(store, request)
+}
+
+func (handler *apiHandler) setFileTags(store *storage.Storage, request *http.Request) (interface{}, error) {
+	path, err := requestPath(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var body apiTagNames
+	if err := decodeBody(request, &body); err != nil {
+		return nil, err
+	}
+
+	if len(body.Tags) == 0 {
+		if err := (UntagCommand{verbose: handler.verbose}).untagPathAll(store, path); err != nil {
+			return nil, err
+		}
+
+		return apiFile{Path: path, Tags: []string{}}, nil
+	}
+
+	if err := store.InTransaction(func() error {
+		return setTagNames(store, path, body.Tags, handler.verbose)
+	}); err != nil {
+		return nil, err
+	}
+
+	return handler.file(store, request)
+}
+
+func (handler *apiHandler) untagFile(store *storage.Storage, request *http.Request) (interface{}, error) {
+	path, err := requestPath(request)
+	if err != nil {
+		return nil, err
+	}
+
+	command := UntagCommand{verbose: handler.verbose}
+
+	tagNames := request.URL.Query()["tag"]
+	if len(tagNames) == 0 {
+		if err := command.untagPathAll(store, path); err != nil {
+			return nil, err
+		}
+	} else {
+		tagIds, err := command.lookupTagIds(store, tagNames)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := command.untagPath(store, path, tagIds); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := store.FileByPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		return apiFile{Path: path, Tags: []string{}}, nil
+	}
+
+	return fileResponse(store, file)
+}
+
+func (handler *apiHandler) tags(store *storage.Storage, request *http.Request) (interface{}, error) {
+	return tagCounts(store)
+}
+
+func (handler *apiHandler) renameTag(store *storage.Storage, request *http.Request) (interface{}, error) {
+	name, err := requestTagName(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var body apiRename
+	if err := decodeBody(request, &body); err != nil {
+		return nil, err
+	}
+	if body.Name == "" {
+		return nil, badRequest("new name must be specified.")
+	}
+
+	if err := (RenameCommand{verbose: handler.verbose}).renameTag(store, name, body.Name); err != nil {
+		return nil, err
+	}
+
+	return apiRename{body.Name}, nil
+}
+
+func (handler *apiHandler) deleteTag(store *storage.Storage, request *http.Request) (interface{}, error) {
+	name, err := requestTagName(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (DeleteCommand{verbose: handler.verbose}).deleteTag(store, name); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, nil
+}
+
+func (handler *apiHandler) implications(store *storage.Storage, request *http.Request) (interface{}, error) {
+	implications, err := store.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	compoundImplications, err := store.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	result := make([]apiImplication, 0, len(implications)+len(compoundImplications))
+	for _, implication := range implications {
+		result = append(result, apiImplication{[]string{implication.ImplyingTag.Name}, implication.ImpliedTag.Name, false})
+	}
+	for _, implication := range compoundImplications {
+		result = append(result, apiImplication{tagNamesOf(implication.ImplyingTags), implication.ImpliedTag.Name, implication.Negated})
+	}
+
+	return result, nil
+}
+
+func (handler *apiHandler) addImplication(store *storage.Storage, request *http.Request) (interface{}, error) {
+	args, err := implicationArgs(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (ImplyCommand{verbose: handler.verbose}).addImplication(store, args); err != nil {
+		return nil, err
+	}
+
+	return handler.implications(store, request)
+}
+
+func (handler *apiHandler) deleteImplication(store *storage.Storage, request *http.Request) (interface{}, error) {
+	args, err := implicationArgs(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (ImplyCommand{verbose: handler.verbose}).deleteImplication(store, args); err != nil {
+		return nil, err
+	}
+
+	return handler.implications(store, request)
+}
+
+func (handler *apiHandler) stats(store *storage.Storage, request *http.Request) (interface{}, error) {
+	tagCount, err := store.TagCount()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag count: %v", err)
+	}
+
+	fileCount, err := store.FileCount()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file count: %v", err)
+	}
+
+	fileTagCount, err := store.FileTagCount()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve taggings count: %v", err)
+	}
+
+	return apiStats{tagCount, fileCount, fileTagCount}, nil
+}
+
+// Applies the tags to the path as the 'tag' command would, including the
+// auto-tagging rules for files not yet in the database.
+// Applies the tags to the file. With replace, the file's tags that share a tag
+// group with any of the tags are removed.
+func applyTagNames(store *storage.Storage, path string, tagNames []string, replace, verbose bool) error {
+	rules, err := loadRules("")
+	if err != nil {
+		return err
+	}
+
+	command := TagCommand{verbose: verbose, replace: replace, rules: rules}
+
+	tagIds, err := command.lookupTagIds(store, tagNames)
+	if err != nil {
+		return err
+	}
+
+	return command.tagPath(store, path, tagIds)
+}
+
+// Sets the file's explicit tags to those specified. The tags that are to go are
+// removed first so that a tag can be exchanged for another of its tag group.
+func setTagNames(store *storage.Storage, path string, tagNames []string, verbose bool) error {
+	file, err := fileOrLinkedFile(store, path)
+	if err != nil {
+		return err
+	}
+
+	if file != nil {
+		tags, err := store.ExplicitTagsByFileId(file.Id)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve tags: %v", path, err)
+		}
+
+		for _, tag := range tags {
+			if containsString(tagNames, tag.Name) {
+				continue
+			}
+
+			if verbose {
+				log.Infof("%v: removing tag '%v'.", path, tag.Name)
+			}
+
+			if err := store.RemoveFileTag(file.Id, tag.Id); err != nil {
+				return fmt.Errorf("%v: could not remove tag '%v': %v", path, tag.Name, err)
+			}
+		}
+	}
+
+	return applyTagNames(store, path, tagNames, false, verbose)
+}
+
+// Retrieves the files with the tags of the query, where a tag prefixed with '-'
+// is excluded, or all files for an empty query.
+func queryFiles(store *storage.Storage, query []string) (database.Files, error) {
+	if len(query) == 0 {
+		files, err := store.Files()
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve files: %v", err)
+		}
+
+		return files, nil
+	}
+
+	includeTagIds := make([]uint, 0)
+	excludeTagIds := make([]uint, 0)
+	for _, tagName := range query {
+		include := tagName[0] != '-'
+		if !include {
+			tagName = tagName[1:]
+		}
+
+		tag, err := store.TagByName(tagName)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return nil, notFound("no such tag '%v'.", tagName)
+		}
+
+		if include {
+			includeTagIds = append(includeTagIds, tag.Id)
+		} else {
+			excludeTagIds = append(excludeTagIds, tag.Id)
+		}
+	}
+
+	files, err := store.FilesWithTags(includeTagIds, excludeTagIds)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	return files, nil
+}
+
+// Retrieves the tags along with the number of files each is applied to.
+func tagCounts(store *storage.Storage) ([]apiTag, error) {
+	tags, err := store.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	result := make([]apiTag, len(tags))
+	for index, tag := range tags {
+		count, err := store.FileCountWithTag(tag.Id)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file count for tag '%v': %v", tag.Name, err)
+		}
+
+		result[index] = apiTag{tag.Name, count}
+	}
+
+	return result, nil
+}
+
+func fileResponse(store *storage.Storage, file *database.File) (interface{}, error) {
+	tags, err := (TagsCommand{}).tagsForPath(store, file.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := tagNamesOf(tags)
+	sort.Strings(tagNames)
+
+	return apiFile{file.Path(), file.IsDir, tagNames}, nil
+}
+
+func requestPath(request *http.Request) (string, error) {
+	path := request.URL.Query().Get("path")
+	if path == "" {
+		return "", badRequest("path must be specified.")
+	}
+	if !filepath.IsAbs(path) {
+		return "", badRequest("%v: path must be absolute.", path)
+	}
+
+	return filepath.Clean(path), nil
+}
+
+func requestTagName(request *http.Request) (string, error) {
+	name := request.URL.Query().Get("name")
+	if name == "" {
+		return "", badRequest("tag name must be specified.")
+	}
+
+	return name, nil
+}
+
+func decodeBody(request *http.Request, value interface{}) error {
+	if err := json.NewDecoder(request.Body).Decode(value); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+
+	return nil
+}
+
+// Converts the requested implication into the 'imply' command's arguments.
+func implicationArgs(request *http.Request) ([]string, error) {
+	var body apiImplication
+	if err := decodeBody(request, &body); err != nil {
+		return nil, err
+	}
+	if len(body.Tags) == 0 || body.Implied == "" {
+		return nil, badRequest("implying and implied tags must be specified.")
+	}
+
+	args := make([]string, 0, 2*len(body.Tags)+1)
+	for index, tagName := range body.Tags {
+		if index > 0 {
+			args = append(args, "and")
+		}
+		args = append(args, tagName)
+	}
+	if body.Negated {
+		args = append(args, "not")
+	}
+
+	return append(args, body.Implied), nil
+}
+
+func tagNamesOf(tags database.Tags) []string {
+	names := make([]string, len(tags))
+	for index, tag := range tags {
+		names[index] = tag.Name
+	}
+
+	return names
+}
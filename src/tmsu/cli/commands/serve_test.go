@@ -0,0 +1,297 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"tmsu/cli"
+	"tmsu/storage"
+)
+
+func TestServeFileTags(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	server := httptest.NewServer(newApiHandler("localhost:8686", false))
+	defer server.Close()
+
+	// test & validate
+
+	var file apiFile
+	expectResponse(test, server, "POST", "/api/file?path=/tmp/tmsu/a", `{"tags": ["apple", "banana"]}`, http.StatusOK, &file)
+	expectValue(test, apiFile{"/tmp/tmsu/a", false, []string{"apple", "banana"}}, file)
+
+	expectResponse(test, server, "POST", "/api/file?path=/tmp/tmsu/b", `{"tags": ["banana"]}`, http.StatusOK, &file)
+
+	var files []apiFile
+	expectResponse(test, server, "GET", "/api/files?query=banana+-apple", "", http.StatusOK, &files)
+	expectValue(test, []apiFile{{"/tmp/tmsu/b", false, nil}}, files)
+
+	file = apiFile{}
+	expectResponse(test, server, "PUT", "/api/file?path=/tmp/tmsu/a", `{"tags": ["banana", "cherry"]}`, http.StatusOK, &file)
+	expectValue(test, apiFile{"/tmp/tmsu/a", false, []string{"banana", "cherry"}}, file)
+
+	var tags []apiTag
+	expectResponse(test, server, "GET", "/api/tags", "", http.StatusOK, &tags)
+	expectValue(test, []apiTag{{"apple", 0}, {"banana", 2}, {"cherry", 1}}, tags)
+
+	file = apiFile{}
+	expectResponse(test, server, "DELETE", "/api/file?path=/tmp/tmsu/a&tag=banana", "", http.StatusOK, &file)
+	expectValue(test, apiFile{"/tmp/tmsu/a", false, []string{"cherry"}}, file)
+
+	expectResponse(test, server, "DELETE", "/api/file?path=/tmp/tmsu/a", "", http.StatusOK, &file)
+	expectResponse(test, server, "GET", "/api/file?path=/tmp/tmsu/a", "", http.StatusNotFound, nil)
+
+	var stats apiStats
+	expectResponse(test, server, "GET", "/api/stats", "", http.StatusOK, &stats)
+	expectValue(test, apiStats{3, 1, 1}, stats)
+}
+
+func TestServeTagsAndImplications(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := addTags(store, "trip", "published"); err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(newApiHandler("localhost:8686", false))
+	defer server.Close()
+
+	expectResponse(test, server, "POST", "/api/file?path=/tmp/tmsu/a", `{"tags": ["2013", "holiday", "draft"]}`, http.StatusOK, nil)
+
+	// test & validate
+
+	var implications []apiImplication
+	expectResponse(test, server, "POST", "/api/implications", `{"tags": ["holiday"], "implied": "trip"}`, http.StatusOK, nil)
+	expectResponse(test, server, "POST", "/api/implications", `{"tags": ["draft"], "implied": "published", "negated": true}`, http.StatusOK, &implications)
+	expectValue(test, []apiImplication{{[]string{"holiday"}, "trip", false}, {[]string{"draft"}, "published", true}}, implications)
+
+	var file apiFile
+	expectResponse(test, server, "GET", "/api/file?path=/tmp/tmsu/a", "", http.StatusOK, &file)
+	expectValue(test, []string{"2013", "draft", "holiday", "trip"}, file.Tags)
+
+	expectResponse(test, server, "PUT", "/api/tag?name=holiday", `{"name": "vacation"}`, http.StatusOK, nil)
+	expectResponse(test, server, "PUT", "/api/tag?name=missing", `{"name": "other"}`, http.StatusBadRequest, nil)
+
+	implications = nil
+	expectResponse(test, server, "DELETE", "/api/implications", `{"tags": ["vacation"], "implied": "trip"}`, http.StatusOK, &implications)
+	expectValue(test, []apiImplication{{[]string{"draft"}, "published", true}}, implications)
+
+	expectResponse(test, server, "DELETE", "/api/tag?name=2013", "", http.StatusOK, nil)
+
+	file = apiFile{}
+	expectResponse(test, server, "GET", "/api/file?path=/tmp/tmsu/a", "", http.StatusOK, &file)
+	expectValue(test, []string{"draft", "vacation"}, file.Tags)
+
+	expectResponse(test, server, "GET", "/api/file?path=relative", "", http.StatusBadRequest, nil)
+	expectResponse(test, server, "PATCH", "/api/tags", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestServeReplacesGroupedTag(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := (GroupCommand{}).Exec(cli.Options{}, []string{"rating", "rating-3", "rating-4"}); err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(newApiHandler("localhost:8686", false))
+	defer server.Close()
+
+	expectResponse(test, server, "POST", "/api/file?path=/tmp/tmsu/a", `{"tags": ["apple", "rating-3"]}`, http.StatusOK, nil)
+
+	// test
+
+	var file apiFile
+	expectResponse(test, server, "PUT", "/api/file?path=/tmp/tmsu/a", `{"tags": ["apple", "rating-4"]}`, http.StatusOK, &file)
+
+	// validate
+
+	expectValue(test, []string{"apple", "rating-4"}, file.Tags)
+
+	// test
+
+	expectResponse(test, server, "PUT", "/api/file?path=/tmp/tmsu/a", `{"tags": ["banana", "rating-3", "rating-4"]}`, http.StatusBadRequest, nil)
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "rating-4")
+}
+
+func TestServeRefusesCrossSiteRequests(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	server := httptest.NewServer(newApiHandler("localhost:8686", false))
+	defer server.Close()
+
+	// test
+
+	body := `{"tags": ["apple"]}`
+	expectRequestStatus(test, server, "POST", "/api/file?path=/tmp/tmsu/a", body, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType)
+	expectRequestStatus(test, server, "POST", "/api/file?path=/tmp/tmsu/a", body, map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}, http.StatusForbidden)
+	expectRequestStatus(test, server, "POST", "/api/file?path=/tmp/tmsu/a", body, map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden)
+	expectRequestStatus(test, server, "GET", "/api/file?path=/tmp/tmsu/a", "", map[string]string{"Host": "evil.example:8686"}, http.StatusForbidden)
+	expectRequestStatus(test, server, "GET", "/api/stats", "", map[string]string{"Host": "localhost:8686", "Origin": "http://localhost:8686"}, http.StatusOK)
+
+	// validate
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	count, err := store.FileTagCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 0 {
+		test.Fatalf("Expected no taggings but got %v.", count)
+	}
+}
+
+func expectResponse(test *testing.T, server *httptest.Server, method, url, body string, status int, value interface{}) {
+	request, err := http.NewRequest(method, server.URL+url, strings.NewReader(body))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if method != "GET" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != status {
+		test.Fatalf("%v %v: expected status %v but got %v.", method, url, status, response.StatusCode)
+	}
+
+	if value != nil {
+		if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+			test.Fatalf("%v %v: could not decode response: %v", method, url, err)
+		}
+	}
+}
+
+func expectRequestStatus(test *testing.T, server *httptest.Server, method, url, body string, headers map[string]string, status int) {
+	request, err := http.NewRequest(method, server.URL+url, strings.NewReader(body))
+	if err != nil {
+		test.Fatal(err)
+	}
+	for name, value := range headers {
+		if name == "Host" {
+			request.Host = value
+		} else {
+			request.Header.Set(name, value)
+		}
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		test.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != status {
+		test.Fatalf("%v %v %v: expected status %v but got %v.", method, url, headers, status, response.StatusCode)
+	}
+}
+
+func expectValue(test *testing.T, expected, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		test.Fatalf("Expected %#v but got %#v.", expected, actual)
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tmsu/cli"
+	"tmsu/common"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+// The number of lines of history loaded into the shell.
+const historyLength = 1000
+
+type ShellCommand struct {
+	Commands map[cli.CommandName]cli.Command
+	Parser   *cli.Parser
+	verbose  bool
+}
+
+func (ShellCommand) Name() cli.CommandName {
+	return "shell"
+}
+
+func (ShellCommand) Synopsis() string {
+	return "Run tmsu commands interactively"
+}
+
+func (ShellCommand) Description() string {
+	return `tmsu shell
+
+Reads and runs tmsu commands, one per line, without the leading 'tmsu'. The
+database is opened once for the whole session, so that many commands in
+succession run quickly. Each command can still be undone separately.
+
+    $ tmsu shell
+    tmsu> tag song.mp3 music rock
+    tmsu> files music
+    tmsu> exit
+
+Words containing spaces can be quoted or the spaces escaped with a backslash.
+Tab completes command names, options, tag names and paths and the up and down
+arrow keys recall previous commands. The command history is saved to
+~/.tmsu/history, or to the path in the TMSU_HISTORY environment variable.
+
+The commands cannot read files from standard input.
+
+Enter 'exit' or press Ctrl+D to leave the shell.`
+}
+
+func (ShellCommand) Options() cli.Options {
+	return cli.Options{}
+}
+
+func (command ShellCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	if err := storage.Share(); err != nil {
+		return err
+	}
+	defer storage.Unshare()
+
+	commandLine := storage.CommandLine
+	defer func() { storage.CommandLine = commandLine }()
+
+	reader := cli.NewLineReader(os.Stdin, os.Stdout, "tmsu> ")
+	reader.Completer = command.complete
+
+	historyPath, err := common.GetHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	if err := command.loadHistory(reader, historyPath); err != nil {
+		log.Warnf("could not load history: %v", err)
+	}
+
+	for {
+		historyCount := len(reader.History)
+
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read command: %v", err)
+		}
+
+		if len(reader.History) > historyCount {
+			if err := command.saveHistory(historyPath, line); err != nil {
+				log.Warnf("could not save history: %v", err)
+			}
+		}
+
+		words, err := cli.SplitCommandLine(line)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			return nil
+		}
+
+		storage.CommandLine = append([]string{commandLine[0]}, words...)
+
+		if err := command.run(words); err != nil {
+			log.Warn(err)
+		}
+	}
+}
+
+// unexported
+
+func (command ShellCommand) run(words []string) error {
+	return runCommandLine(command.Commands, command.Parser, words, command.verbose)
+}
+
+// Runs the command line's command. The shell and batch commands, which read
+// command lines themselves, cannot be run this way.
+func runCommandLine(commands map[cli.CommandName]cli.Command, parser *cli.Parser, words []string, verbose bool) error {
+	commandName, options, arguments, err := parser.Parse(words)
+	if err != nil {
+		return err
+	}
+
+	if commandName == "" {
+		commandName = "help"
+	}
+	if commandName == "shell" || commandName == "batch" {
+		return fmt.Errorf("cannot run '%v' from within the shell or a batch.", commandName)
+	}
+	if readsStdin(options) {
+		return fmt.Errorf("cannot read files from standard input from within the shell or a batch.")
+	}
+
+	command := commands[commandName]
+	if command == nil {
+		return fmt.Errorf("invalid command '%v'.", commandName)
+	}
+
+	if verbose && !options.HasOption("--verbose") {
+		options = append(options, cli.Option{"--verbose", "-v", "", false, ""})
+	}
+
+	return command.Exec(options, arguments)
+}
+
+// Completes command names for the first word, options for words starting with
+// a hyphen and otherwise tag names and paths.
+func (command ShellCommand) complete(words []string, partial string) []string {
+	candidates := make([]string, 0, 10)
+
+	switch {
+	case len(words) == 0:
+		for commandName := range command.Commands {
+			if strings.HasPrefix(string(commandName), partial) {
+				candidates = append(candidates, string(commandName))
+			}
+		}
+	case strings.HasPrefix(partial, "-"):
+		if subcommand := command.Commands[cli.CommandName(words[0])]; subcommand != nil {
+			for _, option := range subcommand.Options() {
+				if strings.HasPrefix(option.LongName, partial) {
+					candidates = append(candidates, option.LongName)
+				}
+			}
+		}
+	default:
+		candidates = append(candidates, completeTagNames(partial)...)
+		candidates = append(candidates, completePaths(partial)...)
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+func completeTagNames(partial string) []string {
+	store, err := storage.Open()
+	if err != nil {
+		return nil
+	}
+	defer store.Close()
+
+	tags, err := store.Tags()
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, 10)
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.Name, partial) {
+			names = append(names, tag.Name)
+		}
+	}
+
+	return names
+}
+
+// Completes the partial path, with a trailing slash for directories. Hidden
+// entries are only completed where the partial name begins with a dot.
+func completePaths(partial string) []string {
+	directory, prefix := filepath.Split(partial)
+
+	listDirectory := directory
+	if listDirectory == "" {
+		listDirectory = "."
+	}
+
+	entries, err := ioutil.ReadDir(listDirectory)
+	if err != nil {
+		return nil
+	}
+
+	paths := make([]string, 0, 10)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (name[0] == '.' && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+
+		path := directory + name
+		if entry.IsDir() {
+			path += "/"
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func (command ShellCommand) loadHistory(reader *cli.LineReader, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		reader.History = append(reader.History, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(reader.History) > historyLength {
+		reader.History = reader.History[len(reader.History)-historyLength:]
+	}
+
+	return nil
+}
+
+func (command ShellCommand) saveHistory(path, line string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintln(file, line)
+	return err
+}
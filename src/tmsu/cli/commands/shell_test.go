@@ -0,0 +1,166 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+func TestShell(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	input, err := ioutil.TempFile("", "tmsu-shell")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(input.Name())
+	defer input.Close()
+
+	if _, err := input.WriteString("tag /tmp/tmsu/a apple banana\n\nuntag /tmp/tmsu/a apple\nshell\nundo\nexit\ntag /tmp/tmsu/a cherry\n"); err != nil {
+		test.Fatal(err)
+	}
+	input.Seek(0, 0)
+
+	stdin := os.Stdin
+	os.Stdin = input
+	defer func() { os.Stdin = stdin }()
+
+	commands := map[cli.CommandName]cli.Command{
+		"tag":   TagCommand{},
+		"untag": UntagCommand{},
+		"undo":  UndoCommand{},
+	}
+	command := ShellCommand{Commands: commands, Parser: cli.NewParser(cli.Options{}, commands)}
+	commands["shell"] = command
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "banana")
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	operations, err := store.Operations()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(operations) != 2 || !strings.HasSuffix(operations[0].Description, " tag /tmp/tmsu/a apple banana") || !operations[1].Undone {
+		test.Fatalf("Expected each command to be journaled separately.")
+	}
+
+	log.Errfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Errfile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(string(bytes), "cannot run 'shell'") {
+		test.Fatalf("Expected nested shell to be refused but output was: %v", string(bytes))
+	}
+}
+
+func TestShellContinuesAfterFailedCommand(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	input, err := ioutil.TempFile("", "tmsu-shell")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(input.Name())
+	defer input.Close()
+
+	if _, err := input.WriteString("files nosuch\ntag /tmp/tmsu/a apple\n"); err != nil {
+		test.Fatal(err)
+	}
+	input.Seek(0, 0)
+
+	stdin := os.Stdin
+	os.Stdin = input
+	defer func() { os.Stdin = stdin }()
+
+	commands := map[cli.CommandName]cli.Command{
+		"files": FilesCommand{},
+		"tag":   TagCommand{},
+	}
+	command := ShellCommand{Commands: commands, Parser: cli.NewParser(cli.Options{}, commands)}
+
+	// test
+
+	if err := command.Exec(cli.Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple")
+
+	log.Errfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Errfile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(string(bytes), "no such tag 'nosuch'") {
+		test.Fatalf("Expected unknown tag to be reported but output was: %v", string(bytes))
+	}
+}
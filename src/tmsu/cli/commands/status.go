@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"strings"
 	"tmsu/cli"
+	"tmsu/common"
 	"tmsu/log"
 	"tmsu/path"
 	"tmsu/storage"
@@ -32,6 +33,8 @@ import (
 type StatusCommand struct {
 	verbose   bool
 	directory bool
+	json      bool
+	noCache   bool
 }
 
 func (StatusCommand) Name() cli.CommandName {
@@ -49,15 +52,34 @@ Shows the status of PATHs.
 
 Where PATHs are not specified the status of the database is shown.
 
+With --from-stdin the PATHs are read from standard input, one per line, in
+addition to any specified. With --null they are instead delimited by NUL
+characters, as output by 'find -print0' or 'tmsu files -0'.
+
   T - Tagged
   M - Modified
   ! - Missing
+  L - Linked
   U - Untagged
 
 Status codes of T, M and ! mean that the file has been tagged (and thus is in
-the TMSU database). Modified files are those with a different modification time
-or size to that in the database. Missing files are those in the database but
-that no longer exist in the file-system.
+the TMSU database). Modified files are those with a different modification time,
+size or inode number to that in the database. Missing files are those in the
+database but that no longer exist in the file-system.
+
+Linked files are untagged paths that are hard links to a tagged file, i.e. they
+share its device and inode numbers. Such paths share the tags of the file they
+are linked to.
+
+To speed up subsequent runs, the listings of scanned directories are cached in
+the database and a directory is only re-read if its modification time, device
+or inode number have changed. (The files within are still checked.) Use
+--no-cache to bypass the cache.
+
+With --format=json a JSON object is output per line for each path, with members
+for the status ('tagged', 'modified', 'missing', 'linked' or 'untagged'), the
+absolute path and, for tagged and linked files, the fingerprint recorded in the database
+and the file's database identifier.
 
 Note: The 'repair' command can be used to fix problems caused by files that have
 been modified or moved on disk.`
@@ -70,10 +92,29 @@ const (
 	TAGGED   Status = 'T'
 	MODIFIED Status = 'M'
 	MISSING  Status = '!'
+	LINKED   Status = 'L'
 )
 
+func (status Status) Name() string {
+	switch status {
+	case UNTAGGED:
+		return "untagged"
+	case TAGGED:
+		return "tagged"
+	case MODIFIED:
+		return "modified"
+	case MISSING:
+		return "missing"
+	case LINKED:
+		return "linked"
+	}
+
+	return "unknown"
+}
+
 type StatusReport struct {
-	Rows []Row
+	Rows  []Row
+	links map[[2]uint64]*database.File
 }
 
 func (report *StatusReport) AddRow(row Row) {
@@ -93,22 +134,47 @@ func (report *StatusReport) ContainsRow(path string) bool {
 type Row struct {
 	Path   string
 	Status Status
+	File   *database.File
 }
 
 func NewReport() *StatusReport {
-	return &StatusReport{make([]Row, 0, 10)}
+	return &StatusReport{make([]Row, 0, 10), make(map[[2]uint64]*database.File)}
 }
 
 func (StatusCommand) Options() cli.Options {
-	return cli.Options{cli.Option{"--directory", "-d", "list directory entries only: do not list contents", false, ""}}
+	return append(cli.Options{cli.Option{"--directory", "-d", "list directory entries only: do not list contents", false, ""},
+		cli.Option{"--format", "-F", "output format: text (default) or json", true, ""},
+		cli.Option{"--no-cache", "-n", "do not use or update the directory listing cache", false, ""}},
+		stdinOptions...)
+}
+
+func (StatusCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{"--format": {Values: []string{"text", "json"}}}
 }
 
 func (command StatusCommand) Exec(options cli.Options, args []string) error {
 	command.verbose = options.HasOption("--verbose")
 	command.directory = options.HasOption("--directory")
+	command.noCache = options.HasOption("--no-cache")
+
+	json, err := jsonFormat(options)
+	if err != nil {
+		return err
+	}
+	command.json = json
+
+	if readsStdin(options) {
+		paths, err := readStdinPaths(options)
+		if err != nil {
+			return fmt.Errorf("could not read files from standard input: %v", err)
+		}
+		if len(paths) == 0 && len(args) == 0 {
+			return nil
+		}
+		args = append(args, paths...)
+	}
 
 	var report *StatusReport
-	var err error
 
 	if len(args) == 0 {
 		report, err = command.statusDatabase()
@@ -124,25 +190,41 @@ func (command StatusCommand) Exec(options cli.Options, args []string) error {
 
 	for _, row := range report.Rows {
 		if row.Status == TAGGED {
-			command.printRow(row)
+			if err := command.printRow(row); err != nil {
+				return err
+			}
 		}
 	}
 
 	for _, row := range report.Rows {
 		if row.Status == MODIFIED {
-			command.printRow(row)
+			if err := command.printRow(row); err != nil {
+				return err
+			}
 		}
 	}
 
 	for _, row := range report.Rows {
 		if row.Status == MISSING {
-			command.printRow(row)
+			if err := command.printRow(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, row := range report.Rows {
+		if row.Status == LINKED {
+			if err := command.printRow(row); err != nil {
+				return err
+			}
 		}
 	}
 
 	for _, row := range report.Rows {
 		if row.Status == UNTAGGED {
-			command.printRow(row)
+			if err := command.printRow(row); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -178,16 +260,26 @@ func (command StatusCommand) statusDatabase() (*StatusReport, error) {
 	}
 
 	topLevelPaths := tree.TopLevel().Paths()
-	if err != nil {
-		return nil, err
+
+	cache := command.newScanCache(store)
+	for _, path := range topLevelPaths {
+		if err = cache.load(path); err != nil {
+			return nil, err
+		}
 	}
 
 	for _, path := range topLevelPaths {
-		if err = command.findNewFiles(path, report); err != nil {
+		if err = command.findNewFiles(path, report, cache); err != nil {
 			return nil, err
 		}
 	}
 
+	cache.save()
+
+	if err = command.identifyLinks(report); err != nil {
+		return nil, err
+	}
+
 	return report, nil
 }
 
@@ -200,12 +292,20 @@ func (command StatusCommand) statusPaths(paths []string) (*StatusReport, error)
 	}
 	defer store.Close()
 
+	cache := command.newScanCache(store)
+
 	for _, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
 			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
 
+		if !command.directory {
+			if err = cache.load(absPath); err != nil {
+				return nil, err
+			}
+		}
+
 		file, err := store.FileByPath(absPath)
 		if err != nil {
 			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
@@ -233,12 +333,18 @@ func (command StatusCommand) statusPaths(paths []string) (*StatusReport, error)
 			}
 		}
 
-		err = command.findNewFiles(path, report)
+		err = command.findNewFiles(path, report, cache)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	cache.save()
+
+	if err = command.identifyLinks(report); err != nil {
+		return nil, err
+	}
+
 	return report, nil
 }
 
@@ -268,36 +374,49 @@ func (command *StatusCommand) checkFile(file *database.File, report *StatusRepor
 				log.Infof("%v: file is missing.", file.Path())
 			}
 
-			report.AddRow(Row{relPath, MISSING})
+			report.AddRow(Row{relPath, MISSING, file})
 			return nil
 		case os.IsPermission(err):
 			log.Warnf("%v: permission denied.", file.Path())
 		case strings.Contains(err.Error(), "not a directory"):
-			report.AddRow(Row{relPath, MISSING})
+			report.AddRow(Row{relPath, MISSING, file})
 			return nil
 		default:
 			return fmt.Errorf("%v: could not stat: %v", file.Path(), err)
 		}
 	} else {
-		if stat.Size() != file.Size || stat.ModTime().UTC() != file.ModTime {
+		if !stat.IsDir() && common.LinkCount(stat) > 1 {
+			device, inode := common.DeviceAndInode(stat)
+			report.links[[2]uint64{device, inode}] = file
+		}
+
+		if stat.Size() != file.Size || stat.ModTime().UTC() != file.ModTime || identityChanged(*file, stat) {
 			if command.verbose {
 				log.Infof("%v: file is modified.", file.Path())
 			}
 
-			report.AddRow(Row{relPath, MODIFIED})
+			report.AddRow(Row{relPath, MODIFIED, file})
 		} else {
 			if command.verbose {
 				log.Infof("%v: file is unchanged.", file.Path())
 			}
 
-			report.AddRow(Row{relPath, TAGGED})
+			report.AddRow(Row{relPath, TAGGED, file})
 		}
 	}
 
 	return nil
 }
 
-func (command *StatusCommand) findNewFiles(searchPath string, report *StatusReport) error {
+func (command *StatusCommand) newScanCache(store *storage.Storage) *scanCache {
+	if command.noCache || command.directory {
+		return nil
+	}
+
+	return newScanCache(store, command.verbose)
+}
+
+func (command *StatusCommand) findNewFiles(searchPath string, report *StatusReport, cache *scanCache) error {
 	if command.verbose {
 		log.Infof("%v: finding new files.", searchPath)
 	}
@@ -305,7 +424,7 @@ func (command *StatusCommand) findNewFiles(searchPath string, report *StatusRepo
 	relPath := path.Rel(searchPath)
 
 	if !report.ContainsRow(relPath) {
-		report.AddRow(Row{relPath, UNTAGGED})
+		report.AddRow(Row{relPath, UNTAGGED, nil})
 	}
 
 	absPath, err := filepath.Abs(searchPath)
@@ -327,28 +446,84 @@ func (command *StatusCommand) findNewFiles(searchPath string, report *StatusRepo
 	}
 
 	if !command.directory && stat.IsDir() {
-		dir, err := os.Open(absPath)
+		entries, err := cache.entries(absPath, stat)
 		if err != nil {
-			return fmt.Errorf("%v: could not open file: %v", searchPath, err)
+			return err
+		}
+
+		for _, entry := range entries {
+			entryPath := filepath.Join(searchPath, entry.name)
+
+			if entry.isDir {
+				if err = command.findNewFiles(entryPath, report, cache); err != nil {
+					return err
+				}
+			} else {
+				entryRelPath := path.Rel(entryPath)
+				if !report.ContainsRow(entryRelPath) {
+					report.AddRow(Row{entryRelPath, UNTAGGED, nil})
+				}
+			}
 		}
+	}
+
+	return nil
+}
+
+// Identifies the untagged paths that are hard links to tagged files. Untagged
+// paths are only examined if a tagged file was found to have further links.
+func (command *StatusCommand) identifyLinks(report *StatusReport) error {
+	if len(report.links) == 0 {
+		return nil
+	}
 
-		dirNames, err := dir.Readdirnames(0)
+	for index, row := range report.Rows {
+		if row.Status != UNTAGGED {
+			continue
+		}
+
+		stat, err := os.Stat(row.Path)
 		if err != nil {
-			return fmt.Errorf("%v: could not read directory listing: %v", searchPath, err)
+			switch {
+			case os.IsNotExist(err):
+				continue
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied.", row.Path)
+				continue
+			default:
+				return fmt.Errorf("%v: could not stat: %v", row.Path, err)
+			}
 		}
 
-		for _, dirName := range dirNames {
-			dirPath := filepath.Join(searchPath, dirName)
-			err = command.findNewFiles(dirPath, report)
-			if err != nil {
-				return err
+		if stat.IsDir() || common.LinkCount(stat) < 2 {
+			continue
+		}
+
+		device, inode := common.DeviceAndInode(stat)
+		if file, found := report.links[[2]uint64{device, inode}]; found {
+			if command.verbose {
+				log.Infof("%v: file is linked to %v.", row.Path, file.Path())
 			}
+
+			report.Rows[index] = Row{row.Path, LINKED, file}
 		}
 	}
 
 	return nil
 }
 
-func (command *StatusCommand) printRow(row Row) {
+func (command *StatusCommand) printRow(row Row) error {
+	if command.json {
+		record := pathRecord{Status: row.Status.Name(), Path: row.Path}
+		if row.File != nil {
+			record.OldFingerprint = string(row.File.Fingerprint)
+			record.FileId = row.File.Id
+		}
+
+		return printRecord(record)
+	}
+
 	log.Printf("%v %v", string(row.Status), row.Path)
+
+	return nil
 }
@@ -20,9 +20,14 @@ package commands
 import (
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"tmsu/cli"
 	"tmsu/log"
+	"tmsu/storage"
 )
 
 func TestStatusReport(test *testing.T) {
@@ -58,7 +63,7 @@ func TestStatusReport(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/d")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 
 	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
 		test.Fatal(err)
@@ -85,7 +90,7 @@ func TestStatusReport(test *testing.T) {
 
 	// test
 
-	statusCommand := StatusCommand{false, false}
+	statusCommand := StatusCommand{}
 	if err := statusCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/c", "/tmp/tmsu/d"}); err != nil {
 		test.Fatal(err)
 	}
@@ -97,3 +102,290 @@ func TestStatusReport(test *testing.T) {
 	bytes, err := ioutil.ReadAll(log.Outfile)
 	compareOutput(test, "tmsu: New tag 'a'.\ntmsu: New tag 'b'.\ntmsu: New tag 'd'.\nT /tmp/tmsu/a\nM /tmp/tmsu/b\n! /tmp/tmsu/d\nU /tmp/tmsu/c\n", string(bytes))
 }
+
+func TestStatusReportJson(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/c", "c"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.Remove("/tmp/tmsu/c")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.FileByPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	statusCommand := StatusCommand{}
+	if err := statusCommand.Exec(cli.Options{cli.Option{"--format", "-F", "", true, "json"}}, []string{"/tmp/tmsu/a", "/tmp/tmsu/c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	expected := "tmsu: New tag 'a'.\n" +
+		`{"status":"tagged","path":"/tmp/tmsu/a","old_fingerprint":"` + string(file.Fingerprint) + `","file_id":` + strconv.Itoa(int(file.Id)) + "}\n" +
+		`{"status":"untagged","path":"/tmp/tmsu/c"}` + "\n"
+	compareOutput(test, expected, string(bytes))
+}
+
+func TestStatusJsonRelativePath(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/c", "c"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.Remove("/tmp/tmsu/c")
+
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Chdir(workingDirectory)
+
+	if err := os.Chdir("/tmp/tmsu"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	statusCommand := StatusCommand{}
+	if err := statusCommand.Exec(cli.Options{cli.Option{"--format", "-F", "", true, "json"}}, []string{"c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, `{"status":"untagged","path":"/tmp/tmsu/c"}`+"\n", string(bytes))
+}
+
+func TestStatusUsesDirectoryCache(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-cache/a", "a"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-cache")
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	if err := os.Chtimes("/tmp/tmsu-cache", lastWeek, lastWeek); err != nil {
+		test.Fatal(err)
+	}
+
+	statusCommand := StatusCommand{}
+	if err := statusCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// add a file but restore the directory's modification time so the
+	// directory appears to be unchanged
+	if err := createFile("/tmp/tmsu-cache/b", "b"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	if err := os.Chtimes("/tmp/tmsu-cache", lastWeek, lastWeek); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := statusCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := statusCommand.Exec(cli.Options{cli.Option{"--no-cache", "-n", "", false, ""}}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "U /tmp/tmsu-cache\nU /tmp/tmsu-cache/a\nU /tmp/tmsu-cache\nU /tmp/tmsu-cache/a\nU /tmp/tmsu-cache\nU /tmp/tmsu-cache/a\nU /tmp/tmsu-cache/b\n", string(bytes))
+}
+
+func TestStatusPrunesDirectoryCache(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-cache/a_b/a", "a"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	if err := createFile("/tmp/tmsu-cache/axb/c/b", "b"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-cache")
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	for _, path := range []string{"/tmp/tmsu-cache", "/tmp/tmsu-cache/a_b", "/tmp/tmsu-cache/axb", "/tmp/tmsu-cache/axb/c"} {
+		if err := os.Chtimes(path, lastWeek, lastWeek); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	statusCommand := StatusCommand{}
+	if err := statusCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	expectCachedDirectories(test, "/tmp/tmsu-cache/a_b", "/tmp/tmsu-cache/a_b")
+
+	if err := os.RemoveAll("/tmp/tmsu-cache/axb"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chtimes("/tmp/tmsu-cache", lastWeek, lastWeek); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := statusCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-cache"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectCachedDirectories(test, "/tmp/tmsu-cache", "/tmp/tmsu-cache", "/tmp/tmsu-cache/a_b")
+}
+
+func TestStatusReportsHardLinks(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-links/a", "a"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-links")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-links/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Link("/tmp/tmsu-links/a", "/tmp/tmsu-links/b"); err != nil {
+		test.Fatal(err)
+	}
+
+	statusCommand := StatusCommand{}
+
+	// test
+
+	if err := statusCommand.Exec(cli.Options{cli.Option{"--no-cache", "-n", "", false, ""}}, []string{"/tmp/tmsu-links"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "tmsu: New tag 'apple'.\nT /tmp/tmsu-links/a\nL /tmp/tmsu-links/b\nU /tmp/tmsu-links\n", string(bytes))
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tags, err := TagsCommand{}.tagsForPath(store, "/tmp/tmsu-links/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "apple" {
+		test.Fatalf("Expected hard link to share tag 'apple' but has %v tags.", len(tags))
+	}
+}
+
+func expectCachedDirectories(test *testing.T, path string, expectedPaths ...string) {
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	directories, err := store.CachedDirectoriesByPath(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := make([]string, len(directories))
+	for index, directory := range directories {
+		paths[index] = directory.Path
+	}
+	sort.Strings(paths)
+
+	if strings.Join(paths, ",") != strings.Join(expectedPaths, ",") {
+		test.Fatalf("Expected cached directories %v but were %v.", expectedPaths, paths)
+	}
+}
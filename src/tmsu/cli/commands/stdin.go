@@ -0,0 +1,69 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"tmsu/cli"
+)
+
+// The options of the commands that can read the files to operate upon from
+// standard input.
+var stdinOptions = cli.Options{{"--from-stdin", "-s", "read the files from standard input, one per line", false, ""},
+	{"--null", "-0", "read the files from standard input delimited by NUL, e.g. from 'find -print0'", false, ""}}
+
+// Determines whether files are to be read from standard input.
+func readsStdin(options cli.Options) bool {
+	return options.HasOption("--from-stdin") || options.HasOption("--null")
+}
+
+// Reads the files listed on standard input.
+func readStdinPaths(options cli.Options) ([]string, error) {
+	delimiter := byte('\n')
+	if options.HasOption("--null") {
+		delimiter = 0
+	}
+
+	return readPaths(bufio.NewReader(os.Stdin), delimiter)
+}
+
+// Reads the delimited paths, skipping any that are empty.
+func readPaths(reader *bufio.Reader, delimiter byte) ([]string, error) {
+	paths := make([]string, 0, 10)
+
+	for {
+		path, err := readField(reader, delimiter)
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delimiter == '\n' {
+			path = strings.TrimSuffix(path, "\r")
+		}
+
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+}
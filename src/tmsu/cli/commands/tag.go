@@ -22,8 +22,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"tmsu/autotag"
 	"tmsu/cli"
+	"tmsu/common"
 	"tmsu/fingerprint"
 	"tmsu/log"
 	"tmsu/storage"
@@ -33,6 +34,10 @@ import (
 type TagCommand struct {
 	verbose   bool
 	recursive bool
+	rules     autotag.Rules
+	extract   bool
+	taggers   []*autotag.Tagger
+	replace   bool
 }
 
 func (TagCommand) Name() cli.CommandName {
@@ -47,23 +52,98 @@ func (TagCommand) Description() string {
 	return `tmsu tag [OPTION]... FILE TAG...
 tmsu tag [OPTION]... --tags "TAG..." FILE...
 tmsu tag [OPTION]... --from FILE FILE...
+tmsu tag [OPTION]... --from-stdin TAG...
 
-Tags the file FILE with the tag(s) specified.`
+Tags the file FILE with the tag(s) specified.
+
+With --from-stdin the files to tag are read from standard input, one per line,
+in addition to any specified by --tags or --from. With --null they are instead
+delimited by NUL characters, as output by 'find -print0' or 'tmsu files -0':
+
+    $ find -name '*.mp3' -print0 | tmsu tag --null music
+
+When a file is first added to the database it is also tagged according to the
+auto-tagging rules (see 'tmsu help autotag') unless --no-autotag is specified.
+
+With --extract, tags are also extracted from the metadata of each file tagged:
+
+    MIME type     the general type, e.g. 'image', and 'format:SUBTYPE'
+    JPEG EXIF     'camera:MODEL' and 'year:YEAR'
+    MP3 ID3       'artist:ARTIST', 'album:ALBUM', 'year:YEAR' and 'genre:GENRE'
+    PDF           'author:AUTHOR', 'year:YEAR' and a tag per keyword
+
+Use 'tmsu autotag --extract --pretend' to preview the extracted tags.
+
+With --tagger, which can be repeated, the specified program is run for each
+file tagged with the file's path as its final argument. The program should
+output the tags to apply either one per line or as JSON: an array of tag names
+or an object with a 'tags' array. Lines starting with '#' are ignored.
+
+    $ tmsu tag --tagger ~/bin/classify --tags "photo" IMG_0001.jpg
+
+A file cannot have more than one tag from a tag group (see 'tmsu help group'):
+tagging such a file with another tag from the group fails unless --replace is
+specified, in which case the file's existing tag from the group is removed.
+
+    $ tmsu tag --replace song.mp3 rating-4`
 }
 
 func (TagCommand) Options() cli.Options {
-	return cli.Options{{"--tags", "-t", "the set of tags to apply", true, ""},
+	return append(cli.Options{{"--tags", "-t", "the set of tags to apply", true, ""},
 		{"--recursive", "-r", "recursively apply tags to directory contents", false, ""},
-		{"--from", "-f", "copy tags from the specified file", true, ""}}
+		{"--from", "-f", "copy tags from the specified file", true, ""},
+		{"--no-autotag", "-n", "do not apply auto-tagging rules to new files", false, ""},
+		{"--extract", "-e", "apply tags extracted from file metadata", false, ""},
+		{"--tagger", "-T", "apply tags output by the specified program", true, ""},
+		{"--replace", "-x", "replace the file's tags from the same tag groups", false, ""}},
+		stdinOptions...)
+}
+
+func (TagCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{
+		"--tags":   {Tags: true},
+		"--from":   {Files: true},
+		"--tagger": {Files: true}}
 }
 
 func (command TagCommand) Exec(options cli.Options, args []string) error {
-	if len(args) < 1 {
+	if len(args) < 1 && !readsStdin(options) {
 		return fmt.Errorf("too few arguments.")
 	}
 
 	command.verbose = options.HasOption("--verbose")
 	command.recursive = options.HasOption("--recursive")
+	command.extract = options.HasOption("--extract")
+	command.replace = options.HasOption("--replace")
+
+	for _, option := range options {
+		if option.LongName == "--tagger" {
+			tagger, err := autotag.NewTagger(strings.Fields(option.Argument))
+			if err != nil {
+				return err
+			}
+
+			command.taggers = append(command.taggers, tagger)
+		}
+	}
+
+	if !options.HasOption("--no-autotag") {
+		rules, err := loadRules("")
+		if err != nil {
+			return err
+		}
+		command.rules = rules
+	}
+
+	var stdinPaths []string
+	if readsStdin(options) {
+		paths, err := readStdinPaths(options)
+		if err != nil {
+			return fmt.Errorf("could not read files from standard input: %v", err)
+		}
+		stdinPaths = paths
+	}
+	paths := append(args, stdinPaths...)
 
 	store, err := storage.Open()
 	if err != nil {
@@ -78,8 +158,7 @@ func (command TagCommand) Exec(options cli.Options, args []string) error {
 			return fmt.Errorf("set of tags to apply must be specified")
 		}
 
-		paths := args
-		if len(paths) < 1 {
+		if len(paths) < 1 && !readsStdin(options) {
 			return fmt.Errorf("at least one file to tag must be specified")
 		}
 
@@ -97,9 +176,17 @@ func (command TagCommand) Exec(options cli.Options, args []string) error {
 			return fmt.Errorf("%v: could not get absolute path: %v", fromPath, err)
 		}
 
-		tags, err := store.TagsForPath(fromPath)
+		file, err := fileOrLinkedFile(store, fromPath)
 		if err != nil {
-			return fmt.Errorf("%v: could not retrieve tags: %v", fromPath)
+			return err
+		}
+
+		tags := database.Tags{}
+		if file != nil {
+			tags, err = store.TagsByFileId(file.Id)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve tags: %v", fromPath, err)
+			}
 		}
 
 		tagIds := make([]uint, len(tags))
@@ -107,11 +194,24 @@ func (command TagCommand) Exec(options cli.Options, args []string) error {
 			tagIds[index] = tag.Id
 		}
 
-		for _, path := range args {
+		for _, path := range paths {
 			if err = command.tagPath(store, path, tagIds); err != nil {
 				return err
 			}
 		}
+	case readsStdin(options):
+		if len(args) < 1 {
+			return fmt.Errorf("tags to apply must be specified.")
+		}
+
+		tagIds, err := command.lookupTagIds(store, args)
+		if err != nil {
+			return err
+		}
+
+		if err := command.tagPaths(store, stdinPaths, tagIds); err != nil {
+			return err
+		}
 	default:
 		if len(args) < 2 {
 			return fmt.Errorf("file to tag and tags to apply must be specified.")
@@ -141,38 +241,30 @@ func (command TagCommand) lookupTagIds(store *storage.Storage, names []string) (
 
 	for _, name := range names {
 		if !tags.Any(func(tag *database.Tag) bool { return tag.Name == name }) {
-			log.Infof("New tag '%v'.", name)
-
-			tag, err := store.AddTag(name)
+			// may have been added as the ancestor of an earlier tag
+			tag, err := store.TagByName(name)
 			if err != nil {
-				return nil, fmt.Errorf("could not add tag '%v': %v", name, err)
+				return nil, fmt.Errorf("could not retrieve tag '%v': %v", name, err)
+			}
+
+			if tag == nil {
+				log.Infof("New tag '%v'.", name)
+
+				tag, err = store.AddTag(name)
+				if err != nil {
+					return nil, fmt.Errorf("could not add tag '%v': %v", name, err)
+				}
 			}
 
 			tags = append(tags, tag)
 		}
 	}
 
-	if command.verbose {
-		log.Infof("retrieving tag implications")
-	}
-
 	tagIds := make([]uint, len(tags))
 	for index, tag := range tags {
 		tagIds[index] = tag.Id
 	}
 
-	implications, err := store.ImplicationsForTags(tagIds...)
-	if err != nil {
-		return nil, fmt.Errorf("could not retrieve implied tags: %v", err)
-	}
-
-	for _, implication := range implications {
-		if !contains(tagIds, implication.ImpliedTag.Id) {
-			log.Infof("tag '%v' is implied.", implication.ImpliedTag.Name)
-			tagIds = append(tagIds, implication.ImpliedTag.Id)
-		}
-	}
-
 	return tagIds, nil
 }
 
@@ -204,25 +296,64 @@ func (command TagCommand) tagPath(store *storage.Storage, path string, tagIds []
 		}
 	}
 
-	file, err := store.FileByPath(absPath)
+	fileTagIds := tagIds
+
+	// a hard link of a tagged file shares its tags
+	file, err := fileOrLinkedFile(store, absPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		return err
 	}
 	if file == nil {
-		file, err = command.addFile(store, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir())
+		file, err = command.addFile(store, absPath, stat)
 		if err != nil {
 			return fmt.Errorf("%v: could not add file: %v", path, err)
 		}
+
+		fileTagIds, err = command.addAutoTagIds(store, absPath, stat, tagIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	if command.extract && !stat.IsDir() {
+		fileTagIds, err = command.addExtractedTagIds(store, absPath, fileTagIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tagger := range command.taggers {
+		fileTagIds, err = command.addTaggerTagIds(store, tagger, absPath, fileTagIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	if command.replace {
+		removedTags, err := store.ReplaceExclusiveFileTags(file.Id, fileTagIds)
+		if err != nil {
+			return fmt.Errorf("%v: could not replace tags: %v", file.Path(), err)
+		}
+
+		if command.verbose {
+			for _, tag := range removedTags {
+				log.Infof("%v: removing tag '%v'.", file.Path(), tag.Name)
+			}
+		}
 	}
 
 	if command.verbose {
 		log.Infof("%v: applying tags.", file.Path())
 	}
 
-	if err = store.AddFileTags(file.Id, tagIds); err != nil {
+	if err = store.AddFileTags(file.Id, fileTagIds); err != nil {
 		return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
 	}
 
+	if err = command.warnConflicts(store, file); err != nil {
+		return err
+	}
+
 	if command.recursive && stat.IsDir() {
 		if err = command.tagRecursively(store, path, tagIds); err != nil {
 			return err
@@ -232,6 +363,25 @@ func (command TagCommand) tagPath(store *storage.Storage, path string, tagIds []
 	return nil
 }
 
+// Warns of the tags the file has that conflict with its other tags.
+func (command TagCommand) warnConflicts(store *storage.Storage, file *database.File) error {
+	tags, err := store.TagsByFileId(file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve tags: %v", file.Path(), err)
+	}
+
+	conflicting, err := store.ConflictingImplications(tags)
+	if err != nil {
+		return fmt.Errorf("%v: could not check for conflicting tags: %v", file.Path(), err)
+	}
+
+	for _, implication := range conflicting {
+		log.Warnf("%v: tag '%v' conflicts with %v.", file.Path(), implication.ImpliedTag.Name, implyingTagsText(implication.ImplyingTags))
+	}
+
+	return nil
+}
+
 func (command TagCommand) tagRecursively(store *storage.Storage, path string, tagIds []uint) error {
 	osFile, err := os.Open(path)
 	if err != nil {
@@ -255,7 +405,83 @@ func (command TagCommand) tagRecursively(store *storage.Storage, path string, ta
 	return nil
 }
 
-func (command *TagCommand) addFile(store *storage.Storage, path string, modTime time.Time, size uint, isDir bool) (*database.File, error) {
+// Adds the tags determined by the auto-tagging rules to the set of tags.
+func (command TagCommand) addAutoTagIds(store *storage.Storage, path string, stat os.FileInfo, tagIds []uint) ([]uint, error) {
+	if len(command.rules) == 0 {
+		return tagIds, nil
+	}
+
+	tagNames, err := command.rules.Tags(path, stat)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not apply auto-tagging rules: %v", path, err)
+	}
+	if len(tagNames) == 0 {
+		return tagIds, nil
+	}
+
+	if command.verbose {
+		log.Infof("%v: auto-tagging %v.", path, strings.Join(tagNames, " "))
+	}
+
+	return command.addTagNames(store, tagNames, tagIds)
+}
+
+// Adds the tags extracted from the file's metadata to the set of tags.
+func (command TagCommand) addExtractedTagIds(store *storage.Storage, path string, tagIds []uint) ([]uint, error) {
+	tagNames, err := autotag.ExtractTags(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not extract tags: %v", path, err)
+	}
+	if len(tagNames) == 0 {
+		return tagIds, nil
+	}
+
+	if command.verbose {
+		log.Infof("%v: extracted %v.", path, strings.Join(tagNames, " "))
+	}
+
+	return command.addTagNames(store, tagNames, tagIds)
+}
+
+// Adds the tags output by the external tagger to the set of tags.
+func (command TagCommand) addTaggerTagIds(store *storage.Storage, tagger *autotag.Tagger, path string, tagIds []uint) ([]uint, error) {
+	if command.verbose {
+		log.Infof("%v: running tagger '%v'.", path, tagger.Name())
+	}
+
+	tagNames, err := tagger.Extract(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tagNames) == 0 {
+		return tagIds, nil
+	}
+
+	if command.verbose {
+		log.Infof("%v: tagger proposed %v.", path, strings.Join(tagNames, " "))
+	}
+
+	return command.addTagNames(store, tagNames, tagIds)
+}
+
+func (command TagCommand) addTagNames(store *storage.Storage, tagNames []string, tagIds []uint) ([]uint, error) {
+	additionalTagIds, err := command.lookupTagIds(store, tagNames)
+	if err != nil {
+		return nil, err
+	}
+
+	combinedTagIds := make([]uint, len(tagIds), len(tagIds)+len(additionalTagIds))
+	copy(combinedTagIds, tagIds)
+	for _, tagId := range additionalTagIds {
+		if !contains(combinedTagIds, tagId) {
+			combinedTagIds = append(combinedTagIds, tagId)
+		}
+	}
+
+	return combinedTagIds, nil
+}
+
+func (command *TagCommand) addFile(store *storage.Storage, path string, stat os.FileInfo) (*database.File, error) {
 	if command.verbose {
 		log.Infof("%v: adding file.", path)
 	}
@@ -265,7 +491,9 @@ func (command *TagCommand) addFile(store *storage.Storage, path string, modTime
 		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
 	}
 
-	file, err := store.AddFile(path, fingerprint, modTime, int64(size), isDir)
+	device, inode := common.DeviceAndInode(stat)
+
+	file, err := store.AddFile(path, fingerprint, stat.ModTime(), stat.Size(), stat.IsDir(), device, inode)
 	if err != nil {
 		return nil, fmt.Errorf("%v: could not add file to database: %v", path, err)
 	}
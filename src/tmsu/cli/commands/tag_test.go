@@ -18,7 +18,9 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package commands
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"tmsu/cli"
 	"tmsu/storage"
@@ -41,7 +43,7 @@ func TestSingleTag(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/a")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 
 	// test
 
@@ -105,7 +107,7 @@ func TestMultipleTags(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/a")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 
 	// test
 
@@ -192,7 +194,7 @@ func TestTagMultipleFiles(test *testing.T) {
 	}
 	defer os.Remove("/tmp/tmsu/b")
 
-	tagCommand := TagCommand{false, false}
+	tagCommand := TagCommand{}
 
 	// test
 
@@ -265,3 +267,286 @@ func TestTagMultipleFiles(test *testing.T) {
 }
 
 //TODO recursive
+
+func TestTagExtract(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.pdf", "%PDF-1.4\n<< /Author (Jane Doe) /Keywords (cats; dogs) >>\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.pdf")
+
+	tagCommand := TagCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--extract", "-e", "", false, ""}}
+	if err := tagCommand.Exec(options, []string{"/tmp/tmsu/a.pdf", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.TagsForPath("/tmp/tmsu/a.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagNames := make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[index] = tag.Name
+	}
+
+	if strings.Join(tagNames, " ") != "apple author:Jane-Doe cats dogs format:pdf" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+func TestTagTagger(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := ioutil.WriteFile("/tmp/tmsu/tagger", []byte("#!/bin/sh\necho '[\"banana\", \"cherry\"]'\n"), 0755); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/tagger")
+
+	tagCommand := TagCommand{}
+
+	// test
+
+	options := cli.Options{cli.Option{"--tagger", "-T", "", true, "/tmp/tmsu/tagger"}}
+	if err := tagCommand.Exec(options, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.TagsForPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagNames := make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[index] = tag.Name
+	}
+
+	if strings.Join(tagNames, " ") != "apple banana cherry" {
+		test.Fatalf("Unexpected tags: %v.", tagNames)
+	}
+}
+
+func TestTagExclusiveGroup(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := (GroupCommand{}).Exec(cli.Options{}, []string{"status", "todo", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	tagCommand := TagCommand{}
+
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "todo"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "done"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Tag from the same tag group was not rejected.")
+	}
+
+	tags, err := store.TagsForPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "todo" {
+		test.Fatalf("Expected file to be tagged 'todo' only but has %v tags.", len(tags))
+	}
+}
+
+func TestTagReplace(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := (GroupCommand{}).Exec(cli.Options{}, []string{"status", "todo", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	tagCommand := TagCommand{}
+
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a", "todo", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := tagCommand.Exec(cli.Options{cli.Option{"--replace", "-x", "", false, ""}}, []string{"/tmp/tmsu/a", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.TagsForPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "apple" || tags[1].Name != "done" {
+		test.Fatalf("Expected file to be tagged 'apple' and 'done' but has %v tags.", len(tags))
+	}
+}
+
+func TestTagFromStdin(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b\nc", "b c"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b\nc")
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	inPath, err := configureInput("/tmp/tmsu/a\x00/tmp/tmsu/b\nc\x00")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(inPath)
+
+	tagCommand := TagCommand{}
+
+	// test
+
+	if err := tagCommand.Exec(cli.Options{cli.Option{"--null", "-0", "", false, ""}}, []string{"apple", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "banana")
+	expectPathTags(test, "/tmp/tmsu/b\nc", "apple", "banana")
+}
+
+func TestTagHardLink(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-links/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-links")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-links/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Link("/tmp/tmsu-links/a", "/tmp/tmsu-links/b"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-links/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (UntagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu-links/b", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu-links/a", "banana")
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	count, err := store.FileCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 1 {
+		test.Fatalf("Expected hard link to be tracked as the same file but there are %v files.", count)
+	}
+}
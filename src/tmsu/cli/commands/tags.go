@@ -20,18 +20,21 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"tmsu/cli"
+	"tmsu/common"
 	"tmsu/log"
 	"tmsu/storage"
 	"tmsu/storage/database"
 )
 
 type TagsCommand struct {
-	verbose bool
-	count   bool
+	verbose  bool
+	count    bool
+	explicit bool
 }
 
 func (TagsCommand) Name() cli.CommandName {
@@ -47,23 +50,52 @@ func (TagsCommand) Description() string {
 
 Lists the tags applied to FILEs.
 
-When run with no arguments, tags for the current working directory are listed.`
+When run with no arguments, tags for the current working directory are listed.
+
+With --from-stdin the files are read from standard input, one per line, in
+addition to any specified. With --null they are instead delimited by NUL
+characters, as output by 'find -print0' or 'tmsu files -0'. Each file is
+listed along with its tags.
+
+The tags listed include those implied by the tags applied (see 'tmsu help
+imply') unless --explicit is specified.
+
+Tags are hierarchical: the tag 'media/audio/podcast' is a child of
+'media/audio' which is in turn a child of 'media'. Use --tree to list all of
+the tags as a hierarchy.`
 }
 
 func (TagsCommand) Options() cli.Options {
-	return cli.Options{{"--all", "-a", "lists all of the tags defined", false, ""},
-		{"--count", "-c", "lists the number of tags rather than their names", false, ""}}
+	return append(cli.Options{{"--all", "-a", "lists all of the tags defined", false, ""},
+		{"--count", "-c", "lists the number of tags rather than their names", false, ""},
+		{"--tree", "-t", "lists all of the tags as a hierarchy", false, ""},
+		{"--explicit", "-e", "lists only the explicitly applied tags, not the implied tags", false, ""}},
+		stdinOptions...)
 }
 
 func (command TagsCommand) Exec(options cli.Options, args []string) error {
 	command.verbose = options.HasOption("--verbose")
 	command.count = options.HasOption("--count")
+	command.explicit = options.HasOption("--explicit")
+
+	if options.HasOption("--tree") {
+		return command.listTagTree()
+	}
 
 	if options.HasOption("--all") {
 		return command.listAllTags()
 	}
 
-	return command.listTags(args)
+	if readsStdin(options) {
+		paths, err := readStdinPaths(options)
+		if err != nil {
+			return fmt.Errorf("could not read files from standard input: %v", err)
+		}
+
+		return command.listTags(append(args, paths...), true)
+	}
+
+	return command.listTags(args, false)
 }
 
 func (command TagsCommand) listAllTags() error {
@@ -98,17 +130,47 @@ func (command TagsCommand) listAllTags() error {
 	return nil
 }
 
-func (command TagsCommand) listTags(paths []string) error {
+func (command TagsCommand) listTagTree() error {
 	store, err := storage.Open()
 	if err != nil {
 		return fmt.Errorf("could not open storage: %v", err)
 	}
 	defer store.Close()
 
-	switch len(paths) {
-	case 0:
+	if command.verbose {
+		log.Info("retrieving all tags.")
+	}
+
+	tags, err := store.Tags()
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	root := &tagTreeNode{}
+	for _, tag := range tags {
+		root.add(strings.Split(tag.Name, "/"))
+	}
+
+	root.print("")
+
+	return nil
+}
+
+// Lists the tags for the paths. Each path is listed along with its tags if
+// there are several or if listed is set.
+func (command TagsCommand) listTags(paths []string, listed bool) error {
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	switch {
+	case listed:
+		return command.listTagsForPaths(store, paths)
+	case len(paths) == 0:
 		return command.listTagsForWorkingDirectory(store)
-	case 1:
+	case len(paths) == 1:
 		return command.listTagsForPath(store, paths[0])
 	default:
 		return command.listTagsForPaths(store, paths)
@@ -122,7 +184,7 @@ func (command TagsCommand) listTagsForPath(store *storage.Storage, path string)
 		log.Infof("%v: retrieving tags.", path)
 	}
 
-	var tags, err = store.TagsForPath(path)
+	var tags, err = command.tagsForPath(store, path)
 	if err != nil {
 		return fmt.Errorf("%v: could not retrieve tags: %v", path, err)
 	}
@@ -158,7 +220,7 @@ func (command TagsCommand) listTagsForPaths(store *storage.Storage, paths []stri
 			log.Infof("%v: retrieving tags.", path)
 		}
 
-		var tags, err = store.TagsForPath(path)
+		var tags, err = command.tagsForPath(store, path)
 		if err != nil {
 			log.Warn(err.Error())
 			continue
@@ -193,7 +255,7 @@ func (command TagsCommand) listTagsForWorkingDirectory(store *storage.Storage) e
 			log.Infof("%v: retrieving tags.", dirName)
 		}
 
-		var tags, err = store.TagsForPath(dirName)
+		var tags, err = command.tagsForPath(store, dirName)
 
 		if err != nil {
 			log.Warn(err.Error())
@@ -214,6 +276,80 @@ func (command TagsCommand) listTagsForWorkingDirectory(store *storage.Storage) e
 	return nil
 }
 
+// Retrieves the tags for the path, including the implied tags unless only the
+// explicit tags are required.
+func (command TagsCommand) tagsForPath(store *storage.Storage, path string) (database.Tags, error) {
+	file, err := fileOrLinkedFile(store, path)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return database.Tags{}, nil
+	}
+
+	if command.explicit {
+		tags, err := store.ExplicitTagsByFileId(file.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve tags: %v", path, err)
+		}
+
+		return tags, nil
+	}
+
+	tags, err := store.TagsByFileId(file.Id)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve tags: %v", path, err)
+	}
+
+	impliedTags, err := store.ImpliedTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve implied tags: %v", path, err)
+	}
+
+	tags = append(tags, impliedTags...)
+	sort.Sort(tags)
+
+	return tags, nil
+}
+
+// Retrieves the tracked file at the specified path or, where the path is
+// untracked, a tracked file that is a hard link to it. Hard links to a tracked
+// file share its tags.
+func fileOrLinkedFile(store *storage.Storage, path string) (*database.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file != nil {
+		return file, nil
+	}
+
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%v: could not stat file: %v", path, err)
+	}
+
+	if stat.IsDir() || common.LinkCount(stat) < 2 {
+		return nil, nil
+	}
+
+	device, inode := common.DeviceAndInode(stat)
+	file, err = store.LinkedFile(absPath, device, inode)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return file, nil
+}
+
 func tagLine(tags database.Tags) string {
 	tagNames := make([]string, len(tags))
 	for index, tag := range tags {
@@ -222,3 +358,48 @@ func tagLine(tags database.Tags) string {
 
 	return strings.Join(tagNames, " ")
 }
+
+type tagTreeNode struct {
+	name     string
+	children []*tagTreeNode
+}
+
+func (node *tagTreeNode) add(names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	for _, child := range node.children {
+		if child.name == names[0] {
+			child.add(names[1:])
+			return
+		}
+	}
+
+	child := &tagTreeNode{name: names[0]}
+	node.children = append(node.children, child)
+	child.add(names[1:])
+}
+
+func (node *tagTreeNode) print(indent string) {
+	sort.Sort(tagTreeNodes(node.children))
+
+	for _, child := range node.children {
+		log.Print(indent + child.name)
+		child.print(indent + "  ")
+	}
+}
+
+type tagTreeNodes []*tagTreeNode
+
+func (nodes tagTreeNodes) Len() int {
+	return len(nodes)
+}
+
+func (nodes tagTreeNodes) Swap(i, j int) {
+	nodes[i], nodes[j] = nodes[j], nodes[i]
+}
+
+func (nodes tagTreeNodes) Less(i, j int) bool {
+	return nodes[i].name < nodes[j].name
+}
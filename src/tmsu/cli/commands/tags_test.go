@@ -47,7 +47,7 @@ func TestTagsForSingleFile(test *testing.T) {
 	}
 	defer store.Close()
 
-	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false)
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -72,7 +72,7 @@ func TestTagsForSingleFile(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	tagsCommand := TagsCommand{false, false}
+	tagsCommand := TagsCommand{false, false, false}
 
 	// test
 
@@ -107,12 +107,12 @@ func TestTagsForMultipleFiles(test *testing.T) {
 	}
 	defer store.Close()
 
-	aFile, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false)
+	aFile, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	bFile, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("123"), time.Now(), 0, false)
+	bFile, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -142,7 +142,7 @@ func TestTagsForMultipleFiles(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	tagsCommand := TagsCommand{false, false}
+	tagsCommand := TagsCommand{false, false, false}
 
 	// test
 
@@ -187,7 +187,7 @@ func TestAllTags(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	tagsCommand := TagsCommand{false, false}
+	tagsCommand := TagsCommand{false, false, false}
 
 	// test
 
@@ -202,3 +202,109 @@ func TestAllTags(test *testing.T) {
 	bytes, err := ioutil.ReadAll(log.Outfile)
 	compareOutput(test, "apple\nbanana\n", string(bytes))
 }
+
+func TestTagsTree(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, tagName := range []string{"media/audio/podcast", "media/video", "media-old", "apple"} {
+		if _, err := store.AddTag(tagName); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	tagsCommand := TagsCommand{false, false, false}
+
+	// test
+
+	if err := tagsCommand.Exec(cli.Options{cli.Option{"--tree", "-t", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "apple\nmedia\n  audio\n    podcast\n  video\nmedia-old\n", string(bytes))
+}
+
+func TestTagsImplied(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false, 0, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := addTags(store, "apple/braeburn", "fruit", "food", "zucchini"); err != nil {
+		test.Fatal(err)
+	}
+
+	braeburnTag, err := store.TagByName("apple/braeburn")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, braeburnTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// implications added after tagging still apply
+	implyCommand := ImplyCommand{}
+	for _, pair := range [][]string{{"apple", "fruit"}, {"fruit", "food"}} {
+		if err := implyCommand.Exec(cli.Options{}, pair); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	tagsCommand := TagsCommand{}
+
+	// test
+
+	if err := tagsCommand.Exec(cli.Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tagsCommand.Exec(cli.Options{cli.Option{"--explicit", "-e", "", false, ""}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	log.Outfile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(log.Outfile)
+	compareOutput(test, "apple/braeburn\nfood\nfruit\napple/braeburn\n", string(bytes))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package commands
+
+import (
+	"fmt"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+type UndoCommand struct {
+	verbose bool
+}
+
+func (UndoCommand) Name() cli.CommandName {
+	return "undo"
+}
+
+func (UndoCommand) Synopsis() string {
+	return "Undo the most recent change"
+}
+
+func (UndoCommand) Description() string {
+	return `tmsu undo [COUNT]
+
+Reverses the changes made by the most recent command, or the COUNT most recent
+commands, that changed the database. Undone commands can be reapplied with
+'tmsu redo' until another change is made.
+
+The changes of the last 100 commands are recorded: use 'tmsu history' to list
+these.`
+}
+
+func (UndoCommand) Options() cli.Options {
+	return cli.Options{}
+}
+
+func (command UndoCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	count, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	for index := 0; index < count; index++ {
+		operation, err := store.Undo()
+		if err != nil {
+			return fmt.Errorf("could not undo: %v", err)
+		}
+		if operation == nil {
+			return fmt.Errorf("nothing to undo.")
+		}
+
+		log.Infof("undid '%v'.", operation.Description)
+	}
+
+	return nil
+}
+
+// unexported
+
+func parseCount(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 1, nil
+	case 1:
+		var count int
+		if _, err := fmt.Sscan(args[0], &count); err != nil || count < 1 {
+			return 0, fmt.Errorf("invalid count '%v'.", args[0])
+		}
+
+		return count, nil
+	}
+
+	return 0, fmt.Errorf("too many arguments.")
+}
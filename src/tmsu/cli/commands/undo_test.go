@@ -0,0 +1,173 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"os"
+	"testing"
+	"tmsu/cli"
+	"tmsu/storage"
+)
+
+func TestUndoRedo(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (TagCommand{}).Exec(cli.Options{}, []string{"/tmp/tmsu/a", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := (MergeCommand{}).Exec(cli.Options{}, []string{"apple", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := (UndoCommand{}).Exec(cli.Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "apple", "banana")
+
+	// test
+
+	if err := (UndoCommand{}).Exec(cli.Options{}, []string{"2"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a")
+
+	// test
+
+	if err := (RedoCommand{}).Exec(cli.Options{}, []string{"3"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a", "banana")
+
+	if err := (RedoCommand{}).Exec(cli.Options{}, []string{}); err == nil {
+		test.Fatal("Expected nothing to redo.")
+	}
+}
+
+func TestUndoConcurrentSessions(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	first, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	second, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := second.AddTag("banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	// ending the other session must not stop this session's changes being
+	// journaled
+	if err := second.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := first.AddTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := first.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	operations, err := store.Operations()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(operations) != 2 {
+		test.Fatalf("Expected two operations but are %v.", len(operations))
+	}
+
+	operation, err := store.Undo()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if operation == nil || operation.Id != operations[1].Id {
+		test.Fatal("Expected the later operation to be undone.")
+	}
+
+	tag, err := store.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag != nil {
+		test.Fatal("Tag 'apple' was not removed by undo.")
+	}
+}
+
+func expectPathTags(test *testing.T, path string, tagNames ...string) {
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tags, err := store.TagsForPath(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != len(tagNames) {
+		test.Fatalf("File '%v' has %v tags but expected %v.", path, len(tags), len(tagNames))
+	}
+	for index, tag := range tags {
+		if tag.Name != tagNames[index] {
+			test.Fatalf("File '%v' is tagged '%v' but expected '%v'.", path, tag.Name, tagNames[index])
+		}
+	}
+}
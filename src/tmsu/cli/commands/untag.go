@@ -44,24 +44,46 @@ func (UntagCommand) Description() string {
 	return `tmsu untag [OPTION]... FILE TAG...
 tmsu untag [OPTION]... --all FILE...
 tmsu untag [OPTION]... --tags "TAG..." FILE...
+tmsu untag [OPTION]... --from-stdin TAG...
 
-Disassociates FILE with the TAGs specified.`
+Disassociates FILE with the TAGs specified.
+
+With --from-stdin the files to untag are read from standard input, one per
+line, in addition to any specified with --all or --tags. With --null they are
+instead delimited by NUL characters, as output by 'find -print0' or
+'tmsu files -0':
+
+    $ tmsu files -0 draft | tmsu untag --null --all`
 }
 
 func (UntagCommand) Options() cli.Options {
-	return cli.Options{{"--all", "-a", "strip each file of all tags", false, ""},
+	return append(cli.Options{{"--all", "-a", "strip each file of all tags", false, ""},
 		{"--tags", "-t", "the set of tags to remove", true, ""},
-		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""}}
+		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""}},
+		stdinOptions...)
+}
+
+func (UntagCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{"--tags": {Tags: true}}
 }
 
 func (command UntagCommand) Exec(options cli.Options, args []string) error {
-	if len(args) < 1 {
+	if len(args) < 1 && !readsStdin(options) {
 		return fmt.Errorf("no arguments specified.")
 	}
 
 	command.verbose = options.HasOption("--verbose")
 	command.recursive = options.HasOption("--recursive")
 
+	var stdinPaths []string
+	if readsStdin(options) {
+		paths, err := readStdinPaths(options)
+		if err != nil {
+			return fmt.Errorf("could not read files from standard input: %v", err)
+		}
+		stdinPaths = paths
+	}
+
 	store, err := storage.Open()
 	if err != nil {
 		return fmt.Errorf("could not open storage: %v", err)
@@ -69,12 +91,11 @@ func (command UntagCommand) Exec(options cli.Options, args []string) error {
 	defer store.Close()
 
 	if options.HasOption("--all") {
-		if len(args) < 1 {
+		paths := append(args, stdinPaths...)
+		if len(paths) < 1 && !readsStdin(options) {
 			return fmt.Errorf("files to untag must be specified.")
 		}
 
-		paths := args
-
 		if err := command.untagPathsAll(store, paths); err != nil {
 			return err
 		}
@@ -84,8 +105,8 @@ func (command UntagCommand) Exec(options cli.Options, args []string) error {
 			return fmt.Errorf("set of tags to apply must be specified")
 		}
 
-		paths := args
-		if len(paths) < 1 {
+		paths := append(args, stdinPaths...)
+		if len(paths) < 1 && !readsStdin(options) {
 			return fmt.Errorf("at least one file to untag must be specified")
 		}
 
@@ -97,6 +118,19 @@ func (command UntagCommand) Exec(options cli.Options, args []string) error {
 		if err := command.untagPaths(store, paths, tagIds); err != nil {
 			return err
 		}
+	} else if readsStdin(options) {
+		if len(args) < 1 {
+			return fmt.Errorf("tags to remove must be specified.")
+		}
+
+		tagIds, err := command.lookupTagIds(store, args)
+		if err != nil {
+			return err
+		}
+
+		if err := command.untagPaths(store, stdinPaths, tagIds); err != nil {
+			return err
+		}
 	} else {
 		if len(args) < 2 {
 			return fmt.Errorf("tag to remove and files to untag must be specified.")
@@ -164,9 +198,9 @@ func (command UntagCommand) untagPathAll(store *storage.Storage, path string) er
 		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
 	}
 
-	file, err := store.FileByPath(absPath)
+	file, err := fileOrLinkedFile(store, absPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		return err
 	}
 	if file == nil {
 		return fmt.Errorf("%v: file is not tagged.", path)
@@ -211,9 +245,9 @@ func (command UntagCommand) untagPath(store *storage.Storage, path string, tagId
 		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
 	}
 
-	file, err := store.FileByPath(absPath)
+	file, err := fileOrLinkedFile(store, absPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		return err
 	}
 	if file == nil {
 		return fmt.Errorf("%v: file is not tagged.", path)
@@ -0,0 +1,414 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+	"unsafe"
+)
+
+type WatchCommand struct {
+	verbose bool
+	delay   time.Duration
+	json    bool
+}
+
+func (WatchCommand) Name() cli.CommandName {
+	return "watch"
+}
+
+func (WatchCommand) Synopsis() string {
+	return "Keep the database in sync with file-system changes"
+}
+
+func (WatchCommand) Description() string {
+	return `tmsu watch [OPTION]... [PATH]...
+
+Watches the directories containing tagged files for changes and keeps the
+database in sync, running until interrupted.
+
+Where PATHs are specified only the tagged files under these paths are watched.
+
+Files that are modified, renamed or moved between watched directories are
+repaired as they would be by the 'repair' command: the modification time, size
+and fingerprint of modified files are updated and moved files have their paths
+updated. As changes are seen as they happen, a file that is both moved and
+modified is followed by its inode number. Files that are moved outside of the
+watched directories are reported as missing.
+
+Bursts of changes are coalesced: changes are only processed once no further
+changes have been seen for the delay period (one second by default).
+
+Each watched directory uses an inotify watch. Should the system's limit be
+reached (see /proc/sys/fs/inotify/max_user_watches) a warning is shown and the
+remaining directories are not watched: raise the limit or run 'repair'
+periodically for these. The set of watched directories is refreshed every
+minute to pick up newly tagged files.`
+}
+
+func (WatchCommand) Options() cli.Options {
+	return cli.Options{{"--delay", "-D", "seconds to wait for further changes before updating the database", true, ""},
+		{"--format", "-F", "output format: text (default) or json", true, ""}}
+}
+
+func (WatchCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{
+		"--delay":  {},
+		"--format": {Values: []string{"text", "json"}}}
+}
+
+func (command WatchCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	command.delay = time.Second
+	if options.HasOption("--delay") {
+		seconds, err := strconv.ParseFloat(options.Get("--delay").Argument, 64)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid delay '%v': must be a number of seconds.", options.Get("--delay").Argument)
+		}
+
+		command.delay = time.Duration(seconds * float64(time.Second))
+	}
+
+	json, err := jsonFormat(options)
+	if err != nil {
+		return err
+	}
+	command.json = json
+
+	paths := make([]string, len(args))
+	for index, arg := range args {
+		absPath, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", arg, err)
+		}
+
+		paths[index] = absPath
+	}
+
+	watcher, err := newWatcher(command.verbose)
+	if err != nil {
+		return err
+	}
+	defer watcher.close()
+
+	if err := command.update(watcher, nil, false, paths); err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	return command.watch(watcher, paths, interrupt)
+}
+
+//- unexported
+
+// The maximum number of delay periods for which changes are deferred whilst
+// changes continue to be made.
+const maximumDeferrals = 10
+
+type watchEvents struct {
+	paths    []string
+	overflow bool
+}
+
+// Processes file-system events until a signal is received on the interrupt
+// channel.
+func (command WatchCommand) watch(watcher *watcher, paths []string, interrupt <-chan os.Signal) error {
+	events := make(chan watchEvents)
+	errors := make(chan error)
+
+	go func() {
+		for {
+			changedPaths, overflow, err := watcher.readEvents()
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			events <- watchEvents{changedPaths, overflow}
+		}
+	}()
+
+	refresh := time.NewTicker(time.Minute)
+	defer refresh.Stop()
+
+	pending := make(map[string]bool)
+	overflowed := false
+	var batchStart time.Time
+	var settle <-chan time.Time
+
+	for {
+		select {
+		case batch := <-events:
+			if len(pending) == 0 && !overflowed {
+				batchStart = time.Now()
+			}
+
+			for _, path := range batch.paths {
+				pending[path] = true
+			}
+			overflowed = overflowed || batch.overflow
+
+			// keep deferring whilst changes continue but not indefinitely
+			if settle == nil || time.Since(batchStart) < maximumDeferrals*command.delay {
+				settle = time.After(command.delay)
+			}
+		case <-settle:
+			settle = nil
+
+			changedPaths := make([]string, 0, len(pending))
+			for path, _ := range pending {
+				changedPaths = append(changedPaths, path)
+			}
+
+			if err := command.update(watcher, changedPaths, overflowed, paths); err != nil {
+				return err
+			}
+
+			pending = make(map[string]bool)
+			overflowed = false
+		case <-refresh.C:
+			if err := command.update(watcher, nil, false, paths); err != nil {
+				return err
+			}
+		case err := <-errors:
+			return fmt.Errorf("could not read file-system events: %v", err)
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// Repairs the changed paths and then refreshes the watches. The storage is
+// opened afresh for each update, as the server does for each request, so that
+// each settled batch of changes is journaled as a separate operation.
+func (command WatchCommand) update(watcher *watcher, changedPaths []string, overflowed bool, paths []string) error {
+	store, err := storage.Open()
+	if err != nil {
+		return fmt.Errorf("could not open storage: %v", err)
+	}
+	defer store.Close()
+
+	if err := command.repair(store, changedPaths, overflowed, paths); err != nil {
+		log.Warn(err)
+	}
+
+	return command.refresh(store, watcher, paths)
+}
+
+func (command WatchCommand) repair(store *storage.Storage, changedPaths []string, overflowed bool, paths []string) error {
+	repairCommand := RepairCommand{}
+	repairCommand.verbose = command.verbose
+	repairCommand.json = command.json
+	repairCommand.ignoreUntagged = true
+	repairCommand.followInodes = true
+
+	if overflowed {
+		log.Warn("file-system events were lost: checking all watched files.")
+
+		if len(paths) == 0 {
+			return repairCommand.repairDatabase(store)
+		}
+
+		return repairCommand.repairPaths(store, paths)
+	}
+
+	if len(changedPaths) == 0 {
+		return nil
+	}
+
+	if command.verbose {
+		log.Infof("checking %v changed paths.", len(changedPaths))
+	}
+
+	return repairCommand.repairPaths(store, changedPaths)
+}
+
+// Adds watches for any directories containing tagged files that are not yet
+// being watched.
+func (command WatchCommand) refresh(store *storage.Storage, watcher *watcher, paths []string) error {
+	var files database.Files
+	var err error
+
+	if len(paths) == 0 {
+		files, err = store.Files()
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err)
+		}
+	} else {
+		files, err = store.FilesByDirectories(paths)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			file, err := store.FileByPath(path)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+			if file != nil {
+				files = append(files, file)
+			}
+		}
+	}
+
+	for _, file := range files {
+		directory := file.Directory
+		if file.IsDir {
+			directory = file.Path()
+		}
+
+		if err := watcher.watch(directory); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const watchMask = syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+type watcher struct {
+	verbose      bool
+	fd           int
+	directories  map[int32]string
+	watched      map[string]bool
+	limitReached bool
+	buffer       []byte
+
+	// guards the directories, watched and limitReached members, which are
+	// shared with the goroutine reading events
+	lock sync.Mutex
+}
+
+func newWatcher(verbose bool) (*watcher, error) {
+	fd, err := syscall.InotifyInit()
+	if err != nil {
+		return nil, fmt.Errorf("could not initialise inotify: %v", err)
+	}
+
+	return &watcher{verbose: verbose, fd: fd, directories: make(map[int32]string), watched: make(map[string]bool), buffer: make([]byte, 64*1024)}, nil
+}
+
+func (watcher *watcher) close() {
+	syscall.Close(watcher.fd)
+}
+
+func (watcher *watcher) watch(directory string) error {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.watched[directory] || watcher.limitReached {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(watcher.fd, directory, watchMask)
+	if err != nil {
+		switch err {
+		case syscall.ENOSPC:
+			log.Warnf("%v: inotify watch limit reached: further directories will not be watched.", directory)
+			watcher.limitReached = true
+			return nil
+		case syscall.ENOENT, syscall.ENOTDIR:
+			return nil
+		case syscall.EACCES:
+			log.Warnf("%v: permission denied.", directory)
+			return nil
+		default:
+			return fmt.Errorf("%v: could not watch directory: %v", directory, err)
+		}
+	}
+
+	if watcher.verbose {
+		log.Infof("%v: watching directory.", directory)
+	}
+
+	watcher.directories[int32(wd)] = directory
+	watcher.watched[directory] = true
+
+	return nil
+}
+
+// Blocks until file-system events are available and then returns the paths
+// that have changed and whether events have been lost.
+func (watcher *watcher) readEvents() ([]string, bool, error) {
+	count, err := syscall.Read(watcher.fd, watcher.buffer)
+	if err != nil {
+		if err == syscall.EINTR {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	paths := make([]string, 0, 10)
+	overflow := false
+
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&watcher.buffer[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		name := strings.TrimRight(string(watcher.buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+		offset = nameStart + int(event.Len)
+
+		if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			overflow = true
+			continue
+		}
+
+		directory, found := watcher.directories[event.Wd]
+		if !found {
+			continue
+		}
+
+		if event.Mask&syscall.IN_IGNORED != 0 {
+			// directory has been removed so the watch is gone, freeing
+			// capacity for further watches
+			delete(watcher.directories, event.Wd)
+			delete(watcher.watched, directory)
+			watcher.limitReached = false
+			continue
+		}
+
+		if name == "" {
+			paths = append(paths, directory)
+		} else {
+			paths = append(paths, filepath.Join(directory, name))
+		}
+	}
+
+	return paths, overflow, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"os"
+	"testing"
+	"time"
+	"tmsu/cli"
+	"tmsu/storage"
+)
+
+func TestWatchRepairsMovedFile(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu-watch/a", "watched"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-watch")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-watch/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := WatchCommand{}
+
+	watcher, err := newWatcher(false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer watcher.close()
+
+	if err := command.refresh(store, watcher, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Rename("/tmp/tmsu-watch/a", "/tmp/tmsu-watch/b"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	paths, overflow, err := watcher.readEvents()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := command.repair(store, paths, overflow, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(paths) != 2 {
+		test.Fatalf("Expected two changed paths but are %v.", len(paths))
+	}
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		test.Fatalf("Expected one file but are %v", len(files))
+	}
+
+	if files[0].Path() != "/tmp/tmsu-watch/b" {
+		test.Fatalf("File rename was not repaired.")
+	}
+}
+
+func TestWatchRepairsChangesUntilInterrupted(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu-watch/a", "watched"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu-watch/sub/b", "removed"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu-watch")
+
+	tagCommand := TagCommand{}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-watch/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := tagCommand.Exec(cli.Options{}, []string{"/tmp/tmsu-watch/sub/b", "b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	command := WatchCommand{delay: 10 * time.Millisecond}
+
+	watcher, err := newWatcher(false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer watcher.close()
+
+	if err := command.update(watcher, nil, false, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	result := make(chan error, 1)
+
+	// test
+
+	go func() {
+		result <- command.watch(watcher, []string{}, interrupt)
+	}()
+
+	if err := os.RemoveAll("/tmp/tmsu-watch/sub"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Rename("/tmp/tmsu-watch/a", "/tmp/tmsu-watch/c"); err != nil {
+		test.Fatal(err)
+	}
+
+	// allow the changes to settle and be repaired
+	time.Sleep(500 * time.Millisecond)
+
+	if err := os.Rename("/tmp/tmsu-watch/c", "/tmp/tmsu-watch/d"); err != nil {
+		test.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	interrupt <- os.Interrupt
+
+	select {
+	case err := <-result:
+		if err != nil {
+			test.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		test.Fatal("Watch did not stop when interrupted.")
+	}
+
+	// validate
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.FileByPath("/tmp/tmsu-watch/d")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatalf("File rename was not repaired.")
+	}
+
+	// the two tag commands and a repair for each settled batch of changes
+	operations, err := store.Operations()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(operations) != 4 {
+		test.Fatalf("Expected each batch of changes to be journaled separately but there are %v operations.", len(operations))
+	}
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.watched["/tmp/tmsu-watch/sub"] {
+		test.Fatalf("Removed directory is still watched.")
+	}
+}
@@ -0,0 +1,488 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"tmsu/autotag"
+	"tmsu/cli"
+	"tmsu/log"
+	"tmsu/storage"
+)
+
+const defaultWebAddress = "localhost:8687"
+
+// The number of bytes of a text file shown as its preview.
+const previewLength = 64 * 1024
+
+type WebCommand struct {
+	verbose bool
+}
+
+func (WebCommand) Name() cli.CommandName {
+	return "web"
+}
+
+func (WebCommand) Synopsis() string {
+	return "Serve a web interface for browsing and tagging files"
+}
+
+func (WebCommand) Description() string {
+	return `tmsu web [OPTION]...
+
+Serves a web interface for browsing the tags, querying the files and tagging or
+untagging them, several at a time if need be. Images and text files are
+previewed. The interface is available at http://` + defaultWebAddress + `/ unless
+another address is specified.
+
+    $ tmsu web
+    $ tmsu web --address localhost:9000
+
+Tagging files with a tag from a tag group replaces their existing tag from the
+group. Should any of the selected files fail to be changed, none are.
+
+Only the files in the database can be previewed. Only requests made to the
+listen address or to localhost are served and changes made by other web sites
+are refused.`
+}
+
+func (WebCommand) Options() cli.Options {
+	return cli.Options{{"--address", "-a", "the address to listen on", true, ""}}
+}
+
+func (WebCommand) OptionCompletions() map[string]cli.Completion {
+	return map[string]cli.Completion{"--address": {}}
+}
+
+func (command WebCommand) Exec(options cli.Options, args []string) error {
+	command.verbose = options.HasOption("--verbose")
+
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments.")
+	}
+
+	address := defaultWebAddress
+	if options.HasOption("--address") {
+		address = options.Get("--address").Argument
+	}
+
+	log.Printf("serving on http://%v/", address)
+
+	handler, err := newWebHandler(address, command.verbose)
+	if err != nil {
+		return err
+	}
+
+	if err := http.ListenAndServe(address, handler); err != nil {
+		return fmt.Errorf("could not serve on %v: %v", address, err)
+	}
+
+	return nil
+}
+
+// unexported
+
+type webIndexPage struct {
+	Token    string
+	Query    string
+	Return   string
+	Tags     []apiTag
+	Searched bool
+	Files    []apiFile
+}
+
+type webFilePage struct {
+	Token  string
+	File   apiFile
+	Return string
+	Image  bool
+	Text   string
+}
+
+// Serves the web interface. As with the API, requests are handled one at a
+// time, each with its own storage session. The forms carry a token, chosen
+// afresh by each process, without which changes are refused.
+type webHandler struct {
+	mux     *http.ServeMux
+	mutex   sync.Mutex
+	address string
+	token   string
+	verbose bool
+}
+
+func newWebHandler(address string, verbose bool) (*webHandler, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("could not generate form token: %v", err)
+	}
+
+	handler := &webHandler{mux: http.NewServeMux(), address: address, token: hex.EncodeToString(token), verbose: verbose}
+
+	handler.mux.HandleFunc("/", handler.index)
+	handler.mux.HandleFunc("/file", handler.file)
+	handler.mux.HandleFunc("/content", handler.content)
+	handler.mux.HandleFunc("/tag", handler.tag)
+	handler.mux.HandleFunc("/untag", handler.untag)
+
+	return handler, nil
+}
+
+func (handler *webHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if handler.verbose {
+		log.Infof("%v %v", request.Method, request.URL)
+	}
+
+	if err := checkRequestSource(request, handler.address); err != nil {
+		writeErrorPage(writer, err)
+		return
+	}
+
+	handler.mux.ServeHTTP(writer, request)
+}
+
+// Calls the function with a storage session, showing an error page should it
+// fail.
+func (handler *webHandler) call(writer http.ResponseWriter, function func(store *storage.Storage) error) {
+	err := func() error {
+		handler.mutex.Lock()
+		defer handler.mutex.Unlock()
+
+		store, err := storage.Open()
+		if err != nil {
+			return apiError{http.StatusInternalServerError, fmt.Sprintf("could not open storage: %v", err)}
+		}
+		defer store.Close()
+
+		return function(store)
+	}()
+
+	if err != nil {
+		writeErrorPage(writer, err)
+	}
+}
+
+func (handler *webHandler) index(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		http.NotFound(writer, request)
+		return
+	}
+
+	handler.call(writer, func(store *storage.Storage) error {
+		query, searched := request.URL.Query()["query"]
+
+		page := webIndexPage{Token: handler.token, Searched: searched}
+		if searched {
+			page.Query = query[0]
+			page.Return = "/?query=" + url.QueryEscape(page.Query)
+		}
+
+		tags, err := tagCounts(store)
+		if err != nil {
+			return err
+		}
+		page.Tags = tags
+
+		if searched {
+			files, err := queryFiles(store, strings.Fields(page.Query))
+			if err != nil {
+				return err
+			}
+
+			page.Files = make([]apiFile, len(files))
+			for index, file := range files {
+				value, err := fileResponse(store, file)
+				if err != nil {
+					return err
+				}
+
+				page.Files[index] = value.(apiFile)
+			}
+		}
+
+		return renderPage(writer, "index", page)
+	})
+}
+
+func (handler *webHandler) file(writer http.ResponseWriter, request *http.Request) {
+	handler.call(writer, func(store *storage.Storage) error {
+		path, err := requestPath(request)
+		if err != nil {
+			return err
+		}
+
+		page := webFilePage{Token: handler.token, File: apiFile{Path: path}, Return: "/file?path=" + url.QueryEscape(path)}
+
+		file, err := store.FileByPath(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file != nil {
+			value, err := fileResponse(store, file)
+			if err != nil {
+				return err
+			}
+			page.File = value.(apiFile)
+
+			if !file.IsDir {
+				if err := page.preview(); err != nil {
+					log.Warnf("%v", err)
+				}
+			}
+		}
+
+		return renderPage(writer, "file", page)
+	})
+}
+
+func (handler *webHandler) content(writer http.ResponseWriter, request *http.Request) {
+	handler.call(writer, func(store *storage.Storage) error {
+		path, err := requestPath(request)
+		if err != nil {
+			return err
+		}
+
+		file, err := store.FileByPath(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil || file.IsDir {
+			return notFound("%v: file is not tagged.", path)
+		}
+
+		http.ServeFile(writer, request, path)
+		return nil
+	})
+}
+
+func (handler *webHandler) tag(writer http.ResponseWriter, request *http.Request) {
+	handler.update(writer, request, func(store *storage.Storage, paths, tagNames []string) error {
+		for _, path := range paths {
+			if err := applyTagNames(store, path, tagNames, true, handler.verbose); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (handler *webHandler) untag(writer http.ResponseWriter, request *http.Request) {
+	handler.update(writer, request, func(store *storage.Storage, paths, tagNames []string) error {
+		command := UntagCommand{verbose: handler.verbose}
+
+		tagIds, err := command.lookupTagIds(store, tagNames)
+		if err != nil {
+			return err
+		}
+
+		return command.untagPaths(store, paths, tagIds)
+	})
+}
+
+// Handles a form submission that changes the tags of the selected files,
+// returning to the page that submitted it.
+func (handler *webHandler) update(writer http.ResponseWriter, request *http.Request, function func(store *storage.Storage, paths, tagNames []string) error) {
+	if request.Method != "POST" {
+		http.Error(writer, "method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handler.call(writer, func(store *storage.Storage) error {
+		if err := request.ParseForm(); err != nil {
+			return badRequest("invalid form: %v", err)
+		}
+
+		token := request.PostForm.Get("token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(handler.token)) != 1 {
+			return forbidden("the form has expired: reload the page and try again.")
+		}
+
+		paths := request.PostForm["path"]
+		if len(paths) == 0 {
+			return badRequest("no files selected.")
+		}
+		for _, path := range paths {
+			if !strings.HasPrefix(path, "/") {
+				return badRequest("%v: path must be absolute.", path)
+			}
+		}
+
+		tagNames := strings.Fields(request.PostForm.Get("tags"))
+		if len(tagNames) == 0 {
+			return badRequest("no tags specified.")
+		}
+
+		// the selected files are all changed or, should any fail, none are
+		if err := store.InTransaction(func() error {
+			return function(store, paths, tagNames)
+		}); err != nil {
+			return err
+		}
+
+		location := request.PostForm.Get("return")
+		if !isLocalLocation(location) {
+			location = "/"
+		}
+
+		http.Redirect(writer, request, location, http.StatusSeeOther)
+		return nil
+	})
+}
+
+// Determines how the file can be previewed, reading the start of text files.
+func (page *webFilePage) preview() error {
+	mimeType, err := autotag.MimeType(page.File.Path)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		page.Image = true
+	case strings.HasPrefix(mimeType, "text/"):
+		file, err := os.Open(page.File.Path)
+		if err != nil {
+			return fmt.Errorf("%v: could not open file: %v", page.File.Path, err)
+		}
+		defer file.Close()
+
+		buffer := make([]byte, previewLength)
+		count, err := io.ReadFull(file, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("%v: could not read file: %v", page.File.Path, err)
+		}
+
+		page.Text = string(buffer[:count])
+	}
+
+	return nil
+}
+
+// Determines whether the location is a path within this site, such that a
+// redirect to it cannot leave the site.
+func isLocalLocation(location string) bool {
+	if !strings.HasPrefix(location, "/") || strings.HasPrefix(location, "//") || strings.HasPrefix(location, `/\`) {
+		return false
+	}
+
+	locationUrl, err := url.Parse(location)
+	return err == nil && locationUrl.Scheme == "" && locationUrl.Host == ""
+}
+
+func writeErrorPage(writer http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if apiErr, ok := err.(apiError); ok {
+		status = apiErr.status
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(status)
+	webTemplates.ExecuteTemplate(writer, "error", err.Error())
+}
+
+func renderPage(writer http.ResponseWriter, name string, data interface{}) error {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	return webTemplates.ExecuteTemplate(writer, name, data)
+}
+
+var webTemplates = template.Must(template.New("web").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>TMSU{{if .}}: {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+h1 a { color: inherit; text-decoration: none; }
+ul.tags { float: left; width: 14em; margin: 0 2em 0 0; padding: 0; list-style: none; }
+.tag { background: #e4ecf4; border-radius: 3px; padding: 0 0.3em; text-decoration: none; }
+table { border-collapse: collapse; }
+td { padding: 0.2em 0.5em; border-bottom: 1px solid #eee; }
+img { max-width: 100%; }
+pre { background: #f8f8f8; padding: 0.5em; overflow: auto; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1><a href="/">TMSU</a></h1>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" .Query}}
+<ul class="tags">
+{{range .Tags}}<li><a class="tag" href="/?query={{.Name}}">{{.Name}}</a> {{.FileCount}}</li>
+{{end}}</ul>
+<form action="/" method="get">
+<input name="query" value="{{.Query}}" size="40" placeholder="e.g. music -jazz (blank for all files)">
+<input type="submit" value="Search">
+</form>
+{{if .Searched}}
+<form action="/tag" method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="return" value="{{.Return}}">
+<p>{{len .Files}} file(s)</p>
+<table>
+{{range .Files}}<tr>
+<td><input type="checkbox" name="path" value="{{.Path}}"></td>
+<td><a href="/file?path={{.Path}}">{{.Path}}</a></td>
+<td>{{range .Tags}}<a class="tag" href="/?query={{.}}">{{.}}</a> {{end}}</td>
+</tr>
+{{end}}</table>
+<p>
+<input name="tags" size="40" placeholder="tags">
+<input type="submit" value="Tag">
+<input type="submit" formaction="/untag" value="Untag">
+</p>
+</form>
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "file"}}{{template "header" .File.Path}}
+<h2>{{.File.Path}}</h2>
+<p>{{range .File.Tags}}<a class="tag" href="/?query={{.}}">{{.}}</a> {{else}}No tags.{{end}}</p>
+<form action="/tag" method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="path" value="{{.File.Path}}">
+<input type="hidden" name="return" value="{{.Return}}">
+<input name="tags" size="40" placeholder="tags">
+<input type="submit" value="Tag">
+<input type="submit" formaction="/untag" value="Untag">
+</form>
+{{if .Image}}<p><img src="/content?path={{.File.Path}}"></p>{{end}}
+{{if .Text}}<pre>{{.Text}}</pre>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "error"}}{{template "header" ""}}
+<p class="error">{{.}}</p>
+<p><a href="javascript:history.back()">Back</a></p>
+{{template "footer"}}{{end}}
+`))
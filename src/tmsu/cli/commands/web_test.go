@@ -0,0 +1,223 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/cli"
+)
+
+func TestWebTagAndBrowse(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a.txt", "hello, world"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.txt")
+
+	if err := createFile("/tmp/tmsu/b.txt", "goodbye"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b.txt")
+
+	handler, err := newWebHandler("localhost:8687", false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// test & validate
+
+	form := url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt", "/tmp/tmsu/b.txt"}, "tags": {"apple banana"}, "return": {"/?query=apple"}}
+	page := expectPage(test, server, "POST", "/tag", form, http.StatusOK)
+	if !strings.Contains(page, "2 file(s)") {
+		test.Fatalf("Expected query results for both files but got: %v", page)
+	}
+	if !strings.Contains(page, `name="token" value="`+handler.token+`"`) {
+		test.Fatalf("Expected form token but got: %v", page)
+	}
+
+	expectPathTags(test, "/tmp/tmsu/a.txt", "apple", "banana")
+	expectPathTags(test, "/tmp/tmsu/b.txt", "apple", "banana")
+
+	form = url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/b.txt"}, "tags": {"apple"}}
+	expectPage(test, server, "POST", "/untag", form, http.StatusOK)
+
+	expectPathTags(test, "/tmp/tmsu/b.txt", "banana")
+
+	page = expectPage(test, server, "GET", "/?query=apple", nil, http.StatusOK)
+	if !strings.Contains(page, "/tmp/tmsu/a.txt") || strings.Contains(page, "/tmp/tmsu/b.txt") {
+		test.Fatalf("Expected only the file tagged 'apple' but got: %v", page)
+	}
+
+	page = expectPage(test, server, "GET", "/file?path=/tmp/tmsu/a.txt", nil, http.StatusOK)
+	if !strings.Contains(page, "<pre>hello, world</pre>") {
+		test.Fatalf("Expected text preview but got: %v", page)
+	}
+
+	page = expectPage(test, server, "GET", "/content?path=/tmp/tmsu/a.txt", nil, http.StatusOK)
+	compareOutput(test, "hello, world", page)
+
+	expectPage(test, server, "GET", "/content?path=/etc/passwd", nil, http.StatusNotFound)
+	expectPage(test, server, "GET", "/?query=missing", nil, http.StatusNotFound)
+	expectPage(test, server, "GET", "/tag", nil, http.StatusMethodNotAllowed)
+}
+
+func TestWebRefusesForgedRequests(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a.txt", "secret"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.txt")
+
+	handler, err := newWebHandler("localhost:8687", false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	form := url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt"}, "tags": {"apple"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusOK)
+
+	// test
+
+	form = url.Values{"path": {"/tmp/tmsu/a.txt"}, "tags": {"banana"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusForbidden)
+
+	form = url.Values{"token": {"guess"}, "path": {"/tmp/tmsu/a.txt"}, "tags": {"banana"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusForbidden)
+
+	form = url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt"}, "tags": {"banana"}}
+	expectRequestStatus(test, server, "POST", "/tag", form.Encode(), map[string]string{"Content-Type": "application/x-www-form-urlencoded", "Host": "evil.example", "Origin": "http://evil.example"}, http.StatusForbidden)
+	expectRequestStatus(test, server, "POST", "/untag", form.Encode(), map[string]string{"Content-Type": "application/x-www-form-urlencoded", "Origin": "http://evil.example"}, http.StatusForbidden)
+	expectRequestStatus(test, server, "GET", "/content?path=/tmp/tmsu/a.txt", "", map[string]string{"Host": "evil.example:8687"}, http.StatusForbidden)
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a.txt", "apple")
+}
+
+func TestWebBulkTagIsAtomic(test *testing.T) {
+	// set-up
+
+	databasePath := configureDatabase()
+	defer os.Remove(databasePath)
+
+	outPath, errPath, err := configureOutput()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	defer os.Remove(errPath)
+
+	if err := createFile("/tmp/tmsu/a.txt", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.txt")
+
+	if err := (GroupCommand{}).Exec(cli.Options{}, []string{"rating", "rating-3", "rating-4"}); err != nil {
+		test.Fatal(err)
+	}
+
+	handler, err := newWebHandler("localhost:8687", false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	form := url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt"}, "tags": {"rating-3"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusOK)
+
+	// test
+
+	form = url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt"}, "tags": {"rating-4"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusOK)
+
+	form = url.Values{"token": {handler.token}, "path": {"/tmp/tmsu/a.txt", "/tmp/tmsu/missing"}, "tags": {"apple"}}
+	expectPage(test, server, "POST", "/tag", form, http.StatusBadRequest)
+
+	// validate
+
+	expectPathTags(test, "/tmp/tmsu/a.txt", "rating-4")
+
+	for location, expected := range map[string]bool{"/?query=apple": true, "//evil.example": false,
+		`/\evil.example`: false, "http://evil.example/": false, "evil.example": false} {
+		if isLocalLocation(location) != expected {
+			test.Fatalf("Expected location '%v' to be local: %v.", location, expected)
+		}
+	}
+}
+
+func expectPage(test *testing.T, server *httptest.Server, method, path string, form url.Values, status int) string {
+	var response *http.Response
+	var err error
+
+	if method == "POST" {
+		response, err = http.PostForm(server.URL+path, form)
+	} else {
+		response, err = http.Get(server.URL + path)
+	}
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != status {
+		test.Fatalf("%v %v: expected status %v but got %v.", method, path, status, response.StatusCode)
+	}
+
+	bytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return string(bytes)
+}
@@ -19,6 +19,7 @@ package cli
 
 import (
 	"errors"
+	"strings"
 )
 
 func ValidateTagNames(tagNames []string) error {
@@ -32,8 +33,8 @@ func ValidateTagNames(tagNames []string) error {
 }
 
 func ValidateTagName(tagName string) error {
-	if tagName == "." || tagName == ".." {
-		return errors.New("Tag name cannot be '.' or '..'.")
+	if tagName == "" {
+		return errors.New("Tag name cannot be empty.")
 	}
 
 	if tagName[0] == '-' {
@@ -48,8 +49,15 @@ func ValidateTagName(tagName string) error {
 			return errors.New("tag names cannot contain '='.")
 		case ' ':
 			return errors.New("tag names cannot contain ' '.")
-		case '/':
-			return errors.New("tag names cannot contain '/'.")
+		}
+	}
+
+	for _, part := range strings.Split(tagName, "/") {
+		switch part {
+		case "":
+			return errors.New("tag names cannot start or end with '/' or contain '//'.")
+		case ".", "..":
+			return errors.New("Tag name cannot be '.' or '..'.")
 		}
 	}
 
@@ -0,0 +1,363 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Completes the partial word being typed given the preceding words of the
+// line, returning the candidate words.
+type Completer func(words []string, partial string) []string
+
+// Reads lines of input, providing line editing, history and completion where
+// the input is a terminal.
+type LineReader struct {
+	Prompt    string
+	History   []string
+	Completer Completer
+
+	input  *os.File
+	output *os.File
+	reader *bufio.Reader
+}
+
+func NewLineReader(input, output *os.File, prompt string) *LineReader {
+	return &LineReader{Prompt: prompt, History: make([]string, 0, 100), input: input, output: output, reader: bufio.NewReader(input)}
+}
+
+// Reads the next line, returning io.EOF at the end of the input.
+func (reader *LineReader) ReadLine() (string, error) {
+	state, err := makeRaw(reader.input)
+	if err != nil {
+		return reader.readPlainLine()
+	}
+	defer restoreTerminal(reader.input, state)
+
+	line, err := reader.editLine()
+	if err == nil && strings.TrimSpace(line) != "" {
+		reader.History = append(reader.History, line)
+	}
+
+	return line, err
+}
+
+// Splits a command line into words. Words are separated by whitespace, which
+// can be included in a word by quoting it or escaping it with a backslash.
+func SplitCommandLine(line string) ([]string, error) {
+	words := make([]string, 0, 10)
+
+	var word []rune
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word = append(word, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, string(word))
+				word = word[:0]
+				inWord = false
+			}
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote.")
+	}
+	if escaped {
+		return nil, errors.New("unterminated escape.")
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+
+	return words, nil
+}
+
+// Escapes the word such that SplitCommandLine reads it as a single word.
+func EscapeWord(word string) string {
+	var escaped []rune
+	for _, r := range word {
+		if unicode.IsSpace(r) || strings.ContainsRune(`\'"`, r) {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+
+	return string(escaped)
+}
+
+// unexported
+
+func (reader *LineReader) readPlainLine() (string, error) {
+	line, err := reader.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyReturn    = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+type lineEditor struct {
+	reader   *LineReader
+	line     []rune
+	position int
+}
+
+func (reader *LineReader) editLine() (string, error) {
+	editor := &lineEditor{reader: reader}
+	historyIndex := len(reader.History)
+	current := ""
+	completing := false
+
+	editor.redraw()
+
+	for {
+		r, _, err := reader.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		tabbed := false
+
+		switch r {
+		case keyReturn, keyLineFeed:
+			fmt.Fprint(reader.output, "\n")
+			return string(editor.line), nil
+		case keyCtrlC:
+			fmt.Fprint(reader.output, "^C\n")
+			editor.line, editor.position = nil, 0
+			historyIndex = len(reader.History)
+		case keyCtrlD:
+			if len(editor.line) == 0 {
+				fmt.Fprint(reader.output, "\n")
+				return "", io.EOF
+			}
+			editor.delete()
+		case keyCtrlA:
+			editor.position = 0
+		case keyCtrlE:
+			editor.position = len(editor.line)
+		case keyCtrlK:
+			editor.line = editor.line[:editor.position]
+		case keyCtrlU:
+			editor.line = editor.line[editor.position:]
+			editor.position = 0
+		case keyBackspace, keyCtrlH:
+			if editor.position > 0 {
+				editor.position--
+				editor.delete()
+			}
+		case keyTab:
+			editor.complete(completing)
+			tabbed = true
+		case keyEscape:
+			sequence := reader.readEscapeSequence()
+			switch sequence {
+			case "[A", "OA":
+				if historyIndex > 0 {
+					if historyIndex == len(reader.History) {
+						current = string(editor.line)
+					}
+					historyIndex--
+					editor.set(reader.History[historyIndex])
+				}
+			case "[B", "OB":
+				if historyIndex < len(reader.History) {
+					historyIndex++
+					if historyIndex == len(reader.History) {
+						editor.set(current)
+					} else {
+						editor.set(reader.History[historyIndex])
+					}
+				}
+			case "[C", "OC":
+				if editor.position < len(editor.line) {
+					editor.position++
+				}
+			case "[D", "OD":
+				if editor.position > 0 {
+					editor.position--
+				}
+			case "[H", "OH", "[1~":
+				editor.position = 0
+			case "[F", "OF", "[4~":
+				editor.position = len(editor.line)
+			case "[3~":
+				editor.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				editor.insert(string(r))
+			}
+		}
+
+		completing = tabbed
+		editor.redraw()
+	}
+}
+
+func (reader *LineReader) readEscapeSequence() string {
+	sequence := make([]rune, 0, 4)
+	for {
+		r, _, err := reader.reader.ReadRune()
+		if err != nil {
+			return string(sequence)
+		}
+
+		sequence = append(sequence, r)
+		if len(sequence) > 1 && (r == '~' || unicode.IsLetter(r)) {
+			return string(sequence)
+		}
+	}
+}
+
+func (editor *lineEditor) set(line string) {
+	editor.line = []rune(line)
+	editor.position = len(editor.line)
+}
+
+func (editor *lineEditor) insert(text string) {
+	runes := []rune(text)
+
+	line := make([]rune, 0, len(editor.line)+len(runes))
+	line = append(line, editor.line[:editor.position]...)
+	line = append(line, runes...)
+	line = append(line, editor.line[editor.position:]...)
+
+	editor.line = line
+	editor.position += len(runes)
+}
+
+func (editor *lineEditor) delete() {
+	if editor.position < len(editor.line) {
+		editor.line = append(editor.line[:editor.position], editor.line[editor.position+1:]...)
+	}
+}
+
+func (editor *lineEditor) redraw() {
+	output := editor.reader.output
+
+	fmt.Fprintf(output, "\r%v%v\x1b[K", editor.reader.Prompt, string(editor.line))
+	if back := len(editor.line) - editor.position; back > 0 {
+		fmt.Fprintf(output, "\x1b[%vD", back)
+	}
+}
+
+// Completes the word before the cursor. Where the candidates have no further
+// common prefix, repeated completion lists them.
+func (editor *lineEditor) complete(list bool) {
+	if editor.reader.Completer == nil {
+		return
+	}
+
+	start := editor.position
+	for start > 0 && !(unicode.IsSpace(editor.line[start-1]) && (start < 2 || editor.line[start-2] != '\\')) {
+		start--
+	}
+
+	words, err := SplitCommandLine(string(editor.line[:start]))
+	if err != nil {
+		return
+	}
+
+	partial, err := SplitCommandLine(string(editor.line[start:editor.position]))
+	if err != nil || len(partial) > 1 {
+		return
+	}
+	if len(partial) == 0 {
+		partial = []string{""}
+	}
+
+	candidates := editor.reader.Completer(words, partial[0])
+
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		suffix := " "
+		if strings.HasSuffix(candidates[0], "/") {
+			suffix = ""
+		}
+		editor.replace(start, EscapeWord(candidates[0])+suffix)
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) > len(partial[0]) {
+			editor.replace(start, EscapeWord(prefix))
+		} else if list {
+			fmt.Fprintf(editor.reader.output, "\n%v\n", strings.Join(candidates, "  "))
+		}
+	}
+}
+
+func (editor *lineEditor) replace(start int, text string) {
+	editor.line = append(editor.line[:start:start], editor.line[editor.position:]...)
+	editor.position = start
+	editor.insert(text)
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(test *testing.T) {
+	words, err := SplitCommandLine(`tag  "my song.mp3" it\'s\ good 'a "b"' ""`)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := []string{"tag", "my song.mp3", "it's good", `a "b"`, ""}
+	if !reflect.DeepEqual(words, expected) {
+		test.Fatalf("Expected words %q but were %q.", expected, words)
+	}
+
+	if _, err := SplitCommandLine(`tag "unterminated`); err == nil {
+		test.Fatal("Expected error for unterminated quote.")
+	}
+}
+
+func TestEscapeWord(test *testing.T) {
+	word := `my "song's" mp3\`
+
+	words, err := SplitCommandLine(EscapeWord(word) + " next")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := []string{word, "next"}
+	if !reflect.DeepEqual(words, expected) {
+		test.Fatalf("Expected words %q but were %q.", expected, words)
+	}
+}
+
+func TestReadLineFromFile(test *testing.T) {
+	file, err := ioutil.TempFile("", "tmsu-input")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := file.WriteString("tags a\r\nfiles b"); err != nil {
+		test.Fatal(err)
+	}
+	file.Seek(0, 0)
+
+	reader := NewLineReader(file, os.Stdout, "tmsu> ")
+
+	for _, expected := range []string{"tags a", "files b"} {
+		line, err := reader.ReadLine()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if line != expected {
+			test.Fatalf("Expected line '%v' but was '%v'.", expected, line)
+		}
+	}
+
+	if _, err := reader.ReadLine(); err != io.EOF {
+		test.Fatalf("Expected end of input but was %v.", err)
+	}
+}
@@ -19,6 +19,7 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 )
 
 type Parser struct {
@@ -47,6 +48,17 @@ func (parser *Parser) Parse(args []string) (commandName CommandName, options Opt
 			parseOptions = false
 		} else {
 			if parseOptions && arg[0] == '-' {
+				var argument string
+				hasArgument := false
+
+				if strings.HasPrefix(arg, "--") {
+					if equalsIndex := strings.Index(arg, "="); equalsIndex != -1 {
+						argument = arg[equalsIndex+1:]
+						hasArgument = true
+						arg = arg[:equalsIndex]
+					}
+				}
+
 				option := lookupOption(possibleOptions, arg)
 				if option == nil {
 					err = fmt.Errorf("invalid option '%v'.", arg)
@@ -54,8 +66,20 @@ func (parser *Parser) Parse(args []string) (commandName CommandName, options Opt
 				}
 
 				if option.HasArgument {
-					option.Argument = args[index+1]
-					index++
+					if hasArgument {
+						option.Argument = argument
+					} else {
+						if index+1 >= len(args) {
+							err = fmt.Errorf("option '%v' requires an argument.", arg)
+							return
+						}
+
+						option.Argument = args[index+1]
+						index++
+					}
+				} else if hasArgument {
+					err = fmt.Errorf("option '%v' does not take an argument.", arg)
+					return
 				}
 
 				options = append(options, *option)
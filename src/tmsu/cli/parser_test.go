@@ -78,3 +78,60 @@ func TestInvalidGlobalOption(test *testing.T) {
 		test.Fatal("Invalid option not identified.")
 	}
 }
+
+func TestParseOptionWithEqualsArgument(test *testing.T) {
+	command := testCommand{commandOptions: Options{Option{"--format", "-F", "format", true, ""}}}
+	parser := NewParser(Options{}, map[CommandName]Command{"a": command})
+
+	commandName, options, arguments, err := parser.Parse([]string{"a", "--format=json", "b"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if commandName != "a" {
+		test.Fatalf("Expected command name of 'a' but was '%v'.", commandName)
+	}
+	if len(options) != 1 {
+		test.Fatalf("Expected one option but were %v.", len(options))
+	}
+	if options[0].LongName != "--format" || options[0].Argument != "json" {
+		test.Fatalf("Expected option '--format' with argument 'json' but was '%v' with '%v'.", options[0].LongName, options[0].Argument)
+	}
+	if len(arguments) != 1 || arguments[0] != "b" {
+		test.Fatalf("Expected argument of 'b' but were %v.", arguments)
+	}
+}
+
+func TestParseMissingOptionArgument(test *testing.T) {
+	command := testCommand{commandOptions: Options{Option{"--format", "-F", "format", true, ""}}}
+	parser := NewParser(Options{}, map[CommandName]Command{"a": command})
+
+	_, _, _, err := parser.Parse([]string{"a", "--format"})
+
+	if err == nil {
+		test.Fatal("Missing option argument not identified.")
+	}
+}
+
+type testCommand struct {
+	commandOptions Options
+}
+
+func (testCommand) Name() CommandName {
+	return "a"
+}
+
+func (testCommand) Synopsis() string {
+	return ""
+}
+
+func (testCommand) Description() string {
+	return ""
+}
+
+func (command testCommand) Options() Options {
+	return command.commandOptions
+}
+
+func (testCommand) Exec(options Options, args []string) error {
+	return nil
+}
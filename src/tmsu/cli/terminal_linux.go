@@ -0,0 +1,60 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Puts the terminal into raw mode, returning its previous state. Output
+// processing is left enabled so that newlines are still written as such. Fails
+// if the file is not a terminal.
+func makeRaw(file *os.File) (*syscall.Termios, error) {
+	var state syscall.Termios
+	if err := ioctl(file, syscall.TCGETS, &state); err != nil {
+		return nil, err
+	}
+
+	raw := state
+	raw.Iflag &^= syscall.ICRNL | syscall.INLCR | syscall.IXON | syscall.ISTRIP
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(file, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// Restores the terminal to the specified state.
+func restoreTerminal(file *os.File, state *syscall.Termios) error {
+	return ioctl(file, syscall.TCSETS, state)
+}
+
+func ioctl(file *os.File, request uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
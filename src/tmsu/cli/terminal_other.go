@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+type terminalState struct{}
+
+// Line editing is only supported on Linux: elsewhere input is read a line at a
+// time as is.
+func makeRaw(file *os.File) (*terminalState, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
+
+func restoreTerminal(file *os.File, state *terminalState) error {
+	return nil
+}
@@ -36,3 +36,29 @@ func GetDatabasePath() (string, error) {
 
 	return filepath.Join(u.HomeDir, ".tmsu/default.db"), nil
 }
+
+func GetRulesPath() (string, error) {
+	if path := os.Getenv("TMSU_RULES"); path != "" {
+		return path, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve current user: %v", err)
+	}
+
+	return filepath.Join(u.HomeDir, ".tmsu/rules"), nil
+}
+
+func GetHistoryPath() (string, error) {
+	if path := os.Getenv("TMSU_HISTORY"); path != "" {
+		return path, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve current user: %v", err)
+	}
+
+	return filepath.Join(u.HomeDir, ".tmsu/history"), nil
+}
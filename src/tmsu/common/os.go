@@ -19,8 +19,31 @@ package common
 
 import (
 	"os"
+	"syscall"
 )
 
 func IsRegular(fileInfo os.FileInfo) bool {
 	return fileInfo.Mode()&os.ModeType == 0
 }
+
+// Retrieves the device and inode numbers of the file, or zeroes if these are
+// not available.
+func DeviceAndInode(fileInfo os.FileInfo) (uint64, uint64) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+
+	return uint64(stat.Dev), uint64(stat.Ino)
+}
+
+// Retrieves the number of hard links to the file, or one if this is not
+// available.
+func LinkCount(fileInfo os.FileInfo) uint64 {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+
+	return uint64(stat.Nlink)
+}
@@ -26,25 +26,40 @@ import (
 
 func main() {
 	helpCommand := &commands.HelpCommand{}
+	shellCommand := &commands.ShellCommand{}
+	batchCommand := &commands.BatchCommand{}
+	completionCommand := &commands.CompletionCommand{}
 	commands := map[cli.CommandName]cli.Command{
-		"copy":    commands.CopyCommand{},
-		"delete":  commands.DeleteCommand{},
-		"dupes":   commands.DupesCommand{},
-		"files":   commands.FilesCommand{},
-		"help":    helpCommand,
-		"imply":   commands.ImplyCommand{},
-		"merge":   commands.MergeCommand{},
-		"mount":   commands.MountCommand{},
-		"rename":  commands.RenameCommand{},
-		"repair":  commands.RepairCommand{},
-		"stats":   commands.StatsCommand{},
-		"status":  commands.StatusCommand{},
-		"tag":     commands.TagCommand{},
-		"tags":    commands.TagsCommand{},
-		"unmount": commands.UnmountCommand{},
-		"untag":   commands.UntagCommand{},
-		"version": commands.VersionCommand{},
-		"vfs":     commands.VfsCommand{},
+		"autotag":    commands.AutotagCommand{},
+		"batch":      batchCommand,
+		"completion": completionCommand,
+		"copy":       commands.CopyCommand{},
+		"delete":     commands.DeleteCommand{},
+		"dupes":      commands.DupesCommand{},
+		"files":      commands.FilesCommand{},
+		"group":      commands.GroupCommand{},
+		"help":       helpCommand,
+		"history":    commands.HistoryCommand{},
+		"imply":      commands.ImplyCommand{},
+		"log":        commands.LogCommand{},
+		"merge":      commands.MergeCommand{},
+		"mount":      commands.MountCommand{},
+		"redo":       commands.RedoCommand{},
+		"rename":     commands.RenameCommand{},
+		"repair":     commands.RepairCommand{},
+		"serve":      commands.ServeCommand{},
+		"shell":      shellCommand,
+		"stats":      commands.StatsCommand{},
+		"status":     commands.StatusCommand{},
+		"tag":        commands.TagCommand{},
+		"tags":       commands.TagsCommand{},
+		"undo":       commands.UndoCommand{},
+		"unmount":    commands.UnmountCommand{},
+		"untag":      commands.UntagCommand{},
+		"version":    commands.VersionCommand{},
+		"watch":      commands.WatchCommand{},
+		"web":        commands.WebCommand{},
+		"vfs":        commands.VfsCommand{},
 	}
 	helpCommand.Commands = commands
 
@@ -53,6 +68,12 @@ func main() {
 		cli.Option{"--version", "-V", "show version information and exit", false, ""}}
 
 	parser := cli.NewParser(globalOptions, commands)
+	shellCommand.Commands = commands
+	shellCommand.Parser = parser
+	batchCommand.Commands = commands
+	batchCommand.Parser = parser
+	completionCommand.Commands = commands
+	completionCommand.GlobalOptions = globalOptions
 	commandName, options, arguments, err := parser.Parse(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
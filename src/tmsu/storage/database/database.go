@@ -23,11 +23,24 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"os"
 	"path/filepath"
+	"strings"
 	"tmsu/common"
 )
 
 type Database struct {
-	connection *sql.DB
+	pool *sql.DB
+
+	// the pool or, whilst a transaction is in progress, the transaction
+	connection connection
+
+	transaction *sql.Tx
+}
+
+// The methods common to the connection pool and a transaction.
+type connection interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 func Open() (*Database, error) {
@@ -49,20 +62,167 @@ func OpenAt(path string) (*Database, error) {
 		return nil, errors.New("could not open database: " + err.Error())
 	}
 
-	database := Database{connection}
+	// the journal state is held by the connection so only one is used
+	connection.SetMaxOpenConns(1)
+
+	database := Database{connection, connection, nil}
+
+	if err := database.checkUpgraded(); err != nil {
+		connection.Close()
+		return nil, err
+	}
 
 	err = database.CreateSchema()
 	if err != nil {
+		connection.Close()
 		return nil, errors.New("could not create database schema: " + err.Error())
 	}
 
+	if err := database.createJournalState(); err != nil {
+		connection.Close()
+		return nil, errors.New("could not create journal state: " + err.Error())
+	}
+
 	return &database, nil
 }
 
 func (db *Database) Close() error {
-	return db.connection.Close()
+	if db.transaction != nil {
+		db.transaction.Rollback()
+	}
+
+	return db.pool.Close()
+}
+
+// Starts a transaction: subsequent changes are only made permanent upon
+// Commit.
+func (db *Database) Begin() error {
+	if db.transaction != nil {
+		return errors.New("transaction already in progress.")
+	}
+
+	transaction, err := db.pool.Begin()
+	if err != nil {
+		return err
+	}
+
+	db.transaction = transaction
+	db.connection = transaction
+
+	return nil
+}
+
+// Commits the transaction in progress.
+func (db *Database) Commit() error {
+	if db.transaction == nil {
+		return errors.New("no transaction in progress.")
+	}
+
+	err := db.transaction.Commit()
+	db.transaction = nil
+	db.connection = db.pool
+
+	return err
+}
+
+// Abandons the changes made within the transaction in progress.
+func (db *Database) Rollback() error {
+	if db.transaction == nil {
+		return errors.New("no transaction in progress.")
+	}
+
+	err := db.transaction.Rollback()
+	db.transaction = nil
+	db.connection = db.pool
+
+	return err
+}
+
+// Marks a point within the transaction in progress to which the subsequent
+// changes can be rolled back.
+func (db *Database) Savepoint(name string) error {
+	_, err := db.connection.Exec("SAVEPOINT " + name)
+	return err
 }
 
+// Removes the savepoint, keeping the changes made since it.
+func (db *Database) ReleaseSavepoint(name string) error {
+	_, err := db.connection.Exec("RELEASE " + name)
+	return err
+}
+
+// Abandons the changes made since the savepoint, which is removed.
+func (db *Database) RollbackToSavepoint(name string) error {
+	if _, err := db.connection.Exec("ROLLBACK TO " + name); err != nil {
+		return err
+	}
+
+	return db.ReleaseSavepoint(name)
+}
+
+// Runs the function such that its changes are abandoned should it fail: within
+// a new transaction or, if one is already in progress, a savepoint.
+func (db *Database) InTransaction(function func() error) error {
+	if db.transaction != nil {
+		if err := db.Savepoint("in_transaction"); err != nil {
+			return err
+		}
+
+		if err := function(); err != nil {
+			db.RollbackToSavepoint("in_transaction")
+			return err
+		}
+
+		return db.ReleaseSavepoint("in_transaction")
+	}
+
+	if err := db.Begin(); err != nil {
+		return err
+	}
+
+	if err := function(); err != nil {
+		db.Rollback()
+		return err
+	}
+
+	return db.Commit()
+}
+
+// unexported
+
+// Runs the function within the transaction in progress or, if there is none,
+// within a new transaction that is committed should the function succeed.
+func (db *Database) withTransaction(function func(connection connection) error) error {
+	if db.transaction != nil {
+		return function(db.transaction)
+	}
+
+	transaction, err := db.pool.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := function(transaction); err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// Builds a pattern, for use with LIKE ... ESCAPE '\', that matches the paths
+// beneath the specified directory.
+func likeDescendants(path string) string {
+	prefix := filepath.Clean(path)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("Could not get count.")
@@ -0,0 +1,115 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// A directory listing recorded during a file-system scan.
+type CachedDirectory struct {
+	Path    string
+	Device  uint64
+	Inode   uint64
+	ModTime time.Time
+	Entries []string // child names, suffixed with '/' for directories
+}
+
+type CachedDirectories []*CachedDirectory
+
+// Retrieves the cached listings for the specified directory and those beneath it.
+func (db *Database) CachedDirectoriesByPath(path string) (CachedDirectories, error) {
+	sql := `SELECT path, device, inode, mod_time, entries
+            FROM directory_cache
+            WHERE path = ? OR path LIKE ? ESCAPE '\'`
+
+	rows, err := db.connection.Query(sql, path, likeDescendants(path))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readCachedDirectories(rows, make(CachedDirectories, 0, 10))
+}
+
+// Adds or replaces the cached listings for the specified directories.
+func (db *Database) UpdateCachedDirectories(directories CachedDirectories) error {
+	sql := `INSERT OR REPLACE INTO directory_cache (path, device, inode, mod_time, entries)
+            VALUES (?, ?, ?, ?, ?)`
+
+	return db.withTransaction(func(transaction connection) error {
+		for _, directory := range directories {
+			entries, err := json.Marshal(directory.Entries)
+			if err != nil {
+				return err
+			}
+
+			_, err = transaction.Exec(sql, directory.Path, int64(directory.Device), int64(directory.Inode), directory.ModTime, string(entries))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Removes the cached listings for the specified directories.
+func (db *Database) DeleteCachedDirectories(paths []string) error {
+	sql := `DELETE FROM directory_cache
+            WHERE path = ?`
+
+	return db.withTransaction(func(transaction connection) error {
+		for _, path := range paths {
+			if _, err := transaction.Exec(sql, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// unexported
+
+func readCachedDirectories(rows *sql.Rows, directories CachedDirectories) (CachedDirectories, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var path, entries string
+		var device, inode int64
+		var modTime time.Time
+		err := rows.Scan(&path, &device, &inode, &modTime, &entries)
+		if err != nil {
+			return nil, err
+		}
+
+		directory := &CachedDirectory{path, uint64(device), uint64(inode), modTime, nil}
+		if err := json.Unmarshal([]byte(entries), &directory.Entries); err != nil {
+			return nil, err
+		}
+
+		directories = append(directories, directory)
+	}
+
+	return directories, nil
+}
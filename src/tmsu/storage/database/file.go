@@ -22,6 +22,7 @@ import (
 	"errors"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 	"tmsu/fingerprint"
 )
@@ -35,6 +36,8 @@ type File struct {
 	ModTime     time.Time
 	Size        int64
 	IsDir       bool
+	Device      uint64
+	Inode       uint64
 }
 
 type Files []*File
@@ -72,7 +75,7 @@ func (db *Database) FileCount() (uint, error) {
 
 // The complete set of tracked files.
 func (db *Database) Files() (Files, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
 	        FROM file
 	        ORDER BY directory || '/' || name`
 
@@ -87,7 +90,7 @@ func (db *Database) Files() (Files, error) {
 
 // Retrieves a specific file.
 func (db *Database) File(id uint) (*File, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
 	        FROM file
 	        WHERE id = ?`
 
@@ -105,7 +108,7 @@ func (db *Database) FileByPath(path string) (*File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
 	        FROM file
 	        WHERE directory = ? AND name = ?`
 
@@ -120,12 +123,12 @@ func (db *Database) FileByPath(path string) (*File, error) {
 
 // Retrieves all files that are under the specified directory.
 func (db *Database) FilesByDirectory(path string) (Files, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
             FROM file
-            WHERE directory = ? OR directory LIKE ?
+            WHERE directory = ? OR directory LIKE ? ESCAPE '\'
             ORDER BY directory || '/' || name`
 
-	rows, err := db.connection.Query(sql, path, filepath.Clean(path+"/%"))
+	rows, err := db.connection.Query(sql, path, likeDescendants(path))
 	if err != nil {
 		return nil, err
 	}
@@ -151,7 +154,7 @@ func (db *Database) FileCountByFingerprint(fingerprint fingerprint.Fingerprint)
 
 // Retrieves the set of files with the specified fingerprint.
 func (db *Database) FilesByFingerprint(fingerprint fingerprint.Fingerprint) (Files, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
 	        FROM file
 	        WHERE fingerprint = ?
 	        ORDER BY directory || '/' || name`
@@ -165,6 +168,22 @@ func (db *Database) FilesByFingerprint(fingerprint fingerprint.Fingerprint) (Fil
 	return readFiles(rows, make(Files, 0, 1))
 }
 
+// Retrieves the set of files with the specified device and inode numbers.
+func (db *Database) FilesByInode(device, inode uint64) (Files, error) {
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
+	        FROM file
+	        WHERE device = ? AND inode = ?
+	        ORDER BY directory || '/' || name`
+
+	rows, err := db.connection.Query(sql, int64(device), int64(inode))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(Files, 0, 1))
+}
+
 // Retrieves the count of files with the specified tag.
 func (db *Database) FileCountWithTag(tagId uint) (uint, error) {
 	sql := `SELECT count(1)
@@ -182,7 +201,7 @@ func (db *Database) FileCountWithTag(tagId uint) (uint, error) {
 
 // Retrieves the set of files with the specified tag.
 func (db *Database) FilesWithTag(tagId uint) (Files, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
             FROM file
             WHERE id IN (
                 SELECT file_id
@@ -238,7 +257,7 @@ func (db *Database) FileCountWithTags(tagIds []uint) (uint, error) {
 func (db *Database) FilesWithTags(tagIds []uint) (Files, error) {
 	tagCount := len(tagIds)
 
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
             FROM file
             WHERE id IN (
                 SELECT file_id
@@ -270,9 +289,36 @@ func (db *Database) FilesWithTags(tagIds []uint) (Files, error) {
 	return readFiles(rows, make(Files, 0, 10))
 }
 
+// Retrieves the set of files with any of the specified tags.
+func (db *Database) FilesWithAnyTag(tagIds []uint) (Files, error) {
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
+            FROM file
+            WHERE id IN (
+                SELECT file_id
+                FROM file_tag
+                WHERE tag_id IN (?`
+	sql += strings.Repeat(",?", len(tagIds)-1)
+	sql += `)
+            )
+            ORDER BY directory || '/' || name`
+
+	params := make([]interface{}, len(tagIds))
+	for index, tagId := range tagIds {
+		params[index] = tagId
+	}
+
+	rows, err := db.connection.Query(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(Files, 0, 10))
+}
+
 // Retrieves the sets of duplicate files within the database.
 func (db *Database) DuplicateFiles() ([]Files, error) {
-	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
             FROM file
             WHERE fingerprint IN (
                 SELECT fingerprint
@@ -303,7 +349,8 @@ func (db *Database) DuplicateFiles() ([]Files, error) {
 		var modTime time.Time
 		var size int64
 		var isDir bool
-		err = rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+		var device, inode int64
+		err = rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir, &device, &inode)
 		if err != nil {
 			return nil, err
 		}
@@ -318,7 +365,7 @@ func (db *Database) DuplicateFiles() ([]Files, error) {
 			previousFingerprint = fingerprint
 		}
 
-		fileSet = append(fileSet, &File{fileId, directory, name, fingerprint, modTime, size, isDir})
+		fileSet = append(fileSet, &File{fileId, directory, name, fingerprint, modTime, size, isDir, uint64(device), uint64(inode)})
 	}
 
 	// ensure last file set is added
@@ -329,15 +376,34 @@ func (db *Database) DuplicateFiles() ([]Files, error) {
 	return fileSets, nil
 }
 
+// Retrieves the set of files that have no tags applied.
+func (db *Database) UntaggedFiles() (Files, error) {
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir, device, inode
+            FROM file
+            WHERE id NOT IN (
+                SELECT DISTINCT file_id
+                FROM file_tag
+            )
+            ORDER BY directory || '/' || name`
+
+	rows, err := db.connection.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(Files, 0, 10))
+}
+
 // Adds a file to the database.
-func (db *Database) InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*File, error) {
+func (db *Database) InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, device, inode uint64) (*File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
-	sql := `INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
-	        VALUES (?, ?, ?, ?, ?, ?)`
+	sql := `INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir, device, inode)
+	        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := db.connection.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir)
+	result, err := db.connection.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, int64(device), int64(inode))
 	if err != nil {
 		return nil, err
 	}
@@ -355,19 +421,19 @@ func (db *Database) InsertFile(path string, fingerprint fingerprint.Fingerprint,
 		return nil, errors.New("expected exactly one row to be affected.")
 	}
 
-	return &File{uint(id), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &File{uint(id), directory, name, fingerprint, modTime, size, isDir, device, inode}, nil
 }
 
 // Updates a file in the database.
-func (db *Database) UpdateFile(fileId uint, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*File, error) {
+func (db *Database) UpdateFile(fileId uint, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, device, inode uint64) (*File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
 	sql := `UPDATE file
-	        SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?
+	        SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?, device = ?, inode = ?
 	        WHERE id = ?`
 
-	result, err := db.connection.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, int(fileId))
+	result, err := db.connection.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, int64(device), int64(inode), int(fileId))
 	if err != nil {
 		return nil, err
 	}
@@ -380,7 +446,7 @@ func (db *Database) UpdateFile(fileId uint, path string, fingerprint fingerprint
 		return nil, errors.New("expected exactly one row to be affected.")
 	}
 
-	return &File{uint(fileId), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &File{uint(fileId), directory, name, fingerprint, modTime, size, isDir, device, inode}, nil
 }
 
 // Removes a file from the database.
@@ -412,6 +478,27 @@ func (db *Database) DeleteFile(fileId uint) error {
 	return nil
 }
 
+// Removes the files that have no tags applied.
+func (db *Database) DeleteUntaggedFiles() (uint, error) {
+	sql := `DELETE FROM file
+            WHERE id NOT IN (
+                SELECT DISTINCT file_id
+                FROM file_tag
+            )`
+
+	result, err := db.connection.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(rowsAffected), nil
+}
+
 //
 
 func readFile(rows *sql.Rows) (*File, error) {
@@ -427,12 +514,13 @@ func readFile(rows *sql.Rows) (*File, error) {
 	var modTime time.Time
 	var size int64
 	var isDir bool
-	err := rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+	var device, inode int64
+	err := rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir, &device, &inode)
 	if err != nil {
 		return nil, err
 	}
 
-	return &File{fileId, directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir}, nil
+	return &File{fileId, directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir, uint64(device), uint64(inode)}, nil
 }
 
 func readFiles(rows *sql.Rows, files Files) (Files, error) {
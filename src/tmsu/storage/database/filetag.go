@@ -23,8 +23,9 @@ import (
 )
 
 type FileTag struct {
-	FileId uint
-	TagId  uint
+	FileId   uint
+	TagId    uint
+	Explicit bool // false if applied by 'imply --apply'
 }
 
 type FileTags []*FileTag
@@ -62,7 +63,7 @@ func (db *Database) FileTagCount() (uint, error) {
 
 // Retrieves the complete set of file tags.
 func (db *Database) FileTags() (FileTags, error) {
-	sql := `SELECT file_id, tag_id
+	sql := `SELECT file_id, tag_id, explicit
 	        FROM file_tag`
 
 	rows, err := db.connection.Query(sql)
@@ -91,9 +92,10 @@ func (db *Database) FileTagCountByFileId(fileId uint) (uint, error) {
 
 // Retrieves the set of file tags with the specified tag ID.
 func (db *Database) FileTagsByTagId(tagId uint) (FileTags, error) {
-	sql := `SELECT file_id, tag_id
+	sql := `SELECT file_id, tag_id, explicit
 	        FROM file_tag
-	        WHERE tag_id = ?1`
+	        WHERE tag_id = ?1
+	        ORDER BY file_id`
 
 	rows, err := db.connection.Query(sql, tagId)
 	if err != nil {
@@ -106,9 +108,10 @@ func (db *Database) FileTagsByTagId(tagId uint) (FileTags, error) {
 
 // Retrieves the set of file tags with the specified file ID.
 func (db *Database) FileTagsByFileId(fileId uint) (FileTags, error) {
-	sql := `SELECT file_id, tag_id
+	sql := `SELECT file_id, tag_id, explicit
             FROM file_tag
-            WHERE file_id = ?1`
+            WHERE file_id = ?1
+            ORDER BY tag_id`
 
 	rows, err := db.connection.Query(sql, fileId)
 	if err != nil {
@@ -119,7 +122,7 @@ func (db *Database) FileTagsByFileId(fileId uint) (FileTags, error) {
 	return readFileTags(rows, make(FileTags, 0, 10))
 }
 
-// Adds a file tag.
+// Adds a file tag. An existing implied file tag becomes explicit.
 func (db *Database) AddFileTag(fileId, tagId uint) (*FileTag, error) {
 	sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id)
             VALUES (?1, ?2)`
@@ -129,7 +132,29 @@ func (db *Database) AddFileTag(fileId, tagId uint) (*FileTag, error) {
 		return nil, err
 	}
 
-	return &FileTag{fileId, tagId}, nil
+	sql = `UPDATE file_tag
+           SET explicit = 1
+           WHERE file_id = ?1 AND tag_id = ?2 AND explicit = 0`
+
+	_, err = db.connection.Exec(sql, fileId, tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTag{fileId, tagId, true}, nil
+}
+
+// Adds an implied file tag, unless the file already has the tag.
+func (db *Database) AddImpliedFileTag(fileId, tagId uint) (*FileTag, error) {
+	sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id, explicit)
+            VALUES (?1, ?2, 0)`
+
+	_, err := db.connection.Exec(sql, fileId, tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTag{fileId, tagId, false}, nil
 }
 
 // Adds a set of file tags.
@@ -215,8 +240,8 @@ func (db *Database) DeleteFileTagsByTagId(tagId uint) error {
 
 // Copies file tags from one tag to another.
 func (db *Database) CopyFileTags(sourceTagId uint, destTagId uint) error {
-	sql := `INSERT INTO file_tag (file_id, tag_id)
-            SELECT file_id, ?2
+	sql := `INSERT INTO file_tag (file_id, tag_id, explicit)
+            SELECT file_id, ?2, explicit
             FROM file_tag
             WHERE tag_id = ?1`
 
@@ -237,12 +262,13 @@ func readFileTags(rows *sql.Rows, fileTags FileTags) (FileTags, error) {
 		}
 
 		var fileId, tagId uint
-		err := rows.Scan(&fileId, &tagId)
+		var explicit bool
+		err := rows.Scan(&fileId, &tagId, &explicit)
 		if err != nil {
 			return nil, err
 		}
 
-		fileTags = append(fileTags, &FileTag{fileId, tagId})
+		fileTags = append(fileTags, &FileTag{fileId, tagId, explicit})
 	}
 
 	return fileTags, nil
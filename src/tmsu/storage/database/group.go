@@ -0,0 +1,188 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+)
+
+// A set of mutually exclusive tags: at most one member may be applied to a
+// file.
+type TagGroup struct {
+	Id   uint
+	Name string
+	Tags Tags
+}
+
+type TagGroups []*TagGroup
+
+// Retrieves the complete set of tag groups along with their members.
+func (db *Database) TagGroups() (TagGroups, error) {
+	sql := `SELECT g.id, g.name, t.id, t.name
+            FROM tag_group g
+            LEFT JOIN tag_group_member m ON m.group_id = g.id
+            LEFT JOIN tag t ON t.id = m.tag_id
+            ORDER BY g.name, t.name`
+
+	rows, err := db.connection.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagGroups(rows, make(TagGroups, 0, 10))
+}
+
+// Retrieves the tag group with the specified name.
+func (db *Database) TagGroupByName(name string) (*TagGroup, error) {
+	sql := `SELECT g.id, g.name, t.id, t.name
+            FROM tag_group g
+            LEFT JOIN tag_group_member m ON m.group_id = g.id
+            LEFT JOIN tag t ON t.id = m.tag_id
+            WHERE g.name = ?
+            ORDER BY t.name`
+
+	rows, err := db.connection.Query(sql, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups, err := readTagGroups(rows, make(TagGroups, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	return groups[0], nil
+}
+
+// Adds a tag group.
+func (db *Database) InsertTagGroup(name string) (*TagGroup, error) {
+	sql := `INSERT INTO tag_group (name)
+	        VALUES (?)`
+
+	result, err := db.connection.Exec(sql, name)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TagGroup{uint(id), name, Tags{}}, nil
+}
+
+// Deletes a tag group along with its membership.
+func (db *Database) DeleteTagGroup(groupId uint) error {
+	sql := `DELETE FROM tag_group_member
+            WHERE group_id = ?`
+
+	if _, err := db.connection.Exec(sql, groupId); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM tag_group
+           WHERE id = ?`
+
+	if _, err := db.connection.Exec(sql, groupId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds a tag to a tag group.
+func (db *Database) AddTagGroupMember(groupId, tagId uint) error {
+	sql := `INSERT OR IGNORE INTO tag_group_member (group_id, tag_id)
+	        VALUES (?1, ?2)`
+
+	_, err := db.connection.Exec(sql, groupId, tagId)
+	return err
+}
+
+// Removes a tag from a tag group.
+func (db *Database) DeleteTagGroupMember(groupId, tagId uint) error {
+	sql := `DELETE FROM tag_group_member
+            WHERE group_id = ?1 AND tag_id = ?2`
+
+	_, err := db.connection.Exec(sql, groupId, tagId)
+	return err
+}
+
+// Updates the tag group membership of the specified tag to the other tag.
+func (db *Database) UpdateTagGroupMembersForTagId(tagId, newTagId uint) error {
+	sql := `UPDATE OR IGNORE tag_group_member
+            SET tag_id = ?2
+            WHERE tag_id = ?1`
+
+	if _, err := db.connection.Exec(sql, tagId, newTagId); err != nil {
+		return err
+	}
+
+	// remove the rows left where the group already had both tags
+	sql = `DELETE FROM tag_group_member
+           WHERE tag_id = ?1`
+
+	_, err := db.connection.Exec(sql, tagId)
+	return err
+}
+
+// Removes the specified tag from all tag groups.
+func (db *Database) DeleteTagGroupMembersByTagId(tagId uint) error {
+	sql := `DELETE FROM tag_group_member
+            WHERE tag_id = ?`
+
+	_, err := db.connection.Exec(sql, tagId)
+	return err
+}
+
+// unexported
+
+func readTagGroups(rows *sql.Rows, groups TagGroups) (TagGroups, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var groupId uint
+		var groupName string
+		var tagId *uint
+		var tagName *string
+		if err := rows.Scan(&groupId, &groupName, &tagId, &tagName); err != nil {
+			return nil, err
+		}
+
+		count := len(groups)
+		if count == 0 || groups[count-1].Id != groupId {
+			groups = append(groups, &TagGroup{groupId, groupName, Tags{}})
+			count++
+		}
+
+		if tagId != nil {
+			group := groups[count-1]
+			group.Tags = append(group.Tags, &Tag{*tagId, *tagName})
+		}
+	}
+
+	return groups, nil
+}
@@ -29,6 +29,17 @@ type Implication struct {
 
 type Implications []*Implication
 
+// An implication whose implying tags must all be present for the implied tag
+// to apply or, if negated, for the implied tag to be in conflict.
+type CompoundImplication struct {
+	Id           uint
+	ImplyingTags Tags
+	ImpliedTag   Tag
+	Negated      bool
+}
+
+type CompoundImplications []*CompoundImplication
+
 // Retrieves the complete set of tag implications.
 func (db *Database) Implications() (Implications, error) {
 	sql := `SELECT t1.id, t1.name, t2.id, t2.name
@@ -151,6 +162,162 @@ func (db Database) DeleteImplicationsForTagId(tagId uint) error {
 	return nil
 }
 
+// Retrieves the complete set of compound tag implications.
+func (db *Database) CompoundImplications() (CompoundImplications, error) {
+	sql := `SELECT ci.id, ci.negated, t2.id, t2.name, t1.id, t1.name
+            FROM compound_implication ci, compound_implication_tag cit, tag t1, tag t2
+            WHERE cit.implication_id = ci.id
+            AND cit.tag_id = t1.id
+            AND ci.implied_tag_id = t2.id
+            ORDER BY ci.id, t1.name`
+
+	rows, err := db.connection.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	implications := make(CompoundImplications, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var id, impliedTagId, tagId uint
+		var negated bool
+		var impliedTagName, tagName string
+		if err := rows.Scan(&id, &negated, &impliedTagId, &impliedTagName, &tagId, &tagName); err != nil {
+			return nil, err
+		}
+
+		count := len(implications)
+		if count == 0 || implications[count-1].Id != id {
+			implications = append(implications, &CompoundImplication{id, Tags{}, Tag{impliedTagId, impliedTagName}, negated})
+			count++
+		}
+
+		implication := implications[count-1]
+		implication.ImplyingTags = append(implication.ImplyingTags, &Tag{tagId, tagName})
+	}
+
+	return implications, nil
+}
+
+// Adds a compound implication.
+func (db Database) AddCompoundImplication(tagIds []uint, impliedTagId uint, negated bool) (uint, error) {
+	sql := `INSERT INTO compound_implication (implied_tag_id, negated)
+	        VALUES (?1, ?2)`
+
+	result, err := db.connection.Exec(sql, impliedTagId, negated)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	sql = `INSERT OR IGNORE INTO compound_implication_tag (implication_id, tag_id)
+	       VALUES (?1, ?2)`
+
+	for _, tagId := range tagIds {
+		if _, err := db.connection.Exec(sql, id, tagId); err != nil {
+			return 0, err
+		}
+	}
+
+	return uint(id), nil
+}
+
+// Deletes the specified compound implication.
+func (db Database) DeleteCompoundImplication(id uint) error {
+	sql := `DELETE FROM compound_implication_tag
+            WHERE implication_id = ?1`
+
+	if _, err := db.connection.Exec(sql, id); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM compound_implication
+           WHERE id = ?1`
+
+	if _, err := db.connection.Exec(sql, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Updates the compound implications featuring the specified tag to feature the
+// other tag instead.
+func (db Database) UpdateCompoundImplicationsForTagId(tagId, newTagId uint) error {
+	sql := `UPDATE compound_implication
+            SET implied_tag_id = ?2
+            WHERE implied_tag_id = ?1`
+
+	if _, err := db.connection.Exec(sql, tagId, newTagId); err != nil {
+		return err
+	}
+
+	sql = `UPDATE OR IGNORE compound_implication_tag
+           SET tag_id = ?2
+           WHERE tag_id = ?1`
+
+	if _, err := db.connection.Exec(sql, tagId, newTagId); err != nil {
+		return err
+	}
+
+	// remove the rows left where the implication already featured both tags
+	sql = `DELETE FROM compound_implication_tag
+           WHERE tag_id = ?1`
+
+	if _, err := db.connection.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	// prevent an implication implying, or conflicting with, one of its own
+	// implying tags
+	sql = `DELETE FROM compound_implication
+           WHERE id IN (SELECT cit.implication_id
+                        FROM compound_implication_tag cit, compound_implication ci
+                        WHERE cit.implication_id = ci.id
+                        AND cit.tag_id = ci.implied_tag_id)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM compound_implication_tag
+           WHERE implication_id NOT IN (SELECT id FROM compound_implication)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deletes the compound implications featuring the specified tag.
+func (db Database) DeleteCompoundImplicationsForTagId(tagId uint) error {
+	sql := `DELETE FROM compound_implication
+            WHERE implied_tag_id = ?1
+            OR id IN (SELECT implication_id FROM compound_implication_tag WHERE tag_id = ?1)`
+
+	if _, err := db.connection.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM compound_implication_tag
+           WHERE implication_id NOT IN (SELECT id FROM compound_implication)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // unexported
 
 func readImplication(rows *sql.Rows) (*Implication, error) {
@@ -0,0 +1,370 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// The number of operations retained in the journal.
+const journalLength = 100
+
+// A journaled operation: the changes made by a single command.
+type Operation struct {
+	Id          uint
+	Time        time.Time
+	Description string
+	User        string
+	Undone      bool
+}
+
+type Operations []*Operation
+
+// Starts journaling changes to a new operation. The operation is only recorded
+// once the first change is made, so that sessions that make no changes do not
+// write to the database.
+func (db *Database) BeginOperation(description, user string) error {
+	sql := `UPDATE journal_state
+            SET operation_id = NULL, time = ?1, description = ?2, user = ?3`
+
+	_, err := db.connection.Exec(sql, time.Now(), description, user)
+	return err
+}
+
+// Stops journaling changes to the operation in progress. An operation that
+// made no changes is discarded, otherwise the undone operations, which can no
+// longer be redone, and the oldest operations beyond the journal's length are.
+func (db *Database) EndOperation() error {
+	operationId, err := db.currentOperationId()
+	if err != nil {
+		return err
+	}
+
+	sql := `UPDATE journal_state
+            SET operation_id = NULL, time = NULL, description = NULL, user = NULL`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	if operationId == 0 {
+		return nil
+	}
+
+	sql = `SELECT count(1)
+           FROM journal
+           WHERE operation_id = ?1`
+
+	rows, err := db.connection.Query(sql, operationId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count, err := readCount(rows)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	if count == 0 {
+		sql = `DELETE FROM operation
+               WHERE id = ?1`
+
+		_, err := db.connection.Exec(sql, operationId)
+		return err
+	}
+
+	sql = `DELETE FROM operation
+           WHERE (undone = 1 AND id < ?1)
+           OR id NOT IN (SELECT id FROM operation ORDER BY id DESC LIMIT ?2)`
+
+	if _, err := db.connection.Exec(sql, operationId, journalLength); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM journal
+           WHERE operation_id NOT IN (SELECT id FROM operation)`
+
+	_, err = db.connection.Exec(sql)
+	return err
+}
+
+// Retrieves the journaled operations.
+func (db *Database) Operations() (Operations, error) {
+	sql := `SELECT id, time, description, user, undone
+            FROM operation
+            WHERE id IN (SELECT DISTINCT operation_id FROM journal)
+            ORDER BY id`
+
+	rows, err := db.connection.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(Operations, 0, 10))
+}
+
+// Reverses the changes of the most recent operation that has not been undone,
+// other than the operation in progress. Returns nil if there is no such
+// operation.
+func (db *Database) UndoOperation() (*Operation, error) {
+	sql := `SELECT id, time, description, user, undone
+            FROM operation
+            WHERE undone = 0 AND id != ?1
+            AND id IN (SELECT DISTINCT operation_id FROM journal)
+            ORDER BY id DESC
+            LIMIT 1`
+
+	return db.replayOperation(sql, true)
+}
+
+// Reapplies the changes of the earliest undone operation. Returns nil if there
+// is no such operation.
+func (db *Database) RedoOperation() (*Operation, error) {
+	sql := `SELECT id, time, description, user, undone
+            FROM operation
+            WHERE undone = 1 AND id != ?1
+            ORDER BY id
+            LIMIT 1`
+
+	return db.replayOperation(sql, false)
+}
+
+// unexported
+
+type journaledTable struct {
+	name    string
+	columns []string
+}
+
+// The tables whose changes are journaled. (The directory cache is not.)
+var journaledTables = []journaledTable{
+	{"tag", []string{"id", "name"}},
+	{"file", []string{"id", "directory", "name", "fingerprint", "mod_time", "size", "is_dir", "device", "inode"}},
+	{"file_tag", []string{"file_id", "tag_id", "explicit"}},
+	{"implication", []string{"tag_id", "implied_tag_id"}},
+	{"compound_implication", []string{"id", "implied_tag_id", "negated"}},
+	{"compound_implication_tag", []string{"implication_id", "tag_id"}},
+	{"tag_group", []string{"id", "name"}},
+	{"tag_group_member", []string{"group_id", "tag_id"}},
+}
+
+// Creates the state of the connection's journaling: the operation in progress,
+// if any, and the triggers that journal changes to it. These are temporary so
+// that each connection, and thus each process, journals to its own operation
+// and so that opening the database does not write to it.
+func (db Database) createJournalState() error {
+	sql := `CREATE TEMP TABLE IF NOT EXISTS journal_state (
+                operation_id INTEGER,
+                time DATETIME,
+                description TEXT,
+                user TEXT
+            )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO journal_state (operation_id)
+           SELECT NULL
+           WHERE NOT EXISTS (SELECT 1 FROM journal_state)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	for _, table := range journaledTables {
+		if err := db.createJournalTriggers(table.name, table.columns); err != nil {
+			return err
+		}
+	}
+
+	return db.createLogTriggers()
+}
+
+// Creates triggers that record, for each change to the table, the statement
+// that reverses it. The operation in progress is recorded upon its first change.
+func (db Database) createJournalTriggers(table string, columns []string) error {
+	values := make([]string, len(columns))
+	assignments := make([]string, len(columns))
+	for index, column := range columns {
+		values[index] = "quote(old." + column + ")"
+		assignments[index] = "'" + column + " = ' || quote(old." + column + ")"
+	}
+
+	statements := map[string]string{
+		"insert": `'DELETE FROM ` + table + ` WHERE rowid = ' || new.rowid`,
+		"delete": `'INSERT INTO ` + table + ` (rowid, ` + strings.Join(columns, ", ") + `) VALUES (' || old.rowid || ', ' || ` +
+			strings.Join(values, " || ', ' || ") + ` || ')'`,
+		"update": `'UPDATE ` + table + ` SET rowid = ' || old.rowid || ', ' || ` +
+			strings.Join(assignments, " || ', ' || ") + ` || ' WHERE rowid = ' || new.rowid`,
+	}
+
+	for event, statement := range statements {
+		sql := `CREATE TEMP TRIGGER IF NOT EXISTS journal_` + table + `_` + event + `
+                AFTER ` + strings.ToUpper(event) + ` ON main.` + table + `
+                WHEN (SELECT description FROM journal_state) IS NOT NULL
+                BEGIN
+                    INSERT INTO operation (time, description, user)
+                    SELECT time, description, user
+                    FROM journal_state
+                    WHERE operation_id IS NULL;
+
+                    UPDATE journal_state
+                    SET operation_id = (SELECT max(id) FROM operation)
+                    WHERE operation_id IS NULL;
+
+                    INSERT INTO journal (operation_id, statement)
+                    VALUES ((SELECT operation_id FROM journal_state), ` + statement + `);
+                END`
+
+		if _, err := db.connection.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The identifier of the operation in progress, or zero if it has yet to make
+// any changes.
+func (db *Database) currentOperationId() (uint, error) {
+	var operationId sql.NullInt64
+	if err := db.connection.QueryRow(`SELECT operation_id FROM journal_state`).Scan(&operationId); err != nil {
+		return 0, err
+	}
+
+	return uint(operationId.Int64), nil
+}
+
+// Replays, in reverse order, the journaled statements of the operation
+// selected by the query. The statements the triggers record to reverse the
+// replay are moved to the replayed operation such that it can subsequently be
+// redone or undone again. (The audit log attributes the replay to the current
+// operation.)
+func (db *Database) replayOperation(query string, undone bool) (*Operation, error) {
+	currentOperationId, err := db.currentOperationId()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.connection.Query(query, currentOperationId)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := readOperations(rows, make(Operations, 0, 1))
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+	operation := operations[0]
+
+	err = db.withTransaction(func(tx connection) error {
+		if err := replayStatements(tx, operation.Id); err != nil {
+			return err
+		}
+
+		sql := `UPDATE operation
+                SET undone = ?2
+                WHERE id = ?1`
+
+		_, err := tx.Exec(sql, operation.Id, undone)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	operation.Undone = undone
+	return operation, nil
+}
+
+func replayStatements(tx connection, operationId uint) error {
+	rows, err := tx.Query(`SELECT statement
+                           FROM journal
+                           WHERE operation_id = ?1
+                           ORDER BY id DESC`, operationId)
+	if err != nil {
+		return err
+	}
+
+	statements := make([]string, 0, 10)
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			rows.Close()
+			return err
+		}
+
+		statements = append(statements, statement)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM journal WHERE operation_id = ?1`, operationId); err != nil {
+		return err
+	}
+
+	var lastJournalId uint
+	if err := tx.QueryRow(`SELECT coalesce(max(id), 0) FROM journal`).Scan(&lastJournalId); err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	// the replay's statements are journaled to the current operation, which is
+	// recorded by the first of them
+	_, err = tx.Exec(`UPDATE journal
+                      SET operation_id = ?1
+                      WHERE operation_id = (SELECT operation_id FROM journal_state) AND id > ?2`, operationId, lastJournalId)
+	return err
+}
+
+func readOperations(rows *sql.Rows, operations Operations) (Operations, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var id uint
+		var operationTime time.Time
+		var description, user string
+		var undone bool
+		if err := rows.Scan(&id, &operationTime, &description, &user, &undone); err != nil {
+			return nil, err
+		}
+
+		operations = append(operations, &Operation{id, operationTime, description, user, undone})
+	}
+
+	return operations, nil
+}
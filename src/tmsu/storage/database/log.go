@@ -0,0 +1,142 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"time"
+)
+
+// The format in which the log records times, in UTC.
+const logTimeFormat = "2006-01-02 15:04:05.000"
+
+// A change to a file's tags recorded in the audit log.
+type LogEntry struct {
+	Id        uint
+	Time      time.Time
+	User      string
+	Command   string
+	Action    string
+	FileId    uint
+	Directory string
+	Name      string
+	Tag       string
+}
+
+type LogEntries []*LogEntry
+
+// The path of the file that was changed.
+func (entry LogEntry) Path() string {
+	return filepath.Join(entry.Directory, entry.Name)
+}
+
+// Retrieves the log entries recorded within the time range, oldest first. A
+// zero time leaves that end of the range open.
+func (db *Database) LogEntries(since, until time.Time) (LogEntries, error) {
+	return db.logEntries("", since, until)
+}
+
+// Retrieves the log entries for the file at the specified path.
+func (db *Database) LogEntriesByPath(path string, since, until time.Time) (LogEntries, error) {
+	return db.logEntries("AND directory = ?3 AND name = ?4", since, until, filepath.Dir(path), filepath.Base(path))
+}
+
+// Retrieves the log entries for the file with the specified identifier,
+// irrespective of the paths it had when its tags were changed.
+func (db *Database) LogEntriesByFileId(fileId uint, since, until time.Time) (LogEntries, error) {
+	return db.logEntries("AND file_id = ?3", since, until, fileId)
+}
+
+// Retrieves the log entries for the tag with the specified name.
+func (db *Database) LogEntriesByTag(tagName string, since, until time.Time) (LogEntries, error) {
+	return db.logEntries("AND tag = ?3", since, until, tagName)
+}
+
+// unexported
+
+// Creates the triggers that log each tagging and untagging along with the user
+// and command of the operation in progress. Like the journal triggers these are
+// temporary.
+func (db Database) createLogTriggers() error {
+	events := map[string]string{"insert": "tag", "delete": "untag"}
+	rows := map[string]string{"insert": "new", "delete": "old"}
+
+	for event, action := range events {
+		sql := `CREATE TEMP TRIGGER IF NOT EXISTS log_file_tag_` + event + `
+                AFTER ` + event + ` ON main.file_tag
+                WHEN (SELECT description FROM journal_state) IS NOT NULL
+                BEGIN
+                    INSERT INTO log (time, user, command, action, file_id, directory, name, tag)
+                    SELECT strftime('%Y-%m-%d %H:%M:%f', 'now'), journal_state.user, journal_state.description, '` + action + `', file.id, file.directory, file.name, tag.name
+                    FROM journal_state, file, tag
+                    WHERE file.id = ` + rows[event] + `.file_id
+                    AND tag.id = ` + rows[event] + `.tag_id;
+                END`
+
+		if _, err := db.connection.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) logEntries(condition string, since, until time.Time, params ...interface{}) (LogEntries, error) {
+	sql := `SELECT id, time, user, command, action, coalesce(file_id, 0), directory, name, tag
+            FROM log
+            WHERE time >= ?1 AND time < ?2 ` + condition + `
+            ORDER BY id`
+
+	lower := ""
+	if !since.IsZero() {
+		lower = since.UTC().Format(logTimeFormat)
+	}
+
+	upper := "9999-12-31 23:59:59.999"
+	if !until.IsZero() {
+		upper = until.UTC().Format(logTimeFormat)
+	}
+
+	rows, err := db.connection.Query(sql, append([]interface{}{lower, upper}, params...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readLogEntries(rows, make(LogEntries, 0, 10))
+}
+
+func readLogEntries(rows *sql.Rows, entries LogEntries) (LogEntries, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var id, fileId uint
+		var entryTime time.Time
+		var user, command, action, directory, name, tag string
+		if err := rows.Scan(&id, &entryTime, &user, &command, &action, &fileId, &directory, &name, &tag); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &LogEntry{id, entryTime, user, command, action, fileId, directory, name, tag})
+	}
+
+	return entries, nil
+}
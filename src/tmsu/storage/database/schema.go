@@ -18,6 +18,7 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package database
 
 import (
+	"errors"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -48,6 +49,8 @@ func (db Database) CreateSchema() error {
                mod_time DATETIME NOT NULL,
                size INTEGER NOT NULL,
                is_dir BOOLEAN NOT NULL,
+               device INTEGER NOT NULL DEFAULT 0,
+               inode INTEGER NOT NULL DEFAULT 0,
                CONSTRAINT con_file_path UNIQUE (directory, name)
            )`
 
@@ -62,9 +65,17 @@ func (db Database) CreateSchema() error {
 		return err
 	}
 
+	sql = `CREATE INDEX IF NOT EXISTS idx_file_inode
+           ON file(device, inode)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
 	sql = `CREATE TABLE IF NOT EXISTS file_tag (
                file_id INTEGER NOT NULL,
                tag_id INTEGER NOT NULL,
+               explicit INTEGER NOT NULL DEFAULT 1,
                PRIMARY KEY (file_id, tag_id),
                FOREIGN KEY (file_id) REFERENCES file(id),
                FOREIGN KEY (tag_id) REFERENCES tag(id)
@@ -98,5 +109,176 @@ func (db Database) CreateSchema() error {
 		return err
 	}
 
+	sql = `CREATE TABLE IF NOT EXISTS compound_implication (
+               id INTEGER PRIMARY KEY,
+               implied_tag_id INTEGER NOT NULL,
+               negated INTEGER NOT NULL DEFAULT 0
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS compound_implication_tag (
+               implication_id INTEGER NOT NULL,
+               tag_id INTEGER NOT NULL,
+               PRIMARY KEY (implication_id, tag_id),
+               FOREIGN KEY (implication_id) REFERENCES compound_implication(id),
+               FOREIGN KEY (tag_id) REFERENCES tag(id)
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS tag_group (
+               id INTEGER PRIMARY KEY,
+               name TEXT NOT NULL,
+               CONSTRAINT con_tag_group_name UNIQUE (name)
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS tag_group_member (
+               group_id INTEGER NOT NULL,
+               tag_id INTEGER NOT NULL,
+               PRIMARY KEY (group_id, tag_id),
+               FOREIGN KEY (group_id) REFERENCES tag_group(id),
+               FOREIGN KEY (tag_id) REFERENCES tag(id)
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS directory_cache (
+               path TEXT PRIMARY KEY,
+               device INTEGER NOT NULL,
+               inode INTEGER NOT NULL,
+               mod_time DATETIME NOT NULL,
+               entries TEXT NOT NULL
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS operation (
+               id INTEGER PRIMARY KEY,
+               time DATETIME NOT NULL,
+               description TEXT NOT NULL,
+               user TEXT NOT NULL DEFAULT '',
+               undone INTEGER NOT NULL DEFAULT 0
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS journal (
+               id INTEGER PRIMARY KEY,
+               operation_id INTEGER NOT NULL,
+               statement TEXT NOT NULL,
+               FOREIGN KEY (operation_id) REFERENCES operation(id)
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_journal_operation_id
+           ON journal(operation_id)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	// the audit log of taggings: unlike the journal this is never trimmed
+	sql = `CREATE TABLE IF NOT EXISTS log (
+               id INTEGER PRIMARY KEY,
+               time DATETIME NOT NULL,
+               user TEXT NOT NULL,
+               command TEXT NOT NULL,
+               action TEXT NOT NULL,
+               file_id INTEGER,
+               directory TEXT NOT NULL,
+               name TEXT NOT NULL,
+               tag TEXT NOT NULL
+           )`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_log_path
+           ON log(directory, name)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_log_tag
+           ON log(tag)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_log_file_id
+           ON log(file_id)`
+
+	if _, err := db.connection.Exec(sql); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// unexported
+
+// Identifies a database created by an earlier version that has yet to be
+// upgraded: the schema cannot be created over it as columns are missing.
+func (db Database) checkUpgraded() error {
+	requiredColumns := []struct{ table, column string }{
+		{"file", "device"},
+		{"file", "inode"},
+		{"file_tag", "explicit"}}
+
+	for _, required := range requiredColumns {
+		columns, err := db.columnNames(required.table)
+		if err != nil {
+			return err
+		}
+
+		if len(columns) > 0 && !columns[required.column] {
+			return errors.New("database has not been upgraded: back it up then upgrade it using misc/db-upgrade/0.2.0_to_0.3.0.sql.")
+		}
+	}
+
+	return nil
+}
+
+// The names of the table's columns, empty if the table does not exist.
+func (db Database) columnNames(table string) (map[string]bool, error) {
+	rows, err := db.connection.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var index, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue interface{}
+		if err := rows.Scan(&index, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return nil, err
+		}
+
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
@@ -52,6 +52,16 @@ func (tags Tags) Any(predicate func(*Tag) bool) bool {
 	return false
 }
 
+func (tags Tags) All(predicate func(*Tag) bool) bool {
+	for _, tag := range tags {
+		if !predicate(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // The number of tags in the database.
 func (db *Database) TagCount() (uint, error) {
 	sql := `SELECT count(1)
@@ -141,6 +151,24 @@ func (db Database) TagsByNames(names []string) (Tags, error) {
 	return tags, nil
 }
 
+// Retrieves the descendants of the specified tag, i.e. the tags named
+// 'NAME/...'.
+func (db Database) TagDescendants(name string) (Tags, error) {
+	sql := `SELECT id, name
+            FROM tag
+            WHERE name > ?1 AND name < ?2
+            ORDER BY name`
+
+	// '0' immediately follows '/'
+	rows, err := db.connection.Query(sql, name+"/", name+"0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(Tags, 0, 10))
+}
+
 // Retrieves the set of tags for the specified file.
 func (db *Database) TagsByFileId(fileId uint) (Tags, error) {
 	sql := `SELECT id, name
@@ -160,6 +188,49 @@ func (db *Database) TagsByFileId(fileId uint) (Tags, error) {
 	return readTags(rows, make(Tags, 0, 10))
 }
 
+// Retrieves the set of tags explicitly applied to the specified file, i.e.
+// excluding those applied by 'imply --apply'.
+func (db *Database) ExplicitTagsByFileId(fileId uint) (Tags, error) {
+	sql := `SELECT id, name
+            FROM tag
+            WHERE id IN (
+                SELECT tag_id
+                FROM file_tag
+                WHERE file_id = ?1 AND explicit = 1)
+            ORDER BY name`
+
+	rows, err := db.connection.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(Tags, 0, 10))
+}
+
+// Retrieves the set of tags that are neither applied to any file nor feature
+// in any implication or tag group and that have no descendants.
+func (db Database) UnusedTags() (Tags, error) {
+	sql := `SELECT id, name
+            FROM tag
+            WHERE id NOT IN (SELECT DISTINCT tag_id FROM file_tag)
+            AND id NOT IN (SELECT tag_id FROM implication)
+            AND id NOT IN (SELECT implied_tag_id FROM implication)
+            AND id NOT IN (SELECT tag_id FROM compound_implication_tag)
+            AND id NOT IN (SELECT implied_tag_id FROM compound_implication)
+            AND id NOT IN (SELECT tag_id FROM tag_group_member)
+            AND NOT EXISTS (SELECT 1 FROM tag child WHERE child.name > tag.name || '/' AND child.name < tag.name || '0')
+            ORDER BY name`
+
+	rows, err := db.connection.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(Tags, 0, 10))
+}
+
 // Adds a tag.
 func (db Database) InsertTag(name string) (*Tag, error) {
 	sql := `INSERT INTO tag (name)
@@ -229,6 +300,31 @@ func (db Database) DeleteTag(tagId uint) error {
 	return nil
 }
 
+// Deletes the tags that are neither applied to any file nor feature in any
+// implication or tag group and that have no descendants.
+func (db Database) DeleteUnusedTags() (uint, error) {
+	sql := `DELETE FROM tag
+            WHERE id NOT IN (SELECT DISTINCT tag_id FROM file_tag)
+            AND id NOT IN (SELECT tag_id FROM implication)
+            AND id NOT IN (SELECT implied_tag_id FROM implication)
+            AND id NOT IN (SELECT tag_id FROM compound_implication_tag)
+            AND id NOT IN (SELECT implied_tag_id FROM compound_implication)
+            AND id NOT IN (SELECT tag_id FROM tag_group_member)
+            AND NOT EXISTS (SELECT 1 FROM tag child WHERE child.name > tag.name || '/' AND child.name < tag.name || '0')`
+
+	result, err := db.connection.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(rowsAffected), nil
+}
+
 // unexported
 
 func containsName(tags Tags, name string) bool {
@@ -0,0 +1,45 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"tmsu/storage/database"
+)
+
+// Retrieves the cached listings for the specified directory and those beneath it.
+func (storage *Storage) CachedDirectoriesByPath(path string) (database.CachedDirectories, error) {
+	return storage.Db.CachedDirectoriesByPath(path)
+}
+
+// Adds or replaces the cached listings for the specified directories.
+func (storage *Storage) UpdateCachedDirectories(directories database.CachedDirectories) error {
+	if len(directories) == 0 {
+		return nil
+	}
+
+	return storage.Db.UpdateCachedDirectories(directories)
+}
+
+// Removes the cached listings for the specified directories.
+func (storage *Storage) DeleteCachedDirectories(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	return storage.Db.DeleteCachedDirectories(paths)
+}
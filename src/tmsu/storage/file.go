@@ -75,6 +75,32 @@ func (storage *Storage) FilesByFingerprint(fingerprint fingerprint.Fingerprint)
 	return storage.Db.FilesByFingerprint(fingerprint)
 }
 
+// Retrieves the set of files with the specified device and inode numbers.
+func (storage *Storage) FilesByInode(device, inode uint64) (database.Files, error) {
+	return storage.Db.FilesByInode(device, inode)
+}
+
+// Retrieves a tracked file, other than that at the specified path, with the
+// specified device and inode numbers, or nil if there is none.
+func (storage *Storage) LinkedFile(path string, device, inode uint64) (*database.File, error) {
+	if inode == 0 {
+		return nil, nil
+	}
+
+	files, err := storage.Db.FilesByInode(device, inode)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files with inode #%v: %v", inode, err)
+	}
+
+	for _, file := range files {
+		if file.Path() != path {
+			return file, nil
+		}
+	}
+
+	return nil, nil
+}
+
 // The number of files with the specified tag.
 func (storage *Storage) FileCountWithTag(tagId uint) (uint, error) {
 	return storage.Db.FileCountWithTag(tagId)
@@ -95,13 +121,19 @@ func (storage *Storage) FileCountWithTags(tagIds []uint) (uint, error) {
 	return storage.Db.FileCountWithTags(tagIds)
 }
 
-// Retrieves the set of files with the specified set of tags.
+// Retrieves the set of files with the specified tags and without the excluded
+// tags. A file has a tag if it is tagged with the tag, one of its descendants
+// or tags that imply one of these.
 func (storage *Storage) FilesWithTags(includeTagIds, excludeTagIds []uint) (database.Files, error) {
 	var files database.Files
-	var err error
+
+	implying, err := storage.implyingTags()
+	if err != nil {
+		return nil, err
+	}
 
 	if len(includeTagIds) > 0 {
-		files, err = storage.Db.FilesWithTags(includeTagIds)
+		files, err = storage.filesWithAllTags(includeTagIds, implying, []uint{})
 		if err != nil {
 			return nil, fmt.Errorf("could not retrieve files with tags %v: %v", includeTagIds, err)
 		}
@@ -115,26 +147,17 @@ func (storage *Storage) FilesWithTags(includeTagIds, excludeTagIds []uint) (data
 			}
 		}
 
-		excludeFiles, err := storage.Db.FilesWithTags(excludeTagIds)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve files with tags %v: %v", excludeTagIds, err)
-		}
-
-		for index, file := range files {
-			if contains(excludeFiles, file) {
-				files[index] = nil
+		for _, tagId := range excludeTagIds {
+			excludeFiles, err := storage.filesWithTag(tagId, implying, []uint{})
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve files with tag #%v: %v", tagId, err)
 			}
-		}
-	}
 
-	resultFiles := make(database.Files, 0, len(files))
-	for _, file := range files {
-		if file != nil {
-			resultFiles = append(resultFiles, file)
+			files = files.Where(func(file *database.File) bool { return !contains(excludeFiles, file) })
 		}
 	}
 
-	return resultFiles, nil
+	return files, nil
 }
 
 // Retrieves the sets of duplicate files within the database.
@@ -142,17 +165,206 @@ func (storage *Storage) DuplicateFiles() ([]database.Files, error) {
 	return storage.Db.DuplicateFiles()
 }
 
+// Retrieves the set of files that have no tags applied.
+func (storage *Storage) UntaggedFiles() (database.Files, error) {
+	return storage.Db.UntaggedFiles()
+}
+
 // Adds a file to the database.
-func (storage *Storage) AddFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*database.File, error) {
-	return storage.Db.InsertFile(path, fingerprint, modTime, size, isDir)
+func (storage *Storage) AddFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, device, inode uint64) (*database.File, error) {
+	return storage.Db.InsertFile(path, fingerprint, modTime, size, isDir, device, inode)
 }
 
 // Updates a file in the database.
-func (storage *Storage) UpdateFile(fileId uint, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*database.File, error) {
-	return storage.Db.UpdateFile(fileId, path, fingerprint, modTime, size, isDir)
+func (storage *Storage) UpdateFile(fileId uint, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, device, inode uint64) (*database.File, error) {
+	return storage.Db.UpdateFile(fileId, path, fingerprint, modTime, size, isDir, device, inode)
 }
 
 // Removes a file from the database.
 func (storage *Storage) RemoveFile(fileId uint) error {
 	return storage.Db.DeleteFile(fileId)
 }
+
+// Removes the files that have no tags applied, returning the number removed.
+func (storage *Storage) RemoveUntaggedFiles() (uint, error) {
+	return storage.Db.DeleteUntaggedFiles()
+}
+
+// unexported
+
+// The implications by which files acquire tags, indexed by implied tag.
+type implyingTags struct {
+	tagIds   map[uint][]uint
+	compound map[uint]database.CompoundImplications
+}
+
+func (storage *Storage) filesWithAllTags(tagIds []uint, implying *implyingTags, visited []uint) (database.Files, error) {
+	// tags without descendants or implying tags can be matched in a single query
+	simpleTagIds := make([]uint, 0, len(tagIds))
+	expandedTagIds := make([]uint, 0)
+
+	for _, tagId := range tagIds {
+		matchingTagIds, err := storage.matchingTagIds(tagId, implying)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matchingTagIds) == 1 && len(implying.compound[tagId]) == 0 {
+			simpleTagIds = append(simpleTagIds, tagId)
+		} else {
+			expandedTagIds = append(expandedTagIds, tagId)
+		}
+	}
+
+	var files database.Files
+	if len(simpleTagIds) > 0 {
+		var err error
+		files, err = storage.Db.FilesWithTags(simpleTagIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for index, tagId := range expandedTagIds {
+		tagFiles, err := storage.filesWithTag(tagId, implying, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		if index == 0 && len(simpleTagIds) == 0 {
+			files = tagFiles
+		} else {
+			files = files.Where(func(file *database.File) bool { return contains(tagFiles, file) })
+		}
+	}
+
+	return files, nil
+}
+
+// Retrieves the files that have the specified tag, either directly or through
+// descendants or implications. Compound implications already visited are not
+// followed again.
+func (storage *Storage) filesWithTag(tagId uint, implying *implyingTags, visited []uint) (database.Files, error) {
+	matchingTagIds, err := storage.matchingTagIds(tagId, implying)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := storage.Db.FilesWithAnyTag(matchingTagIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, matchingTagId := range matchingTagIds {
+		for _, implication := range implying.compound[matchingTagId] {
+			if containsTagId(visited, implication.Id) {
+				continue
+			}
+
+			implyingTagIds := make([]uint, len(implication.ImplyingTags))
+			for index, implyingTag := range implication.ImplyingTags {
+				implyingTagIds[index] = implyingTag.Id
+			}
+
+			implicationVisited := append(append(make([]uint, 0, len(visited)+1), visited...), implication.Id)
+			implicationFiles, err := storage.filesWithAllTags(implyingTagIds, implying, implicationVisited)
+			if err != nil {
+				return nil, err
+			}
+
+			files = unionFiles(files, implicationFiles)
+		}
+	}
+
+	return files, nil
+}
+
+// The identifiers of the tags that, applied to a file, give the file the
+// specified tag: the tag, its descendants and the tags that imply any of these,
+// along with their descendants and so on.
+func (storage *Storage) matchingTagIds(tagId uint, implying *implyingTags) ([]uint, error) {
+	tagIds := []uint{tagId}
+
+	for index := 0; index < len(tagIds); index++ {
+		tag, err := storage.Db.Tag(tagIds[index])
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag #%v: %v", tagIds[index], err)
+		}
+		if tag == nil {
+			continue
+		}
+
+		descendants, err := storage.Db.TagDescendants(tag.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve descendants of tag '%v': %v", tag.Name, err)
+		}
+
+		for _, descendant := range descendants {
+			if !containsTagId(tagIds, descendant.Id) {
+				tagIds = append(tagIds, descendant.Id)
+			}
+		}
+
+		for _, implyingTagId := range implying.tagIds[tag.Id] {
+			if !containsTagId(tagIds, implyingTagId) {
+				tagIds = append(tagIds, implyingTagId)
+			}
+		}
+	}
+
+	return tagIds, nil
+}
+
+// Indexes the implications, other than negated ones, by implied tag.
+func (storage *Storage) implyingTags() (*implyingTags, error) {
+	implications, err := storage.Db.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	implying := &implyingTags{make(map[uint][]uint), make(map[uint]database.CompoundImplications)}
+	for _, implication := range implications {
+		impliedTagId := implication.ImpliedTag.Id
+		implying.tagIds[impliedTagId] = append(implying.tagIds[impliedTagId], implication.ImplyingTag.Id)
+	}
+
+	compoundImplications, err := storage.Db.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	for _, implication := range compoundImplications {
+		if implication.Negated {
+			continue
+		}
+
+		impliedTagId := implication.ImpliedTag.Id
+		implying.compound[impliedTagId] = append(implying.compound[impliedTagId], implication)
+	}
+
+	return implying, nil
+}
+
+// Merges two sets of files, each ordered by path.
+func unionFiles(files, otherFiles database.Files) database.Files {
+	result := make(database.Files, 0, len(files)+len(otherFiles))
+
+	for len(files) > 0 && len(otherFiles) > 0 {
+		path, otherPath := files[0].Directory+"/"+files[0].Name, otherFiles[0].Directory+"/"+otherFiles[0].Name
+
+		switch {
+		case path < otherPath:
+			result = append(result, files[0])
+			files = files[1:]
+		case path > otherPath:
+			result = append(result, otherFiles[0])
+			otherFiles = otherFiles[1:]
+		default:
+			result = append(result, files[0])
+			files, otherFiles = files[1:], otherFiles[1:]
+		}
+	}
+
+	result = append(result, files...)
+	return append(result, otherFiles...)
+}
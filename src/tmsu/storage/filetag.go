@@ -53,18 +53,32 @@ func (storage *Storage) FileTagsByFileId(fileId uint) (database.FileTags, error)
 
 // Adds an file tag.
 func (storage *Storage) AddFileTag(fileId, tagId uint) (*database.FileTag, error) {
+	if err := storage.checkExclusiveTags(fileId, []uint{tagId}); err != nil {
+		return nil, err
+	}
+
 	return storage.Db.AddFileTag(fileId, tagId)
 }
 
-// Adds a set of file tags.
+// Adds a set of file tags. The tags are rejected if the file would then have
+// more than one tag from a tag group.
 func (storage *Storage) AddFileTags(fileId uint, tagIds []uint) error {
 	if len(tagIds) == 0 {
 		return nil
 	}
 
+	if err := storage.checkExclusiveTags(fileId, tagIds); err != nil {
+		return err
+	}
+
 	return storage.Db.AddFileTags(fileId, tagIds)
 }
 
+// Adds an implied file tag, unless the file already has the tag.
+func (storage *Storage) AddImpliedFileTag(fileId, tagId uint) (*database.FileTag, error) {
+	return storage.Db.AddImpliedFileTag(fileId, tagId)
+}
+
 // Remove file tag.
 func (storage *Storage) RemoveFileTag(fileId, tagId uint) error {
 	return storage.Db.DeleteFileTag(fileId, tagId)
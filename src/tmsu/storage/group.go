@@ -0,0 +1,202 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"tmsu/storage/database"
+)
+
+// Retrieves the complete set of tag groups.
+func (storage *Storage) TagGroups() (database.TagGroups, error) {
+	return storage.Db.TagGroups()
+}
+
+// Retrieves the tag group with the specified name.
+func (storage *Storage) TagGroupByName(name string) (*database.TagGroup, error) {
+	return storage.Db.TagGroupByName(name)
+}
+
+// Adds the tags to the named tag group, creating the group if it does not
+// exist.
+func (storage *Storage) AddTagGroupMembers(name string, tagIds []uint) (*database.TagGroup, error) {
+	if name == "" {
+		return nil, errors.New("tag group name cannot be empty")
+	}
+
+	group, err := storage.Db.TagGroupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag group '%v': %v", name, err)
+	}
+	if group == nil {
+		group, err = storage.Db.InsertTagGroup(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not add tag group '%v': %v", name, err)
+		}
+	}
+
+	for _, tagId := range tagIds {
+		if err := storage.Db.AddTagGroupMember(group.Id, tagId); err != nil {
+			return nil, fmt.Errorf("could not add tag #%v to tag group '%v': %v", tagId, name, err)
+		}
+	}
+
+	return storage.Db.TagGroupByName(name)
+}
+
+// Removes the tags from the specified tag group.
+func (storage *Storage) RemoveTagGroupMembers(groupId uint, tagIds []uint) error {
+	for _, tagId := range tagIds {
+		if err := storage.Db.DeleteTagGroupMember(groupId, tagId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes the specified tag group.
+func (storage *Storage) RemoveTagGroup(groupId uint) error {
+	return storage.Db.DeleteTagGroup(groupId)
+}
+
+// Updates the tag groups featuring the specified tag to feature the other tag
+// instead.
+func (storage *Storage) UpdateTagGroupsForTagId(tagId, newTagId uint) error {
+	return storage.Db.UpdateTagGroupMembersForTagId(tagId, newTagId)
+}
+
+// Removes the specified tag from the tag groups.
+func (storage *Storage) RemoveTagGroupsForTagId(tagId uint) error {
+	return storage.Db.DeleteTagGroupMembersByTagId(tagId)
+}
+
+// Removes the tags the file has that share a tag group with any of the
+// specified tags, so that these can then be applied. Returns the tags removed.
+func (storage *Storage) ReplaceExclusiveFileTags(fileId uint, tagIds []uint) (database.Tags, error) {
+	groups, err := storage.Db.TagGroups()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag groups: %v", err)
+	}
+
+	fileTags, err := storage.Db.FileTagsByFileId(fileId)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file tags: %v", err)
+	}
+
+	// check all of the groups before removing any tags
+	replaceGroups := make(database.TagGroups, 0, len(groups))
+	for _, group := range groups {
+		newTag, err := groupTag(group, tagIds)
+		if err != nil {
+			return nil, err
+		}
+		if newTag != nil {
+			replaceGroups = append(replaceGroups, group)
+		}
+	}
+
+	removed := make(database.Tags, 0)
+	for _, group := range replaceGroups {
+
+		for _, tag := range group.Tags {
+			if containsTagId(tagIds, tag.Id) || containsTag(removed, tag) || !hasFileTag(fileTags, tag.Id) {
+				continue
+			}
+
+			if err := storage.Db.DeleteFileTag(fileId, tag.Id); err != nil {
+				return nil, fmt.Errorf("could not remove tag '%v': %v", tag.Name, err)
+			}
+
+			removed = append(removed, tag)
+		}
+	}
+
+	return removed, nil
+}
+
+// unexported
+
+// Checks that applying the tags to the file would not result in it having more
+// than one tag from any tag group. Only the explicitly applied tags are
+// considered, not those implied or had through a descendant tag.
+func (storage *Storage) checkExclusiveTags(fileId uint, tagIds []uint) error {
+	groups, err := storage.Db.TagGroups()
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag groups: %v", err)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	fileTags, err := storage.Db.FileTagsByFileId(fileId)
+	if err != nil {
+		return fmt.Errorf("could not retrieve file tags: %v", err)
+	}
+
+	for _, group := range groups {
+		newTag, err := groupTag(group, tagIds)
+		if err != nil {
+			return err
+		}
+		if newTag == nil {
+			continue
+		}
+
+		var existingTag *database.Tag
+		for _, tag := range group.Tags {
+			if !containsTagId(tagIds, tag.Id) && hasFileTag(fileTags, tag.Id) {
+				existingTag = tag
+			}
+		}
+
+		if existingTag != nil {
+			return fmt.Errorf("tag '%v' is mutually exclusive with existing tag '%v' (tag group '%v')", newTag.Name, existingTag.Name, group.Name)
+		}
+	}
+
+	return nil
+}
+
+// Retrieves the tag group's member amongst the specified tags, if any.
+func groupTag(group *database.TagGroup, tagIds []uint) (*database.Tag, error) {
+	var groupTag *database.Tag
+
+	for _, tag := range group.Tags {
+		if containsTagId(tagIds, tag.Id) {
+			if groupTag != nil {
+				return nil, fmt.Errorf("tags '%v' and '%v' are mutually exclusive (tag group '%v')", groupTag.Name, tag.Name, group.Name)
+			}
+
+			groupTag = tag
+		}
+	}
+
+	return groupTag, nil
+}
+
+func hasFileTag(fileTags database.FileTags, tagId uint) bool {
+	for _, fileTag := range fileTags {
+		if fileTag.TagId == tagId {
+			return true
+		}
+	}
+
+	return false
+}
@@ -18,6 +18,7 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package storage
 
 import (
+	"fmt"
 	"tmsu/storage/database"
 )
 
@@ -51,14 +52,174 @@ func (storage *Storage) ImplicationsForTags(tagIds ...uint) (database.Implicatio
 	return resultantImplications, nil
 }
 
-// Adds the specified implication.
+// Adds the specified implication. Implications that would result in a cycle
+// are rejected.
 func (storage Storage) AddImplication(tagId, impliedTagId uint) error {
+	if tagId == impliedTagId {
+		return fmt.Errorf("a tag cannot imply itself")
+	}
+
+	chain, err := storage.ImplicationChain(impliedTagId, tagId)
+	if err != nil {
+		return err
+	}
+	if chain != nil {
+		return fmt.Errorf("implication would create a cycle")
+	}
+
 	return storage.Db.AddImplication(tagId, impliedTagId)
 }
 
+// Determines the chain of tags by which the first tag implies the second, e.g.
+// 'a', 'b', 'c' where 'a' implies 'b' which in turn implies 'c'. Returns nil if
+// the first tag does not imply the second.
+func (storage Storage) ImplicationChain(tagId, impliedTagId uint) (database.Tags, error) {
+	implications, err := storage.Db.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	return implicationChain(implicationsByTagId(implications), tagId, impliedTagId, nil), nil
+}
+
+// Retrieves the implications that are redundant as the implied tag is also
+// implied indirectly via other implications.
+func (storage Storage) RedundantImplications() (database.Implications, error) {
+	implications, err := storage.Db.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	implicationsByTag := implicationsByTagId(implications)
+
+	redundant := make(database.Implications, 0)
+	for _, implication := range implications {
+		if implicationChain(implicationsByTag, implication.ImplyingTag.Id, implication.ImpliedTag.Id, implication) != nil {
+			redundant = append(redundant, implication)
+		}
+	}
+
+	return redundant, nil
+}
+
+// Finds a cycle in the implications, e.g. 'a', 'b', 'a' where 'a' implies 'b'
+// and 'b' implies 'a'. Returns nil if there are no cycles.
+func (storage Storage) ImplicationCycle() (database.Tags, error) {
+	implications, err := storage.Db.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	implicationsByTag := implicationsByTagId(implications)
+
+	for _, implication := range implications {
+		chain := implicationChain(implicationsByTag, implication.ImpliedTag.Id, implication.ImplyingTag.Id, nil)
+		if chain != nil {
+			implyingTag := implication.ImplyingTag
+			return append(database.Tags{&implyingTag}, chain...), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Applies the implied tag to each of the files with the implying tags so that
+// the files retain it should the implication be removed. Returns the number of
+// files tagged. No files are tagged if any would then have more than one tag
+// from a tag group.
+func (storage *Storage) ApplyImplication(tagIds []uint, impliedTagId uint) (uint, error) {
+	files, err := storage.FilesWithTags(tagIds, []uint{})
+	if err != nil {
+		return 0, err
+	}
+
+	// check all of the files before tagging any
+	untagged := make(database.Files, 0, len(files))
+	for _, file := range files {
+		exists, err := storage.Db.FileTagExists(file.Id, impliedTagId)
+		if err != nil {
+			return 0, fmt.Errorf("%v: could not determine whether file is tagged: %v", file.Path(), err)
+		}
+		if exists {
+			continue
+		}
+
+		if err := storage.checkExclusiveTags(file.Id, []uint{impliedTagId}); err != nil {
+			return 0, fmt.Errorf("%v: %v", file.Path(), err)
+		}
+
+		untagged = append(untagged, file)
+	}
+
+	var count uint
+	for _, file := range untagged {
+		if _, err := storage.Db.AddImpliedFileTag(file.Id, impliedTagId); err != nil {
+			return count, fmt.Errorf("%v: could not apply implied tag: %v", file.Path(), err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Removes the implied tag from the files with the implying tags where it was
+// applied by ApplyImplication and the files do not otherwise have it through
+// the remaining implications. Returns the number of files untagged.
+func (storage *Storage) PruneImpliedFileTags(tagIds []uint, impliedTagId uint) (uint, error) {
+	files, err := storage.FilesWithTags(tagIds, []uint{})
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	for _, file := range files {
+		fileTags, err := storage.Db.FileTagsByFileId(file.Id)
+		if err != nil {
+			return count, fmt.Errorf("%v: could not retrieve file tags: %v", file.Path(), err)
+		}
+
+		implied := false
+		for _, fileTag := range fileTags {
+			if fileTag.TagId == impliedTagId && !fileTag.Explicit {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			continue
+		}
+
+		explicitTags, err := storage.Db.ExplicitTagsByFileId(file.Id)
+		if err != nil {
+			return count, fmt.Errorf("%v: could not retrieve tags: %v", file.Path(), err)
+		}
+
+		impliedTags, err := storage.ImpliedTags(explicitTags)
+		if err != nil {
+			return count, fmt.Errorf("%v: could not retrieve implied tags: %v", file.Path(), err)
+		}
+		if impliedTags.Any(func(tag *database.Tag) bool { return tag.Id == impliedTagId }) {
+			continue
+		}
+
+		if err := storage.Db.DeleteFileTag(file.Id, impliedTagId); err != nil {
+			return count, fmt.Errorf("%v: could not remove implied tag: %v", file.Path(), err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
 // Updates implications featuring the specified tag.
 func (storage Storage) UpdateImplicationsForTagId(tagId, impliedTagId uint) error {
-	return storage.Db.UpdateImplicationsForTagId(tagId, impliedTagId)
+	if err := storage.Db.UpdateImplicationsForTagId(tagId, impliedTagId); err != nil {
+		return err
+	}
+
+	return storage.Db.UpdateCompoundImplicationsForTagId(tagId, impliedTagId)
 }
 
 // Removes the specified implication
@@ -68,11 +229,190 @@ func (storage Storage) RemoveImplication(tagId, impliedTagId uint) error {
 
 // Removes implications featuring the specified tag.
 func (storage Storage) RemoveImplicationsForTagId(tagId uint) error {
-	return storage.Db.DeleteImplicationsForTagId(tagId)
+	if err := storage.Db.DeleteImplicationsForTagId(tagId); err != nil {
+		return err
+	}
+
+	return storage.Db.DeleteCompoundImplicationsForTagId(tagId)
+}
+
+// Retrieves the complete set of compound tag implications.
+func (storage *Storage) CompoundImplications() (database.CompoundImplications, error) {
+	return storage.Db.CompoundImplications()
+}
+
+// Retrieves the compound implication with the specified implying tags and
+// implied tag, or nil if there is no such implication.
+func (storage *Storage) CompoundImplication(tagIds []uint, impliedTagId uint, negated bool) (*database.CompoundImplication, error) {
+	implications, err := storage.Db.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	for _, implication := range implications {
+		if implication.ImpliedTag.Id != impliedTagId || implication.Negated != negated || len(implication.ImplyingTags) != len(tagIds) {
+			continue
+		}
+
+		if implication.ImplyingTags.All(func(tag *database.Tag) bool { return containsTagId(tagIds, tag.Id) }) {
+			return implication, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Adds an implication whereby files with all of the specified tags also have
+// the implied tag or, if negated, should not have the implied tag.
+func (storage *Storage) AddCompoundImplication(tagIds []uint, impliedTagId uint, negated bool) error {
+	if containsTagId(tagIds, impliedTagId) {
+		if negated {
+			return fmt.Errorf("a tag cannot conflict with itself")
+		}
+		return fmt.Errorf("a tag cannot imply itself")
+	}
+
+	implication, err := storage.CompoundImplication(tagIds, impliedTagId, negated)
+	if err != nil {
+		return err
+	}
+	if implication != nil {
+		return nil
+	}
+
+	_, err = storage.Db.AddCompoundImplication(tagIds, impliedTagId, negated)
+	return err
+}
+
+// Removes the specified compound implication.
+func (storage *Storage) RemoveCompoundImplication(id uint) error {
+	return storage.Db.DeleteCompoundImplication(id)
+}
+
+// A file that has a tag its other tags exclude.
+type Conflict struct {
+	File        *database.File
+	Implication *database.CompoundImplication
+}
+
+type Conflicts []*Conflict
+
+// Retrieves the files that have a tag that is excluded by a negated
+// implication.
+func (storage *Storage) Conflicts() (Conflicts, error) {
+	implications, err := storage.Db.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	conflicts := make(Conflicts, 0)
+	for _, implication := range implications {
+		if !implication.Negated {
+			continue
+		}
+
+		tagIds := make([]uint, len(implication.ImplyingTags))
+		for index, tag := range implication.ImplyingTags {
+			tagIds[index] = tag.Id
+		}
+
+		files, err := storage.FilesWithTags(append(tagIds, implication.ImpliedTag.Id), []uint{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			conflicts = append(conflicts, &Conflict{file, implication})
+		}
+	}
+
+	return conflicts, nil
+}
+
+// Retrieves the negated implications that the specified tags, along with the
+// tags they imply, are in conflict with.
+func (storage *Storage) ConflictingImplications(tags database.Tags) (database.CompoundImplications, error) {
+	implications, err := storage.Db.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	impliedTags, err := storage.ImpliedTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	tagIds := make([]uint, 0, len(tags)+len(impliedTags))
+	for _, tag := range append(tags, impliedTags...) {
+		tagIds = append(tagIds, tag.Id)
+	}
+
+	ancestorIds, err := storage.ancestorTagIds(tagIds)
+	if err != nil {
+		return nil, err
+	}
+	tagIds = append(tagIds, ancestorIds...)
+
+	hasTag := func(tag *database.Tag) bool { return containsTagId(tagIds, tag.Id) }
+
+	conflicting := make(database.CompoundImplications, 0)
+	for _, implication := range implications {
+		if implication.Negated && hasTag(&implication.ImpliedTag) && implication.ImplyingTags.All(hasTag) {
+			conflicting = append(conflicting, implication)
+		}
+	}
+
+	return conflicting, nil
 }
 
 // unexported
 
+func implicationsByTagId(implications database.Implications) map[uint]database.Implications {
+	implicationsByTag := make(map[uint]database.Implications)
+	for _, implication := range implications {
+		tagId := implication.ImplyingTag.Id
+		implicationsByTag[tagId] = append(implicationsByTag[tagId], implication)
+	}
+
+	return implicationsByTag
+}
+
+// Performs a breadth-first search for a chain of implications from one tag to
+// another, disregarding the specified implication.
+func implicationChain(implicationsByTag map[uint]database.Implications, tagId, impliedTagId uint, ignore *database.Implication) database.Tags {
+	via := make(map[uint]*database.Implication)
+	queue := []uint{tagId}
+
+	for len(queue) > 0 {
+		currentTagId := queue[0]
+		queue = queue[1:]
+
+		for _, implication := range implicationsByTag[currentTagId] {
+			nextTagId := implication.ImpliedTag.Id
+			if implication == ignore || nextTagId == tagId || via[nextTagId] != nil {
+				continue
+			}
+
+			via[nextTagId] = implication
+
+			if nextTagId == impliedTagId {
+				chain := make(database.Tags, 0, 5)
+				for chainTagId := impliedTagId; chainTagId != tagId; chainTagId = via[chainTagId].ImplyingTag.Id {
+					chainTag := via[chainTagId].ImpliedTag
+					chain = append(database.Tags{&chainTag}, chain...)
+				}
+
+				firstTag := via[chain[0].Id].ImplyingTag
+				return append(database.Tags{&firstTag}, chain...)
+			}
+
+			queue = append(queue, nextTagId)
+		}
+	}
+
+	return nil
+}
+
 func containsImplication(implications database.Implications, implication *database.Implication) bool {
 	for _, imp := range implications {
 		if imp.ImplyingTag.Id == implication.ImplyingTag.Id && imp.ImpliedTag.Id == implication.ImpliedTag.Id {
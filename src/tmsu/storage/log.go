@@ -0,0 +1,44 @@
+/*
+Copyright 2011-2013 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"time"
+	"tmsu/storage/database"
+)
+
+// Retrieves the audit log entries recorded within the time range. A zero time
+// leaves that end of the range open.
+func (storage *Storage) LogEntries(since, until time.Time) (database.LogEntries, error) {
+	return storage.Db.LogEntries(since, until)
+}
+
+// Retrieves the audit log entries for the file at the specified path.
+func (storage *Storage) LogEntriesByPath(path string, since, until time.Time) (database.LogEntries, error) {
+	return storage.Db.LogEntriesByPath(path, since, until)
+}
+
+// Retrieves the audit log entries for the file with the specified identifier.
+func (storage *Storage) LogEntriesByFileId(fileId uint, since, until time.Time) (database.LogEntries, error) {
+	return storage.Db.LogEntriesByFileId(fileId, since, until)
+}
+
+// Retrieves the audit log entries for the tag with the specified name.
+func (storage *Storage) LogEntriesByTag(tagName string, since, until time.Time) (database.LogEntries, error) {
+	return storage.Db.LogEntriesByTag(tagName, since, until)
+}
@@ -19,20 +19,86 @@ package storage
 
 import (
 	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
 	"tmsu/storage/database"
 )
 
 type Storage struct {
 	Db *database.Database
+
+	// whether the database is shared and so is left open on close
+	shared bool
+
+	// whether this storage joined a shared session and so leaves it open
+	joined bool
 }
 
+// The command line the journal operations are described by. The shell sets
+// this to the line of each command it runs.
+var CommandLine = os.Args
+
+// The database shared by successive calls to Open, if any.
+var sharedDb *database.Database
+
+// The session joined by successive calls to Open, if any.
+var sharedSession *Storage
+
 func Open() (*Storage, error) {
+	if sharedSession != nil {
+		return &Storage{sharedSession.Db, true, true}, nil
+	}
+
+	if sharedDb != nil {
+		store, err := begin(sharedDb)
+		if err != nil {
+			return nil, err
+		}
+
+		store.shared = true
+		return store, nil
+	}
+
 	db, err := database.Open()
 	if err != nil {
 		return nil, fmt.Errorf("could not open database: %v", err)
 	}
 
-	return &Storage{db}, nil
+	return begin(db)
+}
+
+// Opens the database such that subsequent calls to Open share it rather than
+// opening it afresh, until Unshare is called. Each storage opened remains a
+// separate journal operation.
+func Share() error {
+	if sharedDb != nil {
+		return nil
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		return fmt.Errorf("could not open database: %v", err)
+	}
+
+	sharedDb = db
+	return nil
+}
+
+// Closes the shared database.
+func Unshare() error {
+	if sharedDb == nil {
+		return nil
+	}
+
+	err := sharedDb.Close()
+	sharedDb = nil
+	if err != nil {
+		return fmt.Errorf("could not close database: %v", err)
+	}
+
+	return nil
 }
 
 func OpenAt(path string) (*Storage, error) {
@@ -41,10 +107,29 @@ func OpenAt(path string) (*Storage, error) {
 		return nil, fmt.Errorf("could not open database at '%v': %v", path, err)
 	}
 
-	return &Storage{db}, nil
+	return begin(db)
 }
 
 func (storage *Storage) Close() error {
+	if storage.joined {
+		return nil
+	}
+
+	if sharedSession == storage {
+		sharedSession = nil
+	}
+
+	if err := storage.Db.EndOperation(); err != nil {
+		if !storage.shared {
+			storage.Db.Close()
+		}
+		return fmt.Errorf("could not update journal: %v", err)
+	}
+
+	if storage.shared {
+		return nil
+	}
+
 	err := storage.Db.Close()
 	if err != nil {
 		return fmt.Errorf("could not close database: %v", err)
@@ -52,3 +137,89 @@ func (storage *Storage) Close() error {
 
 	return nil
 }
+
+// Makes subsequent calls to Open join this session until it is closed: the
+// changes made through them are then journaled as part of this session's
+// operation and made within its transaction, if any.
+func (storage *Storage) ShareSession() {
+	sharedSession = storage
+}
+
+// Starts a transaction: subsequent changes are only made permanent upon
+// Commit.
+func (storage *Storage) Begin() error {
+	return storage.Db.Begin()
+}
+
+// Commits the transaction in progress.
+func (storage *Storage) Commit() error {
+	return storage.Db.Commit()
+}
+
+// Abandons the changes made within the transaction in progress.
+func (storage *Storage) Rollback() error {
+	return storage.Db.Rollback()
+}
+
+// Marks a point within the transaction to which the subsequent changes can be
+// rolled back.
+func (storage *Storage) Savepoint(name string) error {
+	return storage.Db.Savepoint(name)
+}
+
+// Removes the savepoint, keeping the changes made since it.
+func (storage *Storage) ReleaseSavepoint(name string) error {
+	return storage.Db.ReleaseSavepoint(name)
+}
+
+// Abandons the changes made since the savepoint.
+func (storage *Storage) RollbackToSavepoint(name string) error {
+	return storage.Db.RollbackToSavepoint(name)
+}
+
+// Runs the function such that its changes are abandoned should it fail.
+func (storage *Storage) InTransaction(function func() error) error {
+	return storage.Db.InTransaction(function)
+}
+
+// Reverses the changes made by the most recent operation, returning the
+// operation or nil if there are no operations to undo.
+func (storage *Storage) Undo() (*database.Operation, error) {
+	return storage.Db.UndoOperation()
+}
+
+// Reapplies the changes of the most recently undone operation, returning the
+// operation or nil if there are no operations to redo.
+func (storage *Storage) Redo() (*database.Operation, error) {
+	return storage.Db.RedoOperation()
+}
+
+// Retrieves the journaled operations, oldest first.
+func (storage *Storage) Operations() (database.Operations, error) {
+	return storage.Db.Operations()
+}
+
+// unexported
+
+// Starts journaling the changes made through the storage as an operation
+// described by the command line and attributed to the current user.
+func begin(db *database.Database) (*Storage, error) {
+	description := strings.Join(append([]string{filepath.Base(CommandLine[0])}, CommandLine[1:]...), " ")
+
+	if err := db.BeginOperation(description, currentUser()); err != nil {
+		if db != sharedDb {
+			db.Close()
+		}
+		return nil, fmt.Errorf("could not begin journal operation: %v", err)
+	}
+
+	return &Storage{db, false, false}, nil
+}
+
+func currentUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+
+	return os.Getenv("USER")
+}
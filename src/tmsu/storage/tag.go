@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 	"tmsu/storage/database"
 )
 
@@ -49,6 +51,28 @@ func (storage Storage) TagsByNames(names []string) (database.Tags, error) {
 	return storage.Db.TagsByNames(names)
 }
 
+// Retrieves the descendants of the specified tag, e.g. 'media/audio' and
+// 'media/audio/podcast' for 'media'.
+func (storage Storage) TagDescendants(name string) (database.Tags, error) {
+	return storage.Db.TagDescendants(name)
+}
+
+// Retrieves the identifiers of the specified tag and its descendants.
+func (storage Storage) TagAndDescendantIds(tag *database.Tag) ([]uint, error) {
+	descendants, err := storage.Db.TagDescendants(tag.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve descendants of tag '%v': %v", tag.Name, err)
+	}
+
+	tagIds := make([]uint, 0, len(descendants)+1)
+	tagIds = append(tagIds, tag.Id)
+	for _, descendant := range descendants {
+		tagIds = append(tagIds, descendant.Id)
+	}
+
+	return tagIds, nil
+}
+
 // Retrieves the set of tags for the specified file.
 func (storage *Storage) TagsByFileId(fileId uint) (database.Tags, error) {
 	return storage.Db.TagsByFileId(fileId)
@@ -73,6 +97,11 @@ func (storage *Storage) TagsForPath(path string) (database.Tags, error) {
 	return storage.Db.TagsByFileId(file.Id)
 }
 
+// Retrieves the set of tags explicitly applied to the specified file.
+func (storage *Storage) ExplicitTagsByFileId(fileId uint) (database.Tags, error) {
+	return storage.Db.ExplicitTagsByFileId(fileId)
+}
+
 // The set of further tags for which there are tagged files given
 // a particular set of tags.
 func (storage Storage) TagsForTags(tagIds []uint) (database.Tags, error) {
@@ -88,7 +117,12 @@ func (storage Storage) TagsForTags(tagIds []uint) (database.Tags, error) {
 			return nil, fmt.Errorf("could not retrieve tags for file #%v: %v", file.Id, err)
 		}
 
-		for _, tag := range tags {
+		impliedTags, err := storage.ImpliedTags(tags)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve implied tags for file #%v: %v", file.Id, err)
+		}
+
+		for _, tag := range append(tags, impliedTags...) {
 			if !containsTagId(tagIds, tag.Id) && !containsTag(furtherTags, tag) {
 				furtherTags = append(furtherTags, tag)
 			}
@@ -98,22 +132,151 @@ func (storage Storage) TagsForTags(tagIds []uint) (database.Tags, error) {
 	return furtherTags, nil
 }
 
-// Adds a tag.
+// Retrieves the tags implied by the specified tags, or by their ancestors,
+// excluding the specified tags themselves.
+func (storage Storage) ImpliedTags(tags database.Tags) (database.Tags, error) {
+	impliedTags := make(database.Tags, 0)
+
+	compoundImplications, err := storage.Db.CompoundImplications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve compound implications: %v", err)
+	}
+
+	tagIds := make([]uint, 0, len(tags))
+	for _, tag := range tags {
+		tagIds = append(tagIds, tag.Id)
+	}
+
+	// implications of a tag also apply to its descendants
+	seenTagIds := make([]uint, 0, len(tags))
+	for len(tagIds) > 0 {
+		ancestorIds, err := storage.ancestorTagIds(tagIds)
+		if err != nil {
+			return nil, err
+		}
+		tagIds = append(tagIds, ancestorIds...)
+		seenTagIds = append(seenTagIds, tagIds...)
+
+		implications, err := storage.Db.ImplicationsForTags(tagIds)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve implications: %v", err)
+		}
+
+		tagIds = make([]uint, 0)
+		for _, implication := range implications {
+			impliedTag := implication.ImpliedTag
+			if containsTagId(seenTagIds, impliedTag.Id) || containsTagId(tagIds, impliedTag.Id) {
+				continue
+			}
+
+			tagIds = append(tagIds, impliedTag.Id)
+			if !containsTag(tags, &impliedTag) {
+				impliedTags = append(impliedTags, &impliedTag)
+			}
+		}
+
+		for _, implication := range compoundImplications {
+			impliedTag := implication.ImpliedTag
+			if implication.Negated || containsTagId(seenTagIds, impliedTag.Id) || containsTagId(tagIds, impliedTag.Id) {
+				continue
+			}
+			if !implication.ImplyingTags.All(func(tag *database.Tag) bool { return containsTagId(seenTagIds, tag.Id) }) {
+				continue
+			}
+
+			tagIds = append(tagIds, impliedTag.Id)
+			if !containsTag(tags, &impliedTag) {
+				impliedTags = append(impliedTags, &impliedTag)
+			}
+		}
+	}
+
+	sort.Sort(impliedTags)
+
+	return impliedTags, nil
+}
+
+// The set of tags that are neither applied to any file nor feature in any
+// implication or tag group.
+func (storage Storage) UnusedTags() (database.Tags, error) {
+	return storage.Db.UnusedTags()
+}
+
+// Adds a tag, and any of its ancestors that do not already exist.
 func (storage *Storage) AddTag(name string) (*database.Tag, error) {
 	if err := validateTagName(name); err != nil {
 		return nil, err
 	}
 
+	if err := storage.addAncestorTags(name); err != nil {
+		return nil, err
+	}
+
 	return storage.Db.InsertTag(name)
 }
 
-// Renames a tag.
+// Renames a tag along with its descendants.
 func (storage Storage) RenameTag(tagId uint, name string) (*database.Tag, error) {
 	if err := validateTagName(name); err != nil {
 		return nil, err
 	}
 
-	return storage.Db.RenameTag(tagId, name)
+	tag, err := storage.Db.Tag(tagId)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag #%v: %v", tagId, err)
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("no such tag #%v", tagId)
+	}
+
+	if strings.HasPrefix(name, tag.Name+"/") {
+		return nil, fmt.Errorf("cannot rename tag '%v' to one of its descendants.", tag.Name)
+	}
+
+	descendants, err := storage.Db.TagDescendants(tag.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve descendants of tag '%v': %v", tag.Name, err)
+	}
+
+	for _, descendant := range descendants {
+		descendantName := name + descendant.Name[len(tag.Name):]
+
+		existingTag, err := storage.Db.TagByName(descendantName)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag '%v': %v", descendantName, err)
+		}
+		if existingTag != nil {
+			return nil, fmt.Errorf("tag '%v' already exists.", descendantName)
+		}
+	}
+
+	var renamedTag *database.Tag
+
+	// rename the tag and its descendants together so that the hierarchy is
+	// never left split between the old and new names
+	err = storage.InTransaction(func() error {
+		if err := storage.addAncestorTags(name); err != nil {
+			return err
+		}
+
+		renamedTag, err = storage.Db.RenameTag(tagId, name)
+		if err != nil {
+			return err
+		}
+
+		for _, descendant := range descendants {
+			if _, err := storage.Db.RenameTag(descendant.Id, name+descendant.Name[len(tag.Name):]); err != nil {
+				return fmt.Errorf("could not rename tag '%v': %v", descendant.Name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renamedTag, nil
 }
 
 // Copies a tag.
@@ -122,6 +285,10 @@ func (storage Storage) CopyTag(sourceTagId uint, name string) (*database.Tag, er
 		return nil, err
 	}
 
+	if err := storage.addAncestorTags(name); err != nil {
+		return nil, err
+	}
+
 	tag, err := storage.Db.InsertTag(name)
 	if err != nil {
 		return nil, fmt.Errorf("could not create tag '%v': %v", name, err)
@@ -135,16 +302,114 @@ func (storage Storage) CopyTag(sourceTagId uint, name string) (*database.Tag, er
 	return tag, nil
 }
 
-// Deletes a tag.
+// Deletes a tag. A tag that has descendants cannot be deleted as these would be
+// left orphaned: the descendants must be deleted first.
 func (storage Storage) DeleteTag(tagId uint) error {
+	tag, err := storage.Db.Tag(tagId)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag #%v: %v", tagId, err)
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag #%v", tagId)
+	}
+
+	descendants, err := storage.Db.TagDescendants(tag.Name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve descendants of tag '%v': %v", tag.Name, err)
+	}
+	if len(descendants) > 0 {
+		return fmt.Errorf("tag '%v' has descendant tags.", tag.Name)
+	}
+
 	return storage.Db.DeleteTag(tagId)
 }
 
+// Deletes the tags that are neither applied to any file nor feature in any
+// implication or tag group, returning the number deleted. Ancestor tags are
+// deleted once they no longer have any descendants.
+func (storage Storage) DeleteUnusedTags() (uint, error) {
+	var total uint
+
+	for {
+		count, err := storage.Db.DeleteUnusedTags()
+		if err != nil {
+			return total, err
+		}
+		if count == 0 {
+			return total, nil
+		}
+
+		total += count
+	}
+}
+
+// The name of the tag's parent, e.g. 'media/audio' for 'media/audio/podcast',
+// or the empty string for top-level tags.
+func ParentTagName(name string) string {
+	index := strings.LastIndex(name, "/")
+	if index == -1 {
+		return ""
+	}
+
+	return name[:index]
+}
+
 // unexported
 
+func (storage Storage) ancestorTagIds(tagIds []uint) ([]uint, error) {
+	ancestorIds := make([]uint, 0)
+
+	for _, tagId := range tagIds {
+		tag, err := storage.Db.Tag(tagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag #%v: %v", tagId, err)
+		}
+		if tag == nil {
+			continue
+		}
+
+		for name := ParentTagName(tag.Name); name != ""; name = ParentTagName(name) {
+			ancestor, err := storage.Db.TagByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve tag '%v': %v", name, err)
+			}
+			if ancestor != nil && !containsTagId(tagIds, ancestor.Id) && !containsTagId(ancestorIds, ancestor.Id) {
+				ancestorIds = append(ancestorIds, ancestor.Id)
+			}
+		}
+	}
+
+	return ancestorIds, nil
+}
+
+func (storage Storage) addAncestorTags(name string) error {
+	parentName := ParentTagName(name)
+	if parentName == "" {
+		return nil
+	}
+
+	parent, err := storage.Db.TagByName(parentName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", parentName, err)
+	}
+	if parent != nil {
+		return nil
+	}
+
+	if err := storage.addAncestorTags(parentName); err != nil {
+		return err
+	}
+
+	if _, err := storage.Db.InsertTag(parentName); err != nil {
+		return fmt.Errorf("could not add tag '%v': %v", parentName, err)
+	}
+
+	return nil
+}
+
 func validateTagName(tagName string) error {
-	if tagName == "." || tagName == ".." {
-		return errors.New("tag name cannot be '.' or '..'.")
+	if tagName == "" {
+		return errors.New("tag name cannot be empty.")
 	}
 
 	if tagName[0] == '-' {
@@ -159,8 +424,15 @@ func validateTagName(tagName string) error {
 			return errors.New("tag names cannot contain '='.")
 		case ' ':
 			return errors.New("tag names cannot contain ' '.")
-		case '/':
-			return errors.New("tag names cannot contain '/'.")
+		}
+	}
+
+	for _, part := range strings.Split(tagName, "/") {
+		switch part {
+		case "":
+			return errors.New("tag names cannot start or end with '/' or contain '//'.")
+		case ".", "..":
+			return errors.New("tag name cannot be '.' or '..'.")
 		}
 	}
 
@@ -260,18 +260,26 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 	path := vfs.splitPath(name)
 	tagNames := path[1 : len(path)-1]
 
-	for _, tagName := range tagNames {
-		tag, err := vfs.store.Db.TagByName(tagName)
+	tags, err := vfs.pathTags(tagNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tags == nil {
+		log.Fatalf("Could not retrieve tags '%v'.", tagNames)
+	}
+
+	for _, tag := range tags {
+		// the file may be tagged with a descendant of the tag
+		tagIds, err := vfs.store.TagAndDescendantIds(tag)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if tag == nil {
-			log.Fatalf("Could not retrieve tag '%v'.", tagName)
-		}
 
-		err = vfs.store.RemoveFileTag(fileId, tag.Id)
-		if err != nil {
-			log.Fatal(err)
+		for _, tagId := range tagIds {
+			err = vfs.store.RemoveFileTag(fileId, tagId)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 
@@ -321,9 +329,17 @@ func (vfs FuseVfs) tagDirectories() ([]fuse.DirEntry, fuse.Status) {
 		log.Fatalf("Could not retrieve tags: %v", err)
 	}
 
-	entries := make([]fuse.DirEntry, len(tags))
-	for index, tag := range tags {
-		entries[index] = fuse.DirEntry{Name: tag.Name, Mode: fuse.S_IFDIR}
+	// descendant tags appear within their top-level tag's directory
+	entries := make([]fuse.DirEntry, 0, len(tags))
+	names := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		name := strings.SplitN(tag.Name, "/", 2)[0]
+		if names[name] {
+			continue
+		}
+
+		names[name] = true
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
 	}
 
 	return entries, fuse.OK
@@ -356,11 +372,11 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 
 	if fileId == 0 {
 		// tag directory
-		tagIds, err := vfs.tagNamesToIds(path)
+		tags, err := vfs.pathTags(path)
 		if err != nil {
-			log.Fatalf("Could not lookup tag IDs: %v.", err)
+			log.Fatalf("Could not lookup tags: %v.", err)
 		}
-		if tagIds == nil {
+		if tags == nil {
 			return nil, fuse.ENOENT
 		}
 
@@ -401,15 +417,20 @@ func (vfs FuseVfs) openTaggedEntryDir(path []string) ([]fuse.DirEntry, fuse.Stat
 	log.Infof("BEGIN openTaggedEntryDir(%v)", path)
 	defer log.Infof("END openTaggedEntryDir(%v)", path)
 
-	tagIds, err := vfs.tagNamesToIds(path)
+	tags, err := vfs.pathTags(path)
 	if err != nil {
-		log.Fatalf("Could not lookup tag IDs: %v.", err)
+		log.Fatalf("Could not lookup tags: %v.", err)
 	}
-	if tagIds == nil {
+	if tags == nil {
 		return nil, fuse.ENOENT
 	}
 
-	furtherTagIds, err := vfs.store.TagsForTags(tagIds)
+	tagIds := make([]uint, len(tags))
+	for index, tag := range tags {
+		tagIds[index] = tag.Id
+	}
+
+	furtherTags, err := vfs.store.TagsForTags(tagIds)
 	if err != nil {
 		log.Fatalf("Could not retrieve tags for tags: %v", err)
 	}
@@ -419,9 +440,9 @@ func (vfs FuseVfs) openTaggedEntryDir(path []string) ([]fuse.DirEntry, fuse.Stat
 		log.Fatalf("Could not retrieve tagged files: %v", err)
 	}
 
-	entries := make([]fuse.DirEntry, 0, len(files)+len(furtherTagIds))
-	for _, tag := range furtherTagIds {
-		entries = append(entries, fuse.DirEntry{Name: tag.Name, Mode: fuse.S_IFDIR | 0755})
+	entries := make([]fuse.DirEntry, 0, len(files)+len(furtherTags))
+	for _, name := range vfs.furtherTagDirectoryNames(tags, furtherTags) {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR | 0755})
 	}
 	for _, file := range files {
 		linkName := vfs.getLinkName(file)
@@ -466,22 +487,82 @@ func (vfs FuseVfs) getLinkName(file *database.File) string {
 	return linkName + suffix
 }
 
-func (vfs FuseVfs) tagNamesToIds(tagNames []string) ([]uint, error) {
-	tagIds := make([]uint, len(tagNames))
+// Resolves the tag directory names to tags. A name that follows a tag is that
+// tag's child, if it has one of that name, rather than another top-level tag,
+// e.g. 'media/audio/rock' is the tags 'media/audio' and 'rock'.
+func (vfs FuseVfs) pathTags(names []string) (database.Tags, error) {
+	tags := make(database.Tags, 0, len(names))
+
+	for _, name := range names {
+		if len(tags) > 0 {
+			childName := tags[len(tags)-1].Name + "/" + name
+
+			tag, err := vfs.store.Db.TagByName(childName)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve tag '%v': %v", childName, err)
+			}
+			if tag != nil {
+				tags[len(tags)-1] = tag
+				continue
+			}
+		}
 
-	for index, tagName := range tagNames {
-		tag, err := vfs.store.Db.TagByName(tagName)
+		tag, err := vfs.store.Db.TagByName(name)
 		if err != nil {
-			return nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+			return nil, fmt.Errorf("could not retrieve tag '%v': %v", name, err)
 		}
 		if tag == nil {
 			return nil, nil
 		}
 
-		tagIds[index] = tag.Id
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// The names of the directories for the further tags: the children of the
+// last tag followed by the top-level names of the other tags.
+func (vfs FuseVfs) furtherTagDirectoryNames(tags, furtherTags database.Tags) []string {
+	lastTag := tags[len(tags)-1]
+	names := make([]string, 0, len(furtherTags))
+	seen := make(map[string]bool, len(furtherTags))
+
+	for _, tag := range furtherTags {
+		if !strings.HasPrefix(tag.Name, lastTag.Name+"/") {
+			continue
+		}
+
+		name := strings.SplitN(tag.Name[len(lastTag.Name)+1:], "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, tag := range furtherTags {
+		if strings.HasPrefix(tag.Name, lastTag.Name+"/") || isAncestorOfAny(tag, tags) {
+			continue
+		}
+
+		name := strings.SplitN(tag.Name, "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func isAncestorOfAny(tag *database.Tag, tags database.Tags) bool {
+	for _, candidate := range tags {
+		if strings.HasPrefix(candidate.Name, tag.Name+"/") {
+			return true
+		}
 	}
 
-	return tagIds, nil
+	return false
 }
 
 func Uitoa(ui uint) string {